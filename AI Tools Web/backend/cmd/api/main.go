@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"backend/internal/account"
+	"backend/internal/admin"
 	"backend/internal/auth"
 	"backend/internal/chat"
 	"backend/internal/db"
@@ -20,11 +24,29 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// 令牌签名密钥缺失或使用示例值时拒绝启动
+	if err := auth.InitKeys(); err != nil {
+		log.Fatalf("Invalid JWT key configuration: %v", err)
+	}
+
 	if err := db.InitDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.CloseDB()
 
+	indexCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := db.EnsureIndexes(indexCtx); err != nil {
+		log.Fatalf("Failed to create database indexes: %v", err)
+	}
+	cancel()
+
+	// 继续执行上次未完成的后台任务（例如账户删除）
+	resumeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := account.ResumeJobs(resumeCtx); err != nil {
+		log.Printf("Failed to resume background jobs: %v", err)
+	}
+	cancel()
+
 	router := mux.NewRouter()
 
 	// 配置CORS
@@ -37,42 +59,121 @@ func main() {
 	})
 	router.Use(corsMiddleware.Handler)
 
+	// 令牌验证公钥，供其他服务验证本服务签发的令牌
+	router.HandleFunc("/.well-known/jwks.json", auth.JWKSHandler).Methods("GET", "OPTIONS")
+
 	// Auth routes
 	router.HandleFunc("/api/register", auth.RegisterHandler).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/login", auth.LoginHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/login/2fa", auth.Login2FAHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/refresh", auth.RefreshHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/logout", auth.LogoutHandler).Methods("POST", "OPTIONS")
+
+	// 邮箱验证和找回密码
+	router.HandleFunc("/api/verify-email", auth.VerifyEmailHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/verify-email/resend", auth.ResendVerificationHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/password/forgot", auth.ForgotPasswordHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/password/reset", auth.ResetPasswordHandler).Methods("POST", "OPTIONS")
+
+	// 单点登录 (OIDC) routes
+	router.HandleFunc("/api/oidc/config", auth.OIDCConfigHandler).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/oidc/login", auth.OIDCLoginHandler).Methods("GET")
+	router.HandleFunc("/api/oidc/callback", auth.OIDCCallbackHandler).Methods("GET")
 
 	// Password change route with JWT middleware
 	passwordRouter := router.PathPrefix("/api/user").Subrouter()
 	passwordRouter.Use(auth.JWTMiddleware)
+	passwordRouter.Use(auth.RequirePermission(auth.PermAccount))
 	passwordRouter.HandleFunc("/change-password", auth.ChangePasswordHandler).Methods("POST", "OPTIONS")
 
+	// 两步验证
+	passwordRouter.HandleFunc("/2fa", auth.TwoFactorStatusHandler).Methods("GET", "OPTIONS")
+	passwordRouter.HandleFunc("/2fa/setup", auth.TwoFactorSetupHandler).Methods("POST", "OPTIONS")
+	passwordRouter.HandleFunc("/2fa/enable", auth.TwoFactorEnableHandler).Methods("POST", "OPTIONS")
+	passwordRouter.HandleFunc("/2fa/disable", auth.TwoFactorDisableHandler).Methods("POST", "OPTIONS")
+	passwordRouter.HandleFunc("/2fa/recovery-codes", auth.RegenerateRecoveryCodesHandler).Methods("POST", "OPTIONS")
+
+	// 个人访问令牌管理
+	passwordRouter.HandleFunc("/api-keys", auth.ListAPIKeysHandler).Methods("GET", "OPTIONS")
+	passwordRouter.HandleFunc("/api-keys", auth.CreateAPIKeyHandler).Methods("POST", "OPTIONS")
+	passwordRouter.HandleFunc("/api-keys/{id}", auth.DeleteAPIKeyHandler).Methods("DELETE", "OPTIONS")
+
+	// 聊天偏好设置
+	passwordRouter.HandleFunc("/preferences", chat.GetPreferencesHandler).Methods("GET", "OPTIONS")
+	passwordRouter.HandleFunc("/preferences", chat.UpdatePreferencesHandler).Methods("PUT", "OPTIONS")
+	passwordRouter.HandleFunc("/preferences", chat.DeletePreferencesHandler).Methods("DELETE", "OPTIONS")
+
+	// 账户数据导出和删除
+	passwordRouter.HandleFunc("/export", account.ExportHandler).Methods("GET", "OPTIONS")
+	passwordRouter.HandleFunc("/delete", account.DeleteAccountHandler).Methods("POST", "OPTIONS")
+
+	// 后台任务状态，账户删除后无法登录，凭任务 ID 查询
+	router.HandleFunc("/api/jobs/{id}", account.GetJobHandler).Methods("GET", "OPTIONS")
+
+	// 聊天的公开分享，不需要登录
+	router.HandleFunc("/api/share/{token}", chat.GetSharedChatHandler).Methods("GET", "OPTIONS")
+
 	// Chat routes with JWT middleware
 	chatRouter := router.PathPrefix("/api/chat").Subrouter()
 	chatRouter.Use(auth.JWTMiddleware)
 
-	chatRouter.HandleFunc("/history", chat.GetChatHistoryHandler).Methods("GET", "OPTIONS")
-	chatRouter.HandleFunc("/new", chat.CreateChatHandler).Methods("POST", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/messages", chat.GetChatMessagesHandler).Methods("GET", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/messages", chat.SendMessageHandler).Methods("POST", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/messages/stream", chat.SendMessageStreamHandler).Methods("GET", "POST", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/messages/ai", chat.SaveAIMessageHandler).Methods("POST", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/title", chat.UpdateChatTitleHandler).Methods("PUT", "OPTIONS")
-	chatRouter.HandleFunc("/{id}", chat.DeleteChatHandler).Methods("DELETE", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/info", chat.GetChatInfoHandler).Methods("GET", "OPTIONS")
-	chatRouter.HandleFunc("/{id}/model", chat.UpdateChatModelHandler).Methods("PUT", "OPTIONS")
-	chatRouter.HandleFunc("/models", chat.GetAvailableModelsHandler).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/history", auth.WithPermission(auth.PermChatRead, chat.GetChatHistoryHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/new", auth.WithPermission(auth.PermChatWrite, chat.CreateChatHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/search", auth.WithPermission(auth.PermChatRead, chat.SearchHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/export", auth.WithPermission(auth.PermChatRead, chat.ExportAllChatsHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/import", auth.WithPermission(auth.PermChatWrite, chat.ImportChatHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/shares", auth.WithPermission(auth.PermChatRead, chat.ListSharesHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/shares/{shareId}", auth.WithPermission(auth.PermChatWrite, chat.DeleteShareHandler)).Methods("DELETE", "OPTIONS")
+	chatRouter.Handle("/attachments", auth.WithPermission(auth.PermChatWrite, chat.UploadAttachmentHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/attachments/{attachmentId}", auth.WithPermission(auth.PermChatRead, chat.GetAttachmentHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/personas", auth.WithPermission(auth.PermChatRead, chat.ListPersonasHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/personas", auth.WithPermission(auth.PermChatWrite, chat.CreatePersonaHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/personas/{personaId}", auth.WithPermission(auth.PermChatWrite, chat.UpdatePersonaHandler)).Methods("PUT", "OPTIONS")
+	chatRouter.Handle("/personas/{personaId}", auth.WithPermission(auth.PermChatWrite, chat.DeletePersonaHandler)).Methods("DELETE", "OPTIONS")
+	chatRouter.Handle("/templates", auth.WithPermission(auth.PermChatRead, chat.ListTemplatesHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/templates", auth.WithPermission(auth.PermChatWrite, chat.CreateTemplateHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/templates/{templateId}", auth.WithPermission(auth.PermChatWrite, chat.UpdateTemplateHandler)).Methods("PUT", "OPTIONS")
+	chatRouter.Handle("/templates/{templateId}", auth.WithPermission(auth.PermChatWrite, chat.DeleteTemplateHandler)).Methods("DELETE", "OPTIONS")
+	chatRouter.Handle("/ws", auth.WithPermission(auth.PermChatWrite, chat.ChatWebSocketHandler)).Methods("GET")
+	chatRouter.Handle("/{id}/messages", auth.WithPermission(auth.PermChatRead, chat.GetChatMessagesHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/{id}/messages", auth.WithPermission(auth.PermChatWrite, chat.SendMessageHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/{id}/messages/stream", auth.WithPermission(auth.PermChatWrite, chat.SendMessageStreamHandler)).Methods("GET", "POST", "OPTIONS")
+	chatRouter.Handle("/{id}/messages/{messageId}/edit", auth.WithPermission(auth.PermChatWrite, chat.EditMessageHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/{id}/messages/{messageId}/regenerate", auth.WithPermission(auth.PermChatWrite, chat.RegenerateMessageHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/{id}/branch", auth.WithPermission(auth.PermChatWrite, chat.SwitchBranchHandler)).Methods("PUT", "OPTIONS")
+	chatRouter.Handle("/{id}/stop", auth.WithPermission(auth.PermChatWrite, chat.StopGenerationHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/{id}/title", auth.WithPermission(auth.PermChatWrite, chat.UpdateChatTitleHandler)).Methods("PUT", "OPTIONS")
+	chatRouter.Handle("/{id}", auth.WithPermission(auth.PermChatWrite, chat.DeleteChatHandler)).Methods("DELETE", "OPTIONS")
+	chatRouter.Handle("/{id}/info", auth.WithPermission(auth.PermChatRead, chat.GetChatInfoHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/{id}/export", auth.WithPermission(auth.PermChatRead, chat.ExportChatHandler)).Methods("GET", "OPTIONS")
+	chatRouter.Handle("/{id}/shares", auth.WithPermission(auth.PermChatWrite, chat.CreateShareHandler)).Methods("POST", "OPTIONS")
+	chatRouter.Handle("/{id}/model", auth.WithPermission(auth.PermChatWrite, chat.UpdateChatModelHandler)).Methods("PUT", "OPTIONS")
+	chatRouter.Handle("/models", auth.WithPermission(auth.PermChatRead, chat.GetAvailableModelsHandler)).Methods("GET", "OPTIONS")
 
 	// RAG routes
 	ragRouter := router.PathPrefix("/api/rag").Subrouter()
 	ragRouter.Use(auth.JWTMiddleware)
 
-	ragRouter.HandleFunc("/upload", rag.UploadHandler).Methods("POST", "OPTIONS")
-	ragRouter.HandleFunc("/documents", rag.ListDocumentsHandler).Methods("GET", "OPTIONS")
-	ragRouter.HandleFunc("/document/{doc_id}", rag.DeleteDocumentHandler).Methods("DELETE", "OPTIONS")
-	ragRouter.HandleFunc("/document/{doc_id}/reprocess", rag.ReprocessDocumentHandler).Methods("POST", "OPTIONS")
-	ragRouter.HandleFunc("/query", rag.QueryHandler).Methods("POST", "OPTIONS")
-	ragRouter.HandleFunc("/status/{task_id}", rag.GetStatusHandler).Methods("GET", "OPTIONS")
-	ragRouter.HandleFunc("/clear-vectors", rag.ClearVectorDBHandler).Methods("POST", "OPTIONS")
+	ragRouter.Handle("/upload", auth.WithPermission(auth.PermRAGUpload, rag.UploadHandler)).Methods("POST", "OPTIONS")
+	ragRouter.Handle("/documents", auth.WithPermission(auth.PermRAGQuery, rag.ListDocumentsHandler)).Methods("GET", "OPTIONS")
+	ragRouter.Handle("/document/{doc_id}", auth.WithPermission(auth.PermRAGUpload, rag.DeleteDocumentHandler)).Methods("DELETE", "OPTIONS")
+	ragRouter.Handle("/document/{doc_id}/reprocess", auth.WithPermission(auth.PermRAGUpload, rag.ReprocessDocumentHandler)).Methods("POST", "OPTIONS")
+	ragRouter.Handle("/query", auth.WithPermission(auth.PermRAGQuery, rag.QueryHandler)).Methods("POST", "OPTIONS")
+	ragRouter.Handle("/status/{task_id}", auth.WithPermission(auth.PermRAGQuery, rag.GetStatusHandler)).Methods("GET", "OPTIONS")
+	// 清空向量库会影响所有用户，仅管理员可用
+	ragRouter.Handle("/clear-vectors", auth.WithPermission(auth.PermRAGAdmin, rag.ClearVectorDBHandler)).Methods("POST", "OPTIONS")
+
+	// Admin routes
+	adminRouter := router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.Use(auth.JWTMiddleware)
+	adminRouter.Use(auth.RequirePermission(auth.PermManageUsers))
+
+	adminRouter.HandleFunc("/users", admin.ListUsersHandler).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/users/{id}/disable", admin.DisableUserHandler).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/users/{id}/enable", admin.EnableUserHandler).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/users/{id}/role", admin.UpdateUserRoleHandler).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/users/{id}/unlock", admin.UnlockUserHandler).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/users/{id}", admin.DeleteUserHandler).Methods("DELETE", "OPTIONS")
 
 	port := os.Getenv("PORT")
 	if port == "" {
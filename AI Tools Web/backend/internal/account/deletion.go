@@ -0,0 +1,194 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/rag"
+)
+
+// 删除任务最多尝试的次数，以及每次重试前的等待时间（按尝试次数递增）
+const (
+	maxDeletionAttempts = 3
+	deletionRetryDelay  = 30 * time.Second
+	// 单次执行的超时时间，RAG 服务删除大量文档时可能较慢
+	deletionTimeout = 10 * time.Minute
+)
+
+// newJobID 生成随机任务 ID。任务状态接口不需要登录（账户删除后无法再登录），
+// 因此 ID 必须不可猜测。
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// StartDeletion 立即禁用账户并撤销所有会话，然后在后台删除账户数据。
+// 同一账户已有未完成的删除任务时直接返回该任务。
+func StartDeletion(ctx context.Context, user *models.User, requestedBy string) (*models.Job, error) {
+	jobs := db.NewJobRepository()
+	if existing, err := jobs.FindActiveJob(ctx, models.JobTypeAccountDeletion, user.Email); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return existing, nil
+	}
+
+	// 先禁用账户，删除完成前不能再登录或使用 API 密钥
+	if err := db.NewUserRepository().SetDisabled(ctx, user.ID, true); err != nil {
+		return nil, fmt.Errorf("failed to disable user: %w", err)
+	}
+	if err := auth.RevokeUserSessions(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &models.Job{
+		ID:          id,
+		Type:        models.JobTypeAccountDeletion,
+		UserEmail:   user.Email,
+		RequestedBy: requestedBy,
+	}
+	if err := jobs.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Account deletion job %s created for %s (requested by %s)", job.ID, user.Email, requestedBy)
+	go runDeletion(job.ID)
+	return job, nil
+}
+
+// ResumeJobs 服务启动时继续执行上次未完成的任务
+func ResumeJobs(ctx context.Context) error {
+	jobs, err := db.NewJobRepository().ListActiveJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Type != models.JobTypeAccountDeletion {
+			log.Printf("Skipping job %s with unknown type %s", job.ID, job.Type)
+			continue
+		}
+		log.Printf("Resuming account deletion job %s (attempt %d)", job.ID, job.Attempts+1)
+		go runDeletion(job.ID)
+	}
+	return nil
+}
+
+// runDeletion 执行删除任务，失败时按递增间隔重试
+func runDeletion(jobID string) {
+	jobs := db.NewJobRepository()
+
+	for {
+		job, err := jobs.StartAttempt(context.Background(), jobID)
+		if err != nil {
+			log.Printf("Error starting job %s: %v", jobID, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), deletionTimeout)
+		result, err := DeleteAccountData(ctx, job.UserEmail)
+		cancel()
+
+		if err == nil {
+			if err := jobs.CompleteJob(context.Background(), jobID, result); err != nil {
+				log.Printf("Error completing job %s: %v", jobID, err)
+			}
+			log.Printf("Account deletion job %s completed for %s: %v", jobID, job.UserEmail, result)
+			return
+		}
+
+		final := job.Attempts >= maxDeletionAttempts
+		log.Printf("Account deletion job %s attempt %d failed: %v", jobID, job.Attempts, err)
+		if err := jobs.FailAttempt(context.Background(), jobID, err.Error(), final); err != nil {
+			log.Printf("Error recording failure of job %s: %v", jobID, err)
+		}
+		if final {
+			return
+		}
+		time.Sleep(time.Duration(job.Attempts) * deletionRetryDelay)
+	}
+}
+
+// DeleteAccountData 删除账户的所有数据：RAG 文档和向量、聊天和消息、API 密钥、
+// 角色和提示模板、偏好设置、登录记录、会话，最后删除用户记录。每一步都可以安全地重复执行，
+// 任务中断后重新运行会从未完成的部分继续。
+func DeleteAccountData(ctx context.Context, email string) (map[string]int64, error) {
+	result := map[string]int64{}
+
+	// RAG 服务中的文档和向量
+	documents := db.NewDocumentRepository()
+	docs, err := documents.ListUserDocuments(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	for _, doc := range docs {
+		if err := rag.DeleteDocument(ctx, doc.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete document %s: %w", doc.ID, err)
+		}
+		if err := documents.DeleteDocument(ctx, doc.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete document record %s: %w", doc.ID, err)
+		}
+	}
+	result["documents"] = int64(len(docs))
+
+	chats, err := db.NewChatRepository().DeleteUserChats(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	result["chats"] = chats
+
+	keys, err := db.NewAPIKeyRepository().DeleteUserAPIKeys(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete api keys: %w", err)
+	}
+	result["api_keys"] = keys
+
+	personas, err := db.NewPersonaRepository().DeleteUserPersonas(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete personas: %w", err)
+	}
+	result["personas"] = personas
+
+	templates, err := db.NewPromptTemplateRepository().DeleteUserTemplates(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete prompt templates: %w", err)
+	}
+	result["prompt_templates"] = templates
+
+	if _, err := db.NewPreferencesRepository().DeletePreferences(ctx, email); err != nil {
+		return nil, fmt.Errorf("failed to delete preferences: %w", err)
+	}
+	if _, err := auth.UnlockAccount(ctx, email); err != nil {
+		return nil, fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+	if err := auth.RevokeUserSessions(ctx, email); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	users := db.NewUserRepository()
+	user, err := users.GetUserByEmail(ctx, email)
+	if errors.Is(err, db.ErrUserNotFound) {
+		// 上一次执行已经删除了用户记录
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := users.DeleteUser(ctx, user.ID); err != nil && !errors.Is(err, db.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+	return result, nil
+}
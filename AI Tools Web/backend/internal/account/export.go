@@ -0,0 +1,154 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+)
+
+// Export 导出的账户数据
+type Export struct {
+	Profile     models.UserProfile
+	Preferences *models.UserPreferences
+	APIKeys     []models.APIKey
+	Personas    []models.Persona
+	Templates   []models.PromptTemplate
+	Documents   []models.Document
+	Chats       []models.ChatResponse
+}
+
+// CollectExport 从数据库读取用户的全部数据
+func CollectExport(ctx context.Context, user *models.User) (*Export, error) {
+	export := &Export{Profile: user.Profile()}
+
+	var err error
+	if export.Preferences, err = db.NewPreferencesRepository().GetPreferences(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to load preferences: %w", err)
+	}
+	if export.APIKeys, err = db.NewAPIKeyRepository().ListAPIKeys(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to load api keys: %w", err)
+	}
+	if export.Personas, err = ownPersonas(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to load personas: %w", err)
+	}
+	if export.Templates, err = ownTemplates(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+	if export.Documents, err = db.NewDocumentRepository().ListUserDocuments(ctx, user.Email); err != nil {
+		return nil, fmt.Errorf("failed to load documents: %w", err)
+	}
+
+	repo := db.NewChatRepository()
+	chats, err := repo.GetChatHistory(ctx, user.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chats: %w", err)
+	}
+	for _, chat := range chats {
+		messages, err := repo.GetMessages(ctx, user.Email, chat.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages of chat %s: %w", chat.ID, err)
+		}
+		if messages == nil {
+			messages = []models.Message{}
+		}
+		export.Chats = append(export.Chats, models.ChatResponse{Chat: chat, Messages: messages})
+	}
+	return export, nil
+}
+
+// ownPersonas 用户自己创建的角色，不包括其他人创建的全局角色
+func ownPersonas(ctx context.Context, email string) ([]models.Persona, error) {
+	personas, err := db.NewPersonaRepository().ListPersonas(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	var own []models.Persona
+	for _, p := range personas {
+		if p.OwnerEmail == email {
+			own = append(own, p)
+		}
+	}
+	return own, nil
+}
+
+// ownTemplates 用户自己创建的提示模板
+func ownTemplates(ctx context.Context, email string) ([]models.PromptTemplate, error) {
+	templates, err := db.NewPromptTemplateRepository().ListTemplates(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	var own []models.PromptTemplate
+	for _, t := range templates {
+		if t.OwnerEmail == email {
+			own = append(own, t)
+		}
+	}
+	return own, nil
+}
+
+// writeJSON 将数据以格式化 JSON 写入压缩包中的文件
+func writeJSON(zw *zip.Writer, name string, modified time.Time, data interface{}) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// WriteArchive 将导出数据打包为 zip 写入 w：
+//
+//	profile.json      账户信息
+//	preferences.json  聊天偏好设置（设置过时）
+//	api_keys.json     API 密钥（不含密钥本身）
+//	personas.json     创建的助手角色
+//	templates.json    创建的提示模板
+//	documents.json    上传到知识库的文档列表
+//	chats/<id>.json   每个聊天及其全部消息
+func WriteArchive(w io.Writer, export *Export) error {
+	now := time.Now()
+	zw := zip.NewWriter(w)
+
+	if err := writeJSON(zw, "profile.json", now, export.Profile); err != nil {
+		return err
+	}
+	if export.Preferences != nil {
+		if err := writeJSON(zw, "preferences.json", now, export.Preferences); err != nil {
+			return err
+		}
+	}
+	if err := writeJSON(zw, "api_keys.json", now, nonNil(export.APIKeys)); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "personas.json", now, nonNil(export.Personas)); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "templates.json", now, nonNil(export.Templates)); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "documents.json", now, nonNil(export.Documents)); err != nil {
+		return err
+	}
+	for _, chat := range export.Chats {
+		if err := writeJSON(zw, "chats/"+chat.Chat.ID+".json", now, chat); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// nonNil 让空列表编码为 [] 而不是 null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,132 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// loadCurrentUser 从数据库读取当前登录用户
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := db.NewUserRepository().GetUserByEmail(r.Context(), claims.Email)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Error loading user %s: %v", claims.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// ExportHandler 以 zip 压缩包下载当前用户的全部数据
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := CollectExport(r.Context(), user)
+	if err != nil {
+		log.Printf("Error exporting data for %s: %v", user.Email, err)
+		http.Error(w, "Failed to export account data", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("account-export-%s.zip", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// 压缩包直接写入响应，出错时响应头已发送，只能中断下载
+	if err := WriteArchive(w, export); err != nil {
+		log.Printf("Error writing export archive for %s: %v", user.Email, err)
+		panic(http.ErrAbortHandler)
+	}
+	log.Printf("Exported account data for %s", user.Email)
+}
+
+// DeleteAccountHandler 用户删除自己的账户。需要重新验证身份，删除在后台任务中完成，
+// 返回的任务 ID 可用于查询进度。
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	confirmed, err := auth.ConfirmIdentity(r.Context(), user, req.Password, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Printf("Error confirming identity of %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !confirmed {
+		http.Error(w, "Invalid password or two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	job, err := StartDeletion(r.Context(), user, user.Email)
+	if err != nil {
+		log.Printf("Error starting account deletion for %s: %v", user.Email, err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJobAccepted(w, job)
+}
+
+// WriteJobAccepted 返回 202 和任务信息
+func WriteJobAccepted(w http.ResponseWriter, job *models.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Account deletion started",
+		"job_id":  job.ID,
+		"status":  job.Status,
+	})
+}
+
+// GetJobHandler 查询后台任务状态。任务 ID 是随机生成的，持有 ID 即可查询，
+// 返回内容不包含账户信息。
+func GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := db.NewJobRepository().GetJob(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, db.ErrJobNotFound) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error loading job: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,179 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/internal/account"
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// loadTargetUser 读取路径中的目标用户，并阻止管理员对自己执行危险操作
+func loadTargetUser(w http.ResponseWriter, r *http.Request, allowSelf bool) (*models.User, bool) {
+	admin, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	userID := mux.Vars(r)["id"]
+	if userID == "" {
+		http.Error(w, "Missing user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := db.NewUserRepository().GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Error loading user %s: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !allowSelf && user.Email == admin.Email {
+		http.Error(w, "Administrators cannot perform this action on their own account", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// ListUsersHandler 列出所有用户
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := db.NewUserRepository().ListUsers(r.Context())
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	profiles := make([]models.UserProfile, 0, len(users))
+	for i := range users {
+		profiles = append(profiles, users[i].Profile())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// setUserDisabled 禁用或启用用户，禁用时立即结束其所有会话
+func setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	user, ok := loadTargetUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := db.NewUserRepository().SetDisabled(r.Context(), user.ID, disabled); err != nil {
+		log.Printf("Error updating user %s: %v", user.Email, err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if disabled {
+		if err := auth.RevokeUserSessions(r.Context(), user.Email); err != nil {
+			log.Printf("Error revoking sessions for %s: %v", user.Email, err)
+			http.Error(w, "User disabled but sessions could not be revoked", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Printf("User %s disabled=%v", user.Email, disabled)
+	user.Disabled = disabled
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.Profile())
+}
+
+// DisableUserHandler 禁用用户
+func DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, true)
+}
+
+// EnableUserHandler 重新启用用户
+func EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, false)
+}
+
+// UnlockUserHandler 清除用户的登录失败记录，解除暴力破解防护导致的锁定
+func UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadTargetUser(w, r, true)
+	if !ok {
+		return
+	}
+
+	unlocked, err := auth.UnlockAccount(r.Context(), user.Email)
+	if err != nil {
+		log.Printf("Error unlocking user %s: %v", user.Email, err)
+		http.Error(w, "Failed to unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Login lock cleared for user %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "User unlocked successfully",
+		"unlocked": unlocked,
+	})
+}
+
+// UpdateUserRoleHandler 修改用户角色
+func UpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !models.IsValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadTargetUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := db.NewUserRepository().SetRole(r.Context(), user.ID, req.Role); err != nil {
+		log.Printf("Error updating role for %s: %v", user.Email, err)
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	// 角色写在令牌中，结束现有会话使新角色立即生效
+	if err := auth.RevokeUserSessions(r.Context(), user.Email); err != nil {
+		log.Printf("Error revoking sessions for %s: %v", user.Email, err)
+	}
+
+	log.Printf("User %s role changed from %s to %s", user.Email, user.EffectiveRole(), req.Role)
+	user.Role = req.Role
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.Profile())
+}
+
+// DeleteUserHandler 禁用用户并在后台任务中删除账户及其全部数据
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadTargetUser(w, r, false)
+	if !ok {
+		return
+	}
+
+	admin, _ := auth.UserFromContext(r.Context())
+	job, err := account.StartDeletion(r.Context(), user, admin.Email)
+	if err != nil {
+		log.Printf("Error starting deletion of user %s: %v", user.Email, err)
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	account.WriteJobAccepted(w, job)
+}
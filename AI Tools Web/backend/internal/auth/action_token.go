@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// 一次性令牌的用途，不同用途的令牌不能互相替代
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// ErrInvalidActionToken 令牌无效、已过期或用途不符
+var ErrInvalidActionToken = errors.New("invalid or expired token")
+
+// ActionToken 邮箱验证和密码重置令牌中的信息
+type ActionToken struct {
+	Email     string
+	Purpose   string
+	Binding   string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// EmailVerificationTTL 邮箱验证链接有效期，可通过 EMAIL_VERIFICATION_TTL 配置
+func EmailVerificationTTL() time.Duration {
+	return config.Duration("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// PasswordResetTTL 密码重置链接有效期，可通过 PASSWORD_RESET_TTL 配置
+func PasswordResetTTL() time.Duration {
+	return config.Duration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// GenerateActionToken issues a signed single-purpose token for the email address.
+// binding is an optional value that must still match when the token is used, e.g. a
+// fingerprint of the current password so that a password change invalidates old reset links.
+func GenerateActionToken(email, purpose, binding string, ttl time.Duration) (string, error) {
+	if email == "" || purpose == "" {
+		return "", errors.New("email and purpose are required")
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"email":   email,
+		"purpose": purpose,
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     now.Add(ttl).Unix(),
+	}
+	if binding != "" {
+		claims["bnd"] = binding
+	}
+
+	return signToken(claims)
+}
+
+// ParseActionToken verifies the signature and expiry of a token and checks its purpose.
+// It does not check single use; callers consume the token ID after validating it.
+func ParseActionToken(tokenString, purpose string) (*ActionToken, error) {
+	token, err := parseToken(tokenString)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidActionToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidActionToken
+	}
+
+	result := &ActionToken{}
+	result.Email, _ = claims["email"].(string)
+	result.Purpose, _ = claims["purpose"].(string)
+	result.Binding, _ = claims["bnd"].(string)
+	result.ID, _ = claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	result.ExpiresAt = time.Unix(int64(exp), 0)
+
+	if result.Email == "" || result.ID == "" || exp == 0 || result.Purpose != purpose {
+		return nil, ErrInvalidActionToken
+	}
+	return result, nil
+}
+
+// passwordFingerprint 当前密码哈希的指纹，密码修改后旧的重置链接随之失效
+func passwordFingerprint(storedPassword string) string {
+	return hashToken(storedPassword)[:16]
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"backend/internal/db"
+	"backend/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyPrefix 个人访问令牌的前缀，用于和 JWT 区分
+const APIKeyPrefix = "zat_"
+
+// 每个用户最多可创建的访问令牌数量
+const maxAPIKeysPerUser = 20
+
+// APIKeyScopes 可以授予个人访问令牌的权限。账户管理和管理员权限不能通过令牌授予。
+var APIKeyScopes = []string{PermChatRead, PermChatWrite, PermRAGQuery, PermRAGUpload}
+
+// ErrInvalidAPIKey 访问令牌无效、已过期或所属用户不可用
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// NewAPIKey generates a personal access token and returns the plaintext token and its hash
+func NewAPIKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// IsAPIKey 判断 Bearer 凭据是否为个人访问令牌
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidateAPIKeyScopes checks that every requested scope can be granted to a token
+// and returns them without duplicates
+func ValidateAPIKeyScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		allowed := false
+		for _, s := range APIKeyScopes {
+			if s == scope {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// authenticateAPIKey 校验个人访问令牌并返回对应用户的身份，角色以用户当前角色为准
+func authenticateAPIKey(ctx context.Context, token string) (UserClaims, error) {
+	repo := db.NewAPIKeyRepository()
+	key, err := repo.GetAPIKeyByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			return UserClaims{}, ErrInvalidAPIKey
+		}
+		return UserClaims{}, err
+	}
+
+	user, err := db.NewUserRepository().GetUserByEmail(ctx, key.UserEmail)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return UserClaims{}, ErrInvalidAPIKey
+		}
+		return UserClaims{}, err
+	}
+	if user.Disabled {
+		return UserClaims{}, ErrInvalidAPIKey
+	}
+
+	if err := repo.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("Failed to update last used time of api key %s: %v", key.ID, err)
+	}
+
+	return UserClaims{
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.EffectiveRole(),
+		Scopes:   key.Scopes,
+		APIKeyID: key.ID,
+	}, nil
+}
+
+// ListAPIKeysHandler 列出当前用户的个人访问令牌，不返回令牌明文
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := db.NewAPIKeyRepository().ListAPIKeys(r.Context(), claims.Email)
+	if err != nil {
+		log.Printf("Error listing api keys for %s: %v", claims.Email, err)
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// CreateAPIKeyHandler creates a personal access token. The plaintext token is only returned once.
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		http.Error(w, "name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+		http.Error(w, "expires_in_days must be between 0 and 365", http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := ValidateAPIKeyScopes(req.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 令牌的权限不能超过用户角色本身的权限
+	for _, scope := range scopes {
+		if !RoleHasPermission(claims.EffectiveRole(), scope) {
+			http.Error(w, fmt.Sprintf("Your role does not allow scope %s", scope), http.StatusForbidden)
+			return
+		}
+	}
+
+	repo := db.NewAPIKeyRepository()
+	count, err := repo.CountAPIKeys(r.Context(), claims.Email)
+	if err != nil {
+		log.Printf("Error counting api keys for %s: %v", claims.Email, err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAPIKeysPerUser {
+		http.Error(w, fmt.Sprintf("You can have at most %d API keys", maxAPIKeysPerUser), http.StatusConflict)
+		return
+	}
+
+	token, tokenHash, err := NewAPIKey()
+	if err != nil {
+		log.Printf("Error generating api key: %v", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	key := &models.APIKey{
+		UserEmail: claims.Email,
+		Name:      req.Name,
+		Prefix:    token[:len(APIKeyPrefix)+6],
+		KeyHash:   tokenHash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	// expires_in_days 为 0 表示永不过期
+	if req.ExpiresInDays > 0 {
+		expiresAt := key.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := repo.CreateAPIKey(r.Context(), key); err != nil {
+		log.Printf("Error saving api key for %s: %v", claims.Email, err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Created api key %s (%s) for user %s", key.ID, key.Name, claims.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":   key,
+		"token": token,
+	})
+}
+
+// DeleteAPIKeyHandler 撤销当前用户的个人访问令牌
+func DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keyID := mux.Vars(r)["id"]
+	if err := db.NewAPIKeyRepository().DeleteAPIKey(r.Context(), claims.Email, keyID); err != nil {
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting api key %s: %v", keyID, err)
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Deleted api key %s for user %s", keyID, claims.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "API key deleted successfully",
+	})
+}
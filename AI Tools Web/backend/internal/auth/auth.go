@@ -7,6 +7,10 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -30,7 +34,13 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Attempting to register user: %+v", user)
+	log.Printf("Attempting to register user: %s (%s)", user.Username, user.Email)
+
+	if user.Username == "" || user.Email == "" || user.Password == "" {
+		log.Printf("Registration rejected: missing username, email or password")
+		http.Error(w, "Username, email and password are required", http.StatusBadRequest)
+		return
+	}
 
 	collection := db.GetCollection(db.UserCollection)
 
@@ -47,6 +57,23 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 存储前对密码进行哈希
+	hashedPassword, err := HashPassword(user.Password)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		http.Error(w, "Error registering user", http.StatusInternalServerError)
+		return
+	}
+	user.Password = hashedPassword
+	// ID 由数据库生成，客户端传入的 id 会产生与已有账户 ObjectID 同值的字符串 _id
+	user.ID = ""
+	// 注册用户一律为普通角色，管理员通过 ADMIN_EMAILS（邮箱验证后）或管理接口授予
+	user.Role = models.RoleUser
+	user.Disabled = false
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
+	user.CreatedAt = time.Now()
+
 	// insert new user
 	result, err := collection.InsertOne(context.TODO(), user)
 	if err != nil {
@@ -57,6 +84,9 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Successfully registered user with ID: %v", result.InsertedID)
 
+	// 发送邮箱验证链接
+	sendVerificationEmailAsync(user)
+
 	w.WriteHeader(http.StatusCreated)
 	w.Write([]byte("User registered successfully"))
 }
@@ -82,16 +112,33 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 暴力破解防护：检查账户和来源 IP 的失败记录
+	policy := LockoutPolicyFromEnv()
+	ip := clientIP(r)
+	block, err := checkLoginAllowed(r.Context(), policy, credentials.Email, ip)
+	if err != nil {
+		log.Printf("Error checking login attempts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		log.Printf("Login blocked for email %s from %s (locked: %v)", credentials.Email, ip, block.Locked)
+		writeLoginBlock(w, block)
+		return
+	}
+
 	collection := db.GetCollection(db.UserCollection)
 
 	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{
-		"email":    credentials.Email,
-		"password": credentials.Password,
+	err = collection.FindOne(context.TODO(), bson.M{
+		"email": credentials.Email,
 	}).Decode(&user)
 
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
+			// 即使用户不存在也执行一次哈希比较，避免通过响应时间枚举邮箱
+			CheckPassword(dummyPasswordHash(), credentials.Password)
+			recordLoginFailure(r.Context(), policy, credentials.Email, ip)
 			log.Printf("Login failed: invalid credentials for email: %s", credentials.Email)
 			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 			return
@@ -100,21 +147,44 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	token, err := GenerateToken(user.Username, user.Email)
-	if err != nil {
-		log.Printf("Error generating token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+
+	ok, needsRehash := CheckPassword(user.Password, credentials.Password)
+	if !ok {
+		recordLoginFailure(r.Context(), policy, credentials.Email, ip)
+		log.Printf("Login failed: invalid credentials for email: %s", credentials.Email)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
-	// logs Login successful(terminal)
-	log.Printf("User logged in successfully: %s", user.Email)
-	log.Printf("User %s logged in with JWT token: %s", user.Email, token)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message":  "Login successful",
-		"username": user.Username,
-		"token":    token,
-	})
+
+	clearLoginFailures(r.Context(), credentials.Email)
+
+	// 旧的明文密码在首次成功登录时迁移为哈希
+	if needsRehash {
+		if err := rehashPassword(context.TODO(), user.Email, user.Password, credentials.Password); err != nil {
+			// 迁移失败不影响本次登录，下次登录会再次尝试
+			log.Printf("Failed to rehash password for user %s: %v", user.Email, err)
+		} else {
+			log.Printf("Password rehashed for user: %s", user.Email)
+		}
+	}
+	if user.Disabled {
+		log.Printf("Login rejected: account disabled for email: %s", user.Email)
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+	if verificationPending(&user) {
+		log.Printf("Login rejected: email not verified for: %s", user.Email)
+		http.Error(w, "Email address is not verified", http.StatusForbidden)
+		return
+	}
+
+	// 开启两步验证的账户需要再提交验证码才能获得令牌
+	if user.TOTPEnabled {
+		writeTwoFactorChallenge(w, &user)
+		return
+	}
+
+	writeLoginResponse(w, r, &user)
 }
 
 // ChangePasswordHandler handles password change requests
@@ -162,16 +232,27 @@ func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify old password
-	if dbUser.Password != passwordChange.OldPassword {
+	if ok, _ := CheckPassword(dbUser.Password, passwordChange.OldPassword); !ok {
 		log.Printf("Invalid old password for user: %s", user.Email)
 		http.Error(w, "Invalid old password", http.StatusUnauthorized)
 		return
 	}
 
+	hashedPassword, err := HashPassword(passwordChange.NewPassword)
+	if err != nil {
+		if err == ErrEmptyPassword {
+			http.Error(w, "New password cannot be empty", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to hash new password: %v", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
 	// Update password
 	update := bson.M{
 		"$set": bson.M{
-			"password": passwordChange.NewPassword,
+			"password": hashedPassword,
 		},
 	}
 
@@ -187,9 +268,79 @@ func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 修改密码后结束其他设备上的会话（例如机房的公用电脑），当前客户端换用新令牌
+	tokens, err := RestartUserSessions(r.Context(), &dbUser)
+	if err != nil {
+		log.Printf("Failed to restart sessions after password change for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	log.Printf("Password updated successfully for user: %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Password updated successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Password updated successfully",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash 返回用于用户不存在时等时比较的哈希
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy-password-for-timing")
+	})
+	return dummyHash
+}
+
+// rehashPassword replaces a legacy or outdated password value with a fresh hash.
+// The update is conditional on the old value so a concurrent password change is not overwritten.
+func rehashPassword(ctx context.Context, email, oldStored, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	collection := db.GetCollection(db.UserCollection)
+	_, err = collection.UpdateOne(ctx,
+		bson.M{"email": email, "password": oldStored},
+		bson.M{"$set": bson.M{"password": hashedPassword}},
+	)
+	return err
+}
+
+// promoteBootstrapAdmin ADMIN_EMAILS 中列出的账户在邮箱验证后首次登录时获得管理员角色。
+// 未验证的邮箱可能由他人抢先注册，不能授予；授予只进行一次，之后的角色修改不会在登录时被撤销。
+func promoteBootstrapAdmin(ctx context.Context, user *models.User) {
+	if !isBootstrapAdmin(user.Email) || !user.EmailVerified || user.AdminBootstrapped {
+		return
+	}
+	promoted, err := db.NewUserRepository().BootstrapAdmin(ctx, user.Email)
+	if err != nil {
+		log.Printf("Failed to promote bootstrap admin %s: %v", user.Email, err)
+		return
+	}
+	if promoted {
+		log.Printf("Promoted bootstrap admin: %s", user.Email)
+		user.Role = models.RoleAdmin
+		user.AdminBootstrapped = true
+	}
+}
+
+// isBootstrapAdmin 检查邮箱是否在 ADMIN_EMAILS 配置的管理员列表中
+func isBootstrapAdmin(email string) bool {
+	for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,20 +1,32 @@
 package auth
 
 import (
+	"backend/internal/config"
+	"backend/internal/models"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/joho/godotenv"
 )
 
-var jwtKey []byte
+const (
+	// 默认访问令牌有效期，较短以便泄露的令牌尽快失效
+	defaultAccessTokenTTL = 15 * time.Minute
+	// 默认刷新令牌有效期
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
 
 type UserClaims struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role,omitempty"`
+	// 通过个人访问令牌认证时，记录令牌 ID 和授予的权限范围
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
 	jwt.StandardClaims
 }
 
@@ -23,13 +35,6 @@ func init() {
 	if err := godotenv.Load(); err != nil {
 		fmt.Println("Warning: .env file not found, using default configuration")
 	}
-
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-	if secretKey == "" {
-		secretKey = "your_secret_key" // default secret key
-		fmt.Println("Warning: Use the default JWT secret key.")
-	}
-	jwtKey = []byte(secretKey)
 }
 
 type Claims struct {
@@ -38,22 +43,63 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
+// AccessTokenTTL 访问令牌有效期，可通过 JWT_ACCESS_TTL 配置
+func AccessTokenTTL() time.Duration {
+	return config.Duration("JWT_ACCESS_TTL", defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL 刷新令牌有效期，可通过 JWT_REFRESH_TTL 配置
+func RefreshTokenTTL() time.Duration {
+	return config.Duration("JWT_REFRESH_TTL", defaultRefreshTokenTTL)
+}
+
+// newTokenID 生成随机的令牌 ID (jti)
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GenerateToken issues a short-lived access token for a regular user
 func GenerateToken(username, email string) (string, error) {
+	return GenerateTokenWithRole(username, email, models.RoleUser)
+}
+
+// GenerateTokenWithRole issues a short-lived access token carrying the role and a unique jti
+func GenerateTokenWithRole(username, email, role string) (string, error) {
+	token, _, err := generateAccessToken(username, email, role)
+	return token, err
+}
+
+// generateAccessToken 签发访问令牌，同时返回它的 jti
+func generateAccessToken(username, email, role string) (string, string, error) {
+	if username == "" || email == "" {
+		return "", "", errors.New("username and email are required")
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"username": username,
 		"email":    email,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
+		"role":     role,
+		"jti":      jti,
+		"iat":      now.Unix(),
+		"exp":      now.Add(AccessTokenTTL()).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	token, err := signToken(claims)
+	return token, jti, err
 }
 
 func ValidateToken(tokenString string) (UserClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
+	token, err := parseToken(tokenString)
 	if err != nil {
 		return UserClaims{}, err
 	}
@@ -67,8 +113,35 @@ func ValidateToken(tokenString string) (UserClaims, error) {
 		return UserClaims{}, errors.New("invalid claims")
 	}
 
-	return UserClaims{
-		Username: claims["username"].(string),
-		Email:    claims["email"].(string),
-	}, nil
+	// 邮箱验证等一次性令牌不能作为访问令牌使用
+	if _, ok := claims["purpose"]; ok {
+		return UserClaims{}, errors.New("invalid claims")
+	}
+
+	username, _ := claims["username"].(string)
+	email, _ := claims["email"].(string)
+	if username == "" || email == "" {
+		return UserClaims{}, errors.New("invalid claims")
+	}
+
+	role, _ := claims["role"].(string)
+
+	userClaims := UserClaims{
+		Username: username,
+		Email:    email,
+		Role:     role,
+	}
+	// 没有 jti 的令牌无法被撤销，一律拒绝
+	userClaims.Id, _ = claims["jti"].(string)
+	if userClaims.Id == "" {
+		return UserClaims{}, errors.New("invalid claims")
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		userClaims.IssuedAt = int64(iat)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		userClaims.ExpiresAt = int64(exp)
+	}
+
+	return userClaims, nil
 }
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,7 +13,6 @@ import (
 
 func JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Request method: %v", r.Header.Get("Authorization"))
 		// 处理 OPTIONS 请求
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -20,21 +20,43 @@ func JWTMiddleware(next http.Handler) http.Handler {
 		}
 
 		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			// 浏览器的 WebSocket 无法设置请求头，令牌通过子协议传递
+			if token, ok := WebSocketToken(r); ok {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
 			http.Error(w, "Authorization header required", http.StatusUnauthorized)
 			return
 		}
 
 		bearerToken := strings.Split(authHeader, " ")
-		log.Printf("Bearer token: %v", bearerToken[1])
 		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
 			http.Error(w, "Invalid token format", http.StatusUnauthorized)
 			return
 		}
 
 		token := bearerToken[1]
+
+		// 个人访问令牌
+		if IsAPIKey(token) {
+			claims, err := authenticateAPIKey(r.Context(), token)
+			if err != nil {
+				if errors.Is(err, ErrInvalidAPIKey) {
+					http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				log.Printf("Error checking api key: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			ctx := context.WithValue(r.Context(), "user", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		claims, err := ValidateToken(token)
-		log.Printf("Claims: %v", claims)
 		if err != nil {
 			// 更详细的错误信息
 			if err.Error() == "Token is expired" {
@@ -49,13 +71,50 @@ func JWTMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// 检查令牌是否已通过登出或会话撤销失效
+		revoked, err := isTokenRevoked(r.Context(), claims)
+		if err != nil {
+			log.Printf("Error checking token revocation: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			log.Printf("Rejected revoked token %s for user %s", claims.Id, claims.Email)
+			http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
 		// 将用户信息存入上下文
 		ctx := context.WithValue(r.Context(), "user", claims)
-		log.Printf("Context: %v", ctx.Value("user"))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// WebSocketBearerProtocol WebSocket 客户端通过 Sec-WebSocket-Protocol: bearer, <token> 传递令牌
+const WebSocketBearerProtocol = "bearer"
+
+// WebSocketToken 从 WebSocket 握手请求的子协议中读取令牌
+func WebSocketToken(r *http.Request) (string, bool) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return "", false
+	}
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	if len(protocols) != 2 || strings.TrimSpace(protocols[0]) != WebSocketBearerProtocol {
+		return "", false
+	}
+	token := strings.TrimSpace(protocols[1])
+	return token, token != ""
+}
+
+// UserFromContext returns the claims JWTMiddleware stored in the request context
+func UserFromContext(ctx context.Context) (UserClaims, bool) {
+	claims, ok := ctx.Value("user").(UserClaims)
+	if !ok || claims.Email == "" {
+		return UserClaims{}, false
+	}
+	return claims, true
+}
+
 // GetUserFromRequest extracts user information from the JWT token in the request
 func GetUserFromRequest(r *http.Request) (*models.User, error) {
 	tokenString := r.Header.Get("Authorization")
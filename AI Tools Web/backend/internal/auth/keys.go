@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// RSA 密钥的最小长度
+const minRSAKeyBits = 2048
+
+// defaultSecrets 示例配置中的占位密钥，使用它们签名等于没有签名
+var defaultSecrets = map[string]bool{
+	"your_secret_key":          true,
+	"your_jwt_secret_key_here": true,
+}
+
+// PublicKeyPEM 一个 PEM 格式的验证公钥，KeyID 为空时使用公钥指纹
+type PublicKeyPEM struct {
+	KeyID string
+	PEM   []byte
+}
+
+// KeyConfig 令牌签名密钥的配置
+type KeyConfig struct {
+	// Algorithm 签发令牌使用的算法：HS256、RS256 或 EdDSA
+	Algorithm string
+	// Secret HS256 密钥。使用非对称算法时如果设置，仍然接受用它签名的令牌，便于从 HS256 平滑切换
+	Secret string
+	// PrivateKey 当前签名私钥 (PEM)，RS256 和 EdDSA 必须设置
+	PrivateKey []byte
+	// KeyID 当前签名密钥的 kid，为空时使用公钥的 RFC 7638 指纹
+	KeyID string
+	// VerificationKeys 轮换后仍然接受的旧公钥
+	VerificationKeys []PublicKeyPEM
+}
+
+// readPEMEnv 读取 <name>_FILE 指向的文件，或者直接读取 <name> 中的 PEM 内容（可用 \n 表示换行）
+func readPEMEnv(name string) ([]byte, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return os.ReadFile(path)
+	}
+	if value := os.Getenv(name); value != "" {
+		return []byte(strings.ReplaceAll(value, `\n`, "\n")), nil
+	}
+	return nil, nil
+}
+
+// KeyConfigFromEnv 从环境变量读取密钥配置：
+//
+//	JWT_SIGNING_ALG             HS256（默认）、RS256 或 EdDSA
+//	JWT_SECRET_KEY              HS256 密钥
+//	JWT_PRIVATE_KEY(_FILE)      RS256/EdDSA 签名私钥
+//	JWT_KEY_ID                  签名密钥的 kid
+//	JWT_VERIFICATION_KEY_FILES  逗号分隔的旧公钥文件，每项可写作 kid=path
+func KeyConfigFromEnv() (KeyConfig, error) {
+	cfg := KeyConfig{
+		Algorithm: os.Getenv("JWT_SIGNING_ALG"),
+		Secret:    os.Getenv("JWT_SECRET_KEY"),
+		KeyID:     os.Getenv("JWT_KEY_ID"),
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = AlgHS256
+	}
+
+	privateKey, err := readPEMEnv("JWT_PRIVATE_KEY")
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read JWT private key: %w", err)
+	}
+	cfg.PrivateKey = privateKey
+
+	for _, item := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kid, path := "", item
+		if i := strings.Index(item, "="); i >= 0 {
+			kid, path = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read JWT verification key %s: %w", path, err)
+		}
+		cfg.VerificationKeys = append(cfg.VerificationKeys, PublicKeyPEM{KeyID: kid, PEM: data})
+	}
+	return cfg, nil
+}
+
+// verificationKey 一个可用于验证签名的公钥
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+// KeySet 当前的签名密钥和所有可接受的验证密钥
+type KeySet struct {
+	method  jwt.SigningMethod
+	signKey interface{}
+	kid     string
+
+	// 按 kid 索引的公钥，包括当前签名密钥和轮换前的旧密钥
+	publicKeys map[string]verificationKey
+	// HS256 密钥，只用于没有 kid 的对称签名令牌
+	secret []byte
+}
+
+// NewKeySet 根据配置加载密钥，配置无效时返回错误
+func NewKeySet(cfg KeyConfig) (*KeySet, error) {
+	ks := &KeySet{publicKeys: make(map[string]verificationKey)}
+
+	if cfg.Secret != "" {
+		if defaultSecrets[cfg.Secret] {
+			return nil, errors.New("JWT_SECRET_KEY uses the example value, set a random secret")
+		}
+		ks.secret = []byte(cfg.Secret)
+	}
+
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if ks.secret == nil {
+			return nil, errors.New("JWT_SECRET_KEY is required for HS256 signing")
+		}
+		ks.method = jwt.SigningMethodHS256
+		ks.signKey = ks.secret
+
+	case AlgRS256, AlgEdDSA:
+		if len(cfg.PrivateKey) == 0 {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY or JWT_PRIVATE_KEY_FILE is required for %s signing", cfg.Algorithm)
+		}
+		signKey, public, err := parsePrivateKey(cfg.Algorithm, cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		kid := cfg.KeyID
+		if kid == "" {
+			kid = keyThumbprint(public)
+		}
+		ks.signKey = signKey
+		ks.kid = kid
+		ks.method = jwt.GetSigningMethod(cfg.Algorithm)
+		ks.publicKeys[kid] = verificationKey{alg: cfg.Algorithm, key: public}
+
+	default:
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q", cfg.Algorithm)
+	}
+
+	for _, item := range cfg.VerificationKeys {
+		alg, public, err := parsePublicKey(item.PEM)
+		if err != nil {
+			return nil, err
+		}
+		kid := item.KeyID
+		if kid == "" {
+			kid = keyThumbprint(public)
+		}
+		if _, exists := ks.publicKeys[kid]; !exists {
+			ks.publicKeys[kid] = verificationKey{alg: alg, key: public}
+		}
+	}
+	return ks, nil
+}
+
+// parsePrivateKey 解析签名私钥，并检查密钥类型与算法一致
+func parsePrivateKey(alg string, data []byte) (interface{}, interface{}, error) {
+	switch alg {
+	case AlgRS256:
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid RS256 private key: %w", err)
+		}
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, nil, fmt.Errorf("RS256 private key must be at least %d bits", minRSAKeyBits)
+		}
+		return key, &key.PublicKey, nil
+	case AlgEdDSA:
+		key, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid EdDSA private key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("EdDSA private key must be an Ed25519 key")
+		}
+		return edKey, edKey.Public(), nil
+	}
+	return nil, nil, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// parsePublicKey 解析 PEM 公钥，返回对应的签名算法
+func parsePublicKey(data []byte) (string, interface{}, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		if key.N.BitLen() < minRSAKeyBits {
+			return "", nil, fmt.Errorf("RS256 verification key must be at least %d bits", minRSAKeyBits)
+		}
+		return AlgRS256, key, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		if edKey, ok := key.(ed25519.PublicKey); ok {
+			return AlgEdDSA, edKey, nil
+		}
+	}
+	return "", nil, errors.New("JWT verification key must be an RSA or Ed25519 public key in PEM format")
+}
+
+// Sign 使用当前签名密钥签发令牌，非对称签名在头部写入 kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.method, claims)
+	if ks.kid != "" {
+		token.Header["kid"] = ks.kid
+	}
+	return token.SignedString(ks.signKey)
+}
+
+// Keyfunc 根据令牌头部选择验证密钥。HS256 令牌只能用对称密钥验证，
+// 非对称令牌必须带有已知的 kid 且算法与该公钥一致，防止算法混淆攻击。
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if ks.secret == nil || token.Method.Alg() != AlgHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ks.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// Parse 验证令牌签名并解析声明
+func (ks *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, ks.Keyfunc)
+}
+
+// JWKS 返回所有公钥的 JSON Web Key Set，供其他服务验证令牌。HS256 密钥不会公开。
+func (ks *KeySet) JWKS() map[string][]jsonWebKey {
+	kids := make([]string, 0, len(ks.publicKeys))
+	for kid := range ks.publicKeys {
+		kids = append(kids, kid)
+	}
+	// 当前签名密钥排在最前
+	sort.Slice(kids, func(i, j int) bool {
+		if (kids[i] == ks.kid) != (kids[j] == ks.kid) {
+			return kids[i] == ks.kid
+		}
+		return kids[i] < kids[j]
+	})
+
+	keys := make([]jsonWebKey, 0, len(kids))
+	for _, kid := range kids {
+		jwk := publicJWK(ks.publicKeys[kid].key)
+		jwk.Kid = kid
+		jwk.Use = "sig"
+		jwk.Alg = ks.publicKeys[kid].alg
+		keys = append(keys, jwk)
+	}
+	return map[string][]jsonWebKey{"keys": keys}
+}
+
+// publicJWK 将公钥转换为 JWK 的密钥参数
+func publicJWK(key interface{}) jsonWebKey {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jsonWebKey{Kty: "RSA", N: encode(k.N.Bytes()), E: encode(big.NewInt(int64(k.E)).Bytes())}
+	case ed25519.PublicKey:
+		return jsonWebKey{Kty: "OKP", Crv: "Ed25519", X: encode(k)}
+	}
+	return jsonWebKey{}
+}
+
+// keyThumbprint 计算公钥的 RFC 7638 指纹，作为默认 kid
+func keyThumbprint(key interface{}) string {
+	jwk := publicJWK(key)
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+var (
+	keySetOnce sync.Once
+	keySet     *KeySet
+	keySetErr  error
+)
+
+// currentKeySet 第一次使用时从环境变量加载密钥
+func currentKeySet() (*KeySet, error) {
+	keySetOnce.Do(func() {
+		cfg, err := KeyConfigFromEnv()
+		if err != nil {
+			keySetErr = err
+			return
+		}
+		keySet, keySetErr = NewKeySet(cfg)
+		if keySetErr == nil {
+			log.Printf("JWT signing algorithm: %s, %d public verification keys", cfg.Algorithm, len(keySet.publicKeys))
+		}
+	})
+	return keySet, keySetErr
+}
+
+// InitKeys loads the signing keys from the environment. The server calls it at
+// startup and refuses to start when the key configuration is missing or insecure.
+func InitKeys() error {
+	_, err := currentKeySet()
+	return err
+}
+
+// signToken 使用当前密钥签名
+func signToken(claims jwt.Claims) (string, error) {
+	ks, err := currentKeySet()
+	if err != nil {
+		return "", err
+	}
+	return ks.Sign(claims)
+}
+
+// parseToken 验证本服务签发的令牌
+func parseToken(tokenString string) (*jwt.Token, error) {
+	ks, err := currentKeySet()
+	if err != nil {
+		return nil, err
+	}
+	return ks.Parse(tokenString)
+}
+
+// JWKSHandler 公开令牌验证公钥 (/.well-known/jwks.json)
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	ks, err := currentKeySet()
+	if err != nil {
+		http.Error(w, "Signing keys are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(ks.JWKS())
+}
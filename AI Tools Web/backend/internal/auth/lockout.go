@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockoutPolicy 登录失败的限速和锁定策略
+type LockoutPolicy struct {
+	// 同一账户连续失败 MaxFailures 次后锁定 LockoutDuration
+	MaxFailures int
+	// 同一 IP 失败 IPMaxFailures 次后暂时拒绝该 IP 的登录请求
+	IPMaxFailures int
+	// 失败次数达到 DelayAfter 后，每次尝试前需要等待的时间按 BaseDelay 翻倍增长，最多 MaxDelay
+	DelayAfter int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	// 超过 FailureWindow 没有新的失败时重新计数
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+}
+
+// intFromEnv 读取正整数配置
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s %q, using default %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// LockoutPolicyFromEnv 从 LOGIN_* 环境变量读取策略
+func LockoutPolicyFromEnv() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures:     intFromEnv("LOGIN_MAX_FAILURES", 5),
+		IPMaxFailures:   intFromEnv("LOGIN_IP_MAX_FAILURES", 20),
+		DelayAfter:      intFromEnv("LOGIN_DELAY_AFTER", 3),
+		BaseDelay:       config.Duration("LOGIN_BASE_DELAY", time.Second),
+		MaxDelay:        config.Duration("LOGIN_MAX_DELAY", time.Minute),
+		FailureWindow:   config.Duration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LockoutDuration: config.Duration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+	}
+}
+
+// LoginBlock describes why a login attempt is refused and for how long
+type LoginBlock struct {
+	Locked     bool // true 表示账户被锁定 (423)，否则为限速 (429)
+	RetryAfter time.Duration
+}
+
+// CheckLoginAttempt decides whether a new attempt is allowed given the recorded
+// failures. It returns nil when the attempt may proceed.
+func (p LockoutPolicy) CheckLoginAttempt(attempt *models.LoginAttempt, maxFailures int, now time.Time) *LoginBlock {
+	if attempt == nil {
+		return nil
+	}
+
+	if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+		return &LoginBlock{Locked: true, RetryAfter: attempt.LockedUntil.Sub(now)}
+	}
+
+	// 超出计数窗口的旧失败不再计算
+	if now.Sub(attempt.LastFailureAt) > p.FailureWindow {
+		return nil
+	}
+
+	if attempt.Failures >= maxFailures && attempt.LockedUntil == nil {
+		// 达到上限但没有锁定时间的记录（例如 IP 记录），在窗口内一直限速
+		return &LoginBlock{RetryAfter: attempt.LastFailureAt.Add(p.FailureWindow).Sub(now)}
+	}
+
+	if delay := p.Delay(attempt.Failures); delay > 0 {
+		if wait := attempt.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+			return &LoginBlock{RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// Delay 返回失败 failures 次后下一次尝试前需要等待的时间
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures < p.DelayAfter {
+		return 0
+	}
+	exp := failures - p.DelayAfter
+	if exp > 30 {
+		return p.MaxDelay
+	}
+	delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(exp)))
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+// emailAttemptKey 和 ipAttemptKey 是 login_attempts 集合中的记录 ID
+func emailAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// clientIP 返回请求来源 IP；只有 TRUST_PROXY_HEADERS=true 时才信任 X-Forwarded-For
+func clientIP(r *http.Request) string {
+	if strings.EqualFold(os.Getenv("TRUST_PROXY_HEADERS"), "true") {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkLoginAllowed 检查账户和 IP 的失败记录，返回需要拒绝的原因
+func checkLoginAllowed(ctx context.Context, policy LockoutPolicy, email, ip string) (*LoginBlock, error) {
+	repo := db.NewLoginAttemptRepository()
+	now := time.Now()
+
+	ipAttempt, err := repo.GetAttempts(ctx, ipAttemptKey(ip))
+	if err != nil {
+		return nil, err
+	}
+	if block := policy.CheckLoginAttempt(ipAttempt, policy.IPMaxFailures, now); block != nil {
+		return block, nil
+	}
+
+	emailAttempt, err := repo.GetAttempts(ctx, emailAttemptKey(email))
+	if err != nil {
+		return nil, err
+	}
+	return policy.CheckLoginAttempt(emailAttempt, policy.MaxFailures, now), nil
+}
+
+// recordLoginFailure 记录一次失败的登录
+func recordLoginFailure(ctx context.Context, policy LockoutPolicy, email, ip string) {
+	repo := db.NewLoginAttemptRepository()
+
+	attempt, err := repo.RecordFailure(ctx, emailAttemptKey(email), policy.MaxFailures, policy.FailureWindow, policy.LockoutDuration)
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", email, err)
+	} else if attempt.LockedUntil != nil && attempt.Failures == policy.MaxFailures {
+		log.Printf("Account locked after %d failed logins: %s", attempt.Failures, email)
+	}
+
+	// IP 记录只限速不锁定，窗口过后自动恢复
+	if _, err := repo.RecordFailure(ctx, ipAttemptKey(ip), math.MaxInt32, policy.FailureWindow, 0); err != nil {
+		log.Printf("Failed to record login failure for IP %s: %v", ip, err)
+	}
+}
+
+// clearLoginFailures 登录成功后清除账户的失败记录。IP 记录不清除，避免攻击者用自己的账户重置计数。
+func clearLoginFailures(ctx context.Context, email string) {
+	if _, err := db.NewLoginAttemptRepository().ClearAttempts(ctx, emailAttemptKey(email)); err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", email, err)
+	}
+}
+
+// UnlockAccount 管理员解除账户锁定
+func UnlockAccount(ctx context.Context, email string) (bool, error) {
+	return db.NewLoginAttemptRepository().ClearAttempts(ctx, emailAttemptKey(email))
+}
+
+// writeLoginBlock 返回 423 (账户锁定) 或 429 (请求过于频繁) 并设置 Retry-After
+func writeLoginBlock(w http.ResponseWriter, block *LoginBlock) {
+	seconds := int(math.Ceil(block.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	if block.Locked {
+		http.Error(w, fmt.Sprintf("Account is temporarily locked due to too many failed login attempts. Try again in %d seconds.", seconds), http.StatusLocked)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Too many failed login attempts. Try again in %d seconds.", seconds), http.StatusTooManyRequests)
+}
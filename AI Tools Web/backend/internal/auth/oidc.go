@@ -0,0 +1,423 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// OIDCConfig 单点登录身份提供方配置
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	ProviderName string
+}
+
+// OIDCConfigFromEnv reads the provider settings from OIDC_* environment variables
+func OIDCConfigFromEnv() OIDCConfig {
+	scopes := strings.Fields(os.Getenv("OIDC_SCOPES"))
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	providerName := os.Getenv("OIDC_PROVIDER_NAME")
+	if providerName == "" {
+		providerName = "Campus Account"
+	}
+
+	return OIDCConfig{
+		IssuerURL:    strings.TrimSuffix(os.Getenv("OIDC_ISSUER_URL"), "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+		ProviderName: providerName,
+	}
+}
+
+// Enabled 是否配置了单点登录
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != "" && c.RedirectURL != ""
+}
+
+// oidcDiscovery 发现文档中用到的字段
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// jsonWebKey JWKS 中的单个公钥
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// OIDCIdentity 从 ID 令牌中取得的用户身份
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// OIDCProvider performs the authorization-code + PKCE flow against one identity provider
+type OIDCProvider struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+	keysAt    time.Time
+}
+
+// NewOIDCProvider 创建身份提供方客户端，发现文档在首次使用时加载
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Config 返回提供方配置
+func (p *OIDCProvider) Config() OIDCConfig {
+	return p.config
+}
+
+// getJSON 请求 URL 并解析 JSON 响应
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GET %s failed (status %d): %s", endpoint, resp.StatusCode, string(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// loadDiscovery 加载并缓存 /.well-known/openid-configuration
+func (p *OIDCProvider) loadDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc oidcDiscovery
+	if err := p.getJSON(ctx, p.config.IssuerURL+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC discovery document: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.config.IssuerURL {
+		return nil, fmt.Errorf("OIDC issuer mismatch: configured %s, provider reports %s", p.config.IssuerURL, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing required endpoints")
+	}
+
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// NewPKCEVerifier 生成 PKCE code_verifier
+func NewPKCEVerifier() (string, error) {
+	return randomURLToken(32)
+}
+
+// PKCEChallenge 计算 S256 code_challenge
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomURLToken 生成 URL 安全的随机字符串
+func randomURLToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL builds the provider's authorization URL for the given state, nonce and PKCE verifier
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	doc, err := p.loadDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code and returns the verified identity from the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	doc, err := p.loadDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, errors.New("token response did not include an id_token")
+	}
+
+	return p.VerifyIDToken(ctx, tokenResp.IDToken, nonce)
+}
+
+// VerifyIDToken checks the ID token signature against the provider's JWKS and
+// validates issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*OIDCIdentity, error) {
+	token, err := jwt.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected ID token signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.verificationKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid ID token claims")
+	}
+
+	if !claims.VerifyIssuer(p.config.IssuerURL, true) {
+		return nil, errors.New("ID token issuer mismatch")
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("ID token is expired")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); nonce == "" || tokenNonce != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+
+	identity := &OIDCIdentity{Issuer: p.config.IssuerURL}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	identity.PreferredUsername, _ = claims["preferred_username"].(string)
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		identity.EmailVerified = v == "true"
+	}
+
+	if identity.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	return identity, nil
+}
+
+// verificationKey 根据 kid 从 JWKS 获取公钥，遇到未知 kid 时重新加载一次以支持提供方轮换密钥
+func (p *OIDCProvider) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	doc, err := p.loadDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	// 限制刷新频率，避免伪造的 kid 导致频繁请求
+	if time.Since(p.keysAt) < 10*time.Second && p.keys != nil {
+		return nil, fmt.Errorf("unknown ID token key %q", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, doc.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown ID token key %q", kid)
+}
+
+// lookupKey 查找缓存的公钥；令牌未指定 kid 且只有一个密钥时使用该密钥
+func (p *OIDCProvider) lookupKey(kid string) interface{} {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// publicKey 将 JWK 转换为 RSA、ECDSA 或 Ed25519 公钥
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"backend/internal/db"
+	"backend/internal/models"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 授权请求的有效期，超时后回调会被拒绝
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie 保存 state 哈希的 Cookie，把回调绑定到发起登录的浏览器
+const oidcStateCookie = "oidc_state"
+
+var (
+	oidcProviderOnce sync.Once
+	oidcProvider     *OIDCProvider
+)
+
+// errOIDCEmailUnverified 外部身份的邮箱未验证，不能关联到已有账户
+var errOIDCEmailUnverified = errors.New("email not verified by identity provider")
+
+// getOIDCProvider 返回由环境变量配置的身份提供方，未配置时返回 nil
+func getOIDCProvider() *OIDCProvider {
+	oidcProviderOnce.Do(func() {
+		config := OIDCConfigFromEnv()
+		if config.Enabled() {
+			oidcProvider = NewOIDCProvider(config)
+			log.Printf("OIDC login enabled with issuer %s", config.IssuerURL)
+		}
+	})
+	return oidcProvider
+}
+
+// oidcFrontendRedirect 登录完成后前端接收令牌的地址
+func oidcFrontendRedirect() string {
+	if u := os.Getenv("OIDC_FRONTEND_REDIRECT_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:3000/login"
+}
+
+// redirectToFrontend 通过 URL 片段把结果交给前端，片段不会发送到服务器或写入访问日志
+func redirectToFrontend(w http.ResponseWriter, r *http.Request, values url.Values) {
+	http.Redirect(w, r, oidcFrontendRedirect()+"#"+values.Encode(), http.StatusFound)
+}
+
+// setOIDCStateCookie 记录本浏览器发起的授权请求。身份提供方的回调是顶层 GET 跳转，SameSite=Lax 的 Cookie 会被带上。
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// stateMatchesCookie 检查回调中的 state 是否由本浏览器发起，防止把他人的回调链接发给受害者完成登录 (login CSRF)
+func stateMatchesCookie(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashToken(state))) == 1
+}
+
+// OIDCConfigHandler tells the frontend whether single sign-on is available
+func OIDCConfigHandler(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{"enabled": false}
+	if provider := getOIDCProvider(); provider != nil {
+		response["enabled"] = true
+		response["provider_name"] = provider.Config().ProviderName
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// OIDCLoginHandler starts the authorization-code flow and redirects the browser to the identity provider
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := randomURLToken(32)
+	if err != nil {
+		log.Printf("Error generating OIDC state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomURLToken(32)
+	if err != nil {
+		log.Printf("Error generating OIDC nonce: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		log.Printf("Error generating PKCE verifier: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("Error building OIDC authorization URL: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	err = db.NewOIDCStateRepository().SaveState(r.Context(), &models.OIDCState{
+		ID:           hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	})
+	if err != nil {
+		log.Printf("Error saving OIDC state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	setOIDCStateCookie(w, r, hashToken(state), int(oidcStateTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler completes the flow: it redeems the code, verifies the ID token,
+// finds or creates the local user and hands the app tokens to the frontend
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Printf("OIDC provider returned error: %s (%s)", providerErr, query.Get("error_description"))
+		redirectToFrontend(w, r, url.Values{"error": {"sso_denied"}})
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "Missing code or state", http.StatusBadRequest)
+		return
+	}
+
+	if !stateMatchesCookie(r, state) {
+		log.Printf("OIDC callback state does not match the browser that started the login")
+		redirectToFrontend(w, r, url.Values{"error": {"sso_expired"}})
+		return
+	}
+	// state 只能使用一次，Cookie 随之清除
+	setOIDCStateCookie(w, r, "", -1)
+
+	stored, err := db.NewOIDCStateRepository().ConsumeState(r.Context(), hashToken(state))
+	if err != nil {
+		if errors.Is(err, db.ErrOIDCStateNotFound) {
+			log.Printf("OIDC callback with unknown or expired state")
+			redirectToFrontend(w, r, url.Values{"error": {"sso_expired"}})
+			return
+		}
+		log.Printf("Error loading OIDC state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		redirectToFrontend(w, r, url.Values{"error": {"sso_failed"}})
+		return
+	}
+
+	user, err := findOrCreateOIDCUser(r.Context(), identity)
+	if err != nil {
+		log.Printf("OIDC login failed for subject %s: %v", identity.Subject, err)
+		reason := "sso_failed"
+		if errors.Is(err, errOIDCEmailUnverified) {
+			reason = "email_unverified"
+		}
+		redirectToFrontend(w, r, url.Values{"error": {reason}})
+		return
+	}
+
+	if user.Disabled {
+		log.Printf("OIDC login rejected: account disabled for email: %s", user.Email)
+		redirectToFrontend(w, r, url.Values{"error": {"account_disabled"}})
+		return
+	}
+
+	if verificationPending(user) {
+		log.Printf("OIDC login rejected: email not verified for: %s", user.Email)
+		redirectToFrontend(w, r, url.Values{"error": {"verification_pending"}})
+		return
+	}
+
+	// 单点登录只替代密码，开启两步验证的账户仍需在前端提交验证码
+	if user.TOTPEnabled {
+		challenge, _, err := newTwoFactorChallenge(user)
+		if err != nil {
+			log.Printf("Error generating 2FA challenge: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("OIDC login accepted, two-factor code required for: %s", user.Email)
+		redirectToFrontend(w, r, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challenge},
+		})
+		return
+	}
+
+	promoteBootstrapAdmin(r.Context(), user)
+
+	tokens, err := IssueTokens(r.Context(), user)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User logged in via OIDC: %s", user.Email)
+	redirectToFrontend(w, r, url.Values{
+		"token":         {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"username":      {user.Username},
+		"role":          {user.EffectiveRole()},
+	})
+}
+
+// findOrCreateOIDCUser 按外部身份查找用户；首次登录时按已验证邮箱关联已有账户，否则创建新账户
+func findOrCreateOIDCUser(ctx context.Context, identity *OIDCIdentity) (*models.User, error) {
+	repo := db.NewUserRepository()
+
+	user, err := repo.GetUserByOIDC(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		return nil, err
+	}
+
+	// 应用内以邮箱标识用户，没有邮箱无法登录
+	if identity.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+
+	user, err = repo.GetUserByEmail(ctx, identity.Email)
+	if err == nil {
+		// 未验证的邮箱可能被他人冒用，不能据此接管已有账户
+		if !identity.EmailVerified {
+			return nil, errOIDCEmailUnverified
+		}
+		if err := repo.LinkOIDCIdentity(ctx, user.ID, identity.Issuer, identity.Subject); err != nil {
+			if errors.Is(err, db.ErrUserNotFound) {
+				return nil, fmt.Errorf("account %s is already linked to another identity", user.Email)
+			}
+			return nil, err
+		}
+		log.Printf("Linked OIDC identity to existing user: %s", user.Email)
+		user.OIDCIssuer, user.OIDCSubject = identity.Issuer, identity.Subject
+		if !user.EmailVerified {
+			if err := repo.MarkEmailVerified(ctx, user.Email); err != nil {
+				log.Printf("Failed to mark email verified for %s: %v", user.Email, err)
+			} else {
+				user.EmailVerified = true
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		return nil, err
+	}
+
+	username, err := uniqueUsername(ctx, repo, oidcUsername(identity))
+	if err != nil {
+		return nil, err
+	}
+
+	// 单点登录账户没有本地密码，CheckPassword 对空密码始终返回 false
+	user = &models.User{
+		Username:      username,
+		Email:         identity.Email,
+		Role:          models.RoleUser,
+		CreatedAt:     time.Now(),
+		EmailVerified: identity.EmailVerified,
+		OIDCIssuer:    identity.Issuer,
+		OIDCSubject:   identity.Subject,
+	}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	log.Printf("Created user from OIDC login: %s (%s)", user.Username, user.Email)
+	return user, nil
+}
+
+// oidcUsername 从外部身份中选择用户名
+func oidcUsername(identity *OIDCIdentity) string {
+	for _, candidate := range []string{identity.PreferredUsername, identity.Name, strings.Split(identity.Email, "@")[0]} {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			return candidate
+		}
+	}
+	return "user"
+}
+
+// uniqueUsername 用户名已存在时追加数字后缀
+func uniqueUsername(ctx context.Context, repo *db.UserRepository, base string) (string, error) {
+	candidate := base
+	for i := 2; i < 100; i++ {
+		exists, err := repo.UsernameExists(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", fmt.Errorf("could not find a free username for %s", base)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrEmptyPassword 密码为空
+var ErrEmptyPassword = errors.New("password must not be empty")
+
+// passwordCost returns the bcrypt cost configured by BCRYPT_COST,
+// falling back to bcrypt.DefaultCost when unset or out of range.
+func passwordCost() int {
+	value := os.Getenv("BCRYPT_COST")
+	if value == "" {
+		return bcrypt.DefaultCost
+	}
+
+	cost, err := strconv.Atoi(value)
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		log.Printf("Invalid BCRYPT_COST %q, using default cost %d", value, bcrypt.DefaultCost)
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// HashPassword hashes a plaintext password with bcrypt
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost())
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// IsPasswordHash reports whether the stored value is a bcrypt hash rather than
+// a legacy plaintext password
+func IsPasswordHash(stored string) bool {
+	if !strings.HasPrefix(stored, "$2") {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// CheckPassword compares a plaintext password with the stored value.
+// The second return value is true when the stored value should be replaced
+// with a fresh hash: it is legacy plaintext, or it was hashed with a different cost.
+func CheckPassword(stored, password string) (bool, bool) {
+	if stored == "" || password == "" {
+		return false, false
+	}
+
+	if !IsPasswordHash(stored) {
+		// 旧账户的明文密码，使用常量时间比较
+		ok := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost != passwordCost()
+}
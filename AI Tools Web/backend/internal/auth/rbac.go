@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"backend/internal/models"
+	"log"
+	"net/http"
+)
+
+// 权限定义
+const (
+	PermChatRead    = "chat:read"
+	PermChatWrite   = "chat:write"
+	PermRAGQuery    = "rag:query"
+	PermRAGUpload   = "rag:upload"
+	PermRAGAdmin    = "rag:admin"
+	PermAccount     = "account:manage"
+	PermManageUsers = "admin:users"
+)
+
+// rolePermissions 每个角色拥有的权限
+var rolePermissions = map[string][]string{
+	models.RoleReadOnly: {
+		PermChatRead,
+		PermRAGQuery,
+		PermAccount,
+	},
+	models.RoleUser: {
+		PermChatRead,
+		PermChatWrite,
+		PermRAGQuery,
+		PermRAGUpload,
+		PermAccount,
+	},
+	models.RoleAdmin: {
+		PermChatRead,
+		PermChatWrite,
+		PermRAGQuery,
+		PermRAGUpload,
+		PermRAGAdmin,
+		PermAccount,
+		PermManageUsers,
+	},
+}
+
+// RoleHasPermission 检查角色是否拥有指定权限
+func RoleHasPermission(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission 检查令牌中的用户是否拥有指定权限。
+// 个人访问令牌同时受用户角色和令牌权限范围限制。
+func (c UserClaims) HasPermission(permission string) bool {
+	if !RoleHasPermission(c.EffectiveRole(), permission) {
+		return false
+	}
+	if c.APIKeyID == "" {
+		return true
+	}
+	for _, scope := range c.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveRole 返回令牌中的角色，未携带角色的令牌视为普通用户
+func (c UserClaims) EffectiveRole() string {
+	if c.Role == "" {
+		return models.RoleUser
+	}
+	return c.Role
+}
+
+// RequirePermission returns a middleware that only lets requests through when the
+// authenticated user has the permission. It must run after JWTMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			claims, ok := UserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !claims.HasPermission(permission) {
+				log.Printf("Permission %s denied for user %s (role %s)", permission, claims.Email, claims.EffectiveRole())
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithPermission wraps a single handler with RequirePermission
+func WithPermission(permission string, handler http.HandlerFunc) http.Handler {
+	return RequirePermission(permission)(handler)
+}
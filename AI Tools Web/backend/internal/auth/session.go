@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"backend/internal/db"
+	"backend/internal/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenPair 登录或刷新后返回给客户端的令牌
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	// accessTokenID 访问令牌的 jti
+	accessTokenID string
+}
+
+// newRefreshToken 生成随机刷新令牌，返回明文和用于存储的哈希
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken 计算令牌的 SHA-256 哈希，数据库只保存哈希
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokenPair 签发访问令牌和属于 familyID 会话的刷新令牌。
+// rotatedFrom 不为空时，同时将该旧刷新令牌标记为已轮换。
+func issueTokenPair(ctx context.Context, user *models.User, familyID, rotatedFrom string) (*TokenPair, error) {
+	accessToken, jti, err := generateAccessToken(user.Username, user.Email, user.EffectiveRole())
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = newTokenID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	record := &models.RefreshToken{
+		ID:        refreshHash,
+		UserEmail: user.Email,
+		Username:  user.Username,
+		FamilyID:  familyID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL()),
+	}
+
+	repo := db.NewTokenRepository()
+	if rotatedFrom != "" {
+		err = repo.RotateRefreshToken(ctx, rotatedFrom, record)
+	} else {
+		err = repo.SaveRefreshToken(ctx, record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		TokenType:     "Bearer",
+		ExpiresIn:     int64(AccessTokenTTL().Seconds()),
+		accessTokenID: jti,
+	}, nil
+}
+
+// IssueTokens starts a new session for the user and returns its access and refresh tokens
+func IssueTokens(ctx context.Context, user *models.User) (*TokenPair, error) {
+	return issueTokenPair(ctx, user, "", "")
+}
+
+// RevokeUserSessions 撤销用户的全部刷新令牌和已签发的访问令牌
+func RevokeUserSessions(ctx context.Context, email string) error {
+	repo := db.NewTokenRepository()
+	if err := repo.RevokeUserRefreshTokens(ctx, email); err != nil {
+		return err
+	}
+	return repo.RevokeUserAccessTokens(ctx, email, AccessTokenTTL(), "")
+}
+
+// RestartUserSessions 撤销用户的全部会话，并为当前客户端签发新的令牌。
+// 新的访问令牌与撤销可能在同一秒内，按 jti 明确排除在撤销之外。
+func RestartUserSessions(ctx context.Context, user *models.User) (*TokenPair, error) {
+	repo := db.NewTokenRepository()
+	if err := repo.RevokeUserRefreshTokens(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	tokens, err := IssueTokens(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.RevokeUserAccessTokens(ctx, user.Email, AccessTokenTTL(), tokens.accessTokenID); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// isTokenRevoked 检查访问令牌是否已通过登出或会话撤销失效
+func isTokenRevoked(ctx context.Context, claims UserClaims) (bool, error) {
+	return db.NewTokenRepository().IsAccessTokenRevoked(ctx, claims.Id, claims.Email, time.Unix(claims.IssuedAt, 0))
+}
+
+// RefreshHandler exchanges a refresh token for a new token pair.
+// Each refresh token can only be used once; presenting a used token revokes the whole session.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewTokenRepository()
+	tokenHash := hashToken(req.RefreshToken)
+
+	stored, err := repo.GetRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, db.ErrRefreshTokenNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error loading refresh token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if stored.RevokedAt != nil {
+		// 已轮换或已撤销的令牌再次出现，说明令牌可能被盗用，撤销整个会话
+		log.Printf("Refresh token reuse detected for user %s, revoking session %s", stored.UserEmail, stored.FamilyID)
+		if err := repo.RevokeTokenFamily(r.Context(), stored.FamilyID); err != nil {
+			log.Printf("Error revoking token family: %v", err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// 每次刷新都重新读取用户，使角色变更和禁用立即生效
+	user, err := db.NewUserRepository().GetUserByEmail(r.Context(), stored.UserEmail)
+	if err != nil || user.Disabled {
+		if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+			log.Printf("Error loading user for refresh: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := repo.RevokeTokenFamily(r.Context(), stored.FamilyID); err != nil {
+			log.Printf("Error revoking token family: %v", err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	pair, err := issueTokenPair(r.Context(), user, stored.FamilyID, tokenHash)
+	if err != nil {
+		if errors.Is(err, db.ErrRefreshTokenReused) {
+			// 并发刷新时另一个请求已经使用了该令牌
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error issuing tokens: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// LogoutHandler ends the session identified by the refresh token and revokes the
+// current access token. With "all": true every session of the user is ended.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	// 请求体可以为空，仅撤销访问令牌
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	repo := db.NewTokenRepository()
+	ctx := r.Context()
+
+	// 访问令牌可能已过期，因此登出不要求有效的访问令牌
+	var claims *UserClaims
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		if c, err := ValidateToken(strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+			claims = &c
+		}
+	}
+
+	if req.RefreshToken != "" {
+		stored, err := repo.GetRefreshToken(ctx, hashToken(req.RefreshToken))
+		if err == nil {
+			if err := repo.RevokeTokenFamily(ctx, stored.FamilyID); err != nil {
+				log.Printf("Error revoking refresh token: %v", err)
+				http.Error(w, "Failed to logout", http.StatusInternalServerError)
+				return
+			}
+		} else if !errors.Is(err, db.ErrRefreshTokenNotFound) {
+			log.Printf("Error loading refresh token: %v", err)
+			http.Error(w, "Failed to logout", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if claims != nil {
+		if req.All {
+			if err := RevokeUserSessions(ctx, claims.Email); err != nil {
+				log.Printf("Error revoking sessions for %s: %v", claims.Email, err)
+				http.Error(w, "Failed to logout", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := repo.RevokeAccessToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			log.Printf("Error revoking access token: %v", err)
+			http.Error(w, "Failed to logout", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User logged out: %s", claims.Email)
+	} else if req.All {
+		http.Error(w, "A valid access token is required to end all sessions", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logout successful",
+	})
+}
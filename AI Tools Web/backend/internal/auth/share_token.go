@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// ShareTokenPrefix 聊天分享令牌的前缀
+const ShareTokenPrefix = "zsh_"
+
+// NewShareToken generates a chat share token and returns the plaintext token and its hash
+func NewShareToken() (string, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := ShareTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// HashShareToken 返回分享令牌的哈希，用于查找分享
+func HashShareToken(token string) string {
+	return hashToken(token)
+}
+
+// ShareURL 分享链接指向的前端页面
+func ShareURL(token string) string {
+	return appBaseURL() + "/share/" + token
+}
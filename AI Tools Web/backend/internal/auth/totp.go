@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP 参数 (RFC 6238)：HMAC-SHA1，6 位数字，30 秒时间步长
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// 允许前后各一个时间步长的时钟偏差
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成 160 位随机密钥，返回 Base32 编码
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// decodeTOTPSecret 解码 Base32 密钥，兼容小写和带填充的输入
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, errors.New("invalid TOTP secret")
+	}
+	return key, nil
+}
+
+// HOTP computes an RFC 4226 one-time password for the counter value
+func HOTP(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// totpStep 返回时间对应的时间步
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode returns the current 6-digit code for a Base32 secret
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return HOTP(key, uint64(totpStep(t)), totpDigits), nil
+}
+
+// ValidateTOTP checks a code against the secret, allowing one step of clock skew.
+// Codes from time steps at or before lastStep are rejected so a code cannot be replayed.
+// On success it returns the matched time step, which the caller stores as the new lastStep.
+func ValidateTOTP(secret, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := totpStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected := HOTP(key, uint64(step), totpDigits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPProvisioningURI 生成认证器应用扫描的 otpauth:// 地址
+func TOTPProvisioningURI(secret, issuer, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// GenerateRecoveryCodes 生成一次性恢复码，返回明文（只展示一次）和存储用的哈希
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 规范化恢复码后计算哈希，输入时忽略大小写和连字符
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	return hashToken(normalized)
+}
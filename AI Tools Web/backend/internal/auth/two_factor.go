@@ -0,0 +1,425 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// PurposeLogin2FA 密码验证通过后、两步验证完成前使用的挑战令牌
+const PurposeLogin2FA = "login_2fa"
+
+// 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// Login2FATTL 两步验证挑战令牌有效期，可通过 LOGIN_2FA_TTL 配置
+func Login2FATTL() time.Duration {
+	return config.Duration("LOGIN_2FA_TTL", 5*time.Minute)
+}
+
+// totpIssuer 认证器应用中显示的服务名称
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "AI Tools Web"
+}
+
+// loadCurrentUser 从数据库读取当前登录用户
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	user, err := db.NewUserRepository().GetUserByEmail(r.Context(), claims.Email)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Error loading user %s: %v", claims.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// verifySecondFactor 校验 TOTP 验证码或一次性恢复码
+func verifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) (bool, error) {
+	repo := db.NewUserRepository()
+
+	if code != "" {
+		step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		// 并发请求使用同一验证码时只有一个能成功
+		return repo.AdvanceTOTPStep(ctx, user.Email, step)
+	}
+
+	if recoveryCode != "" {
+		used, err := repo.ConsumeRecoveryCode(ctx, user.Email, hashRecoveryCode(recoveryCode))
+		if used {
+			log.Printf("Recovery code used by %s", user.Email)
+		}
+		return used, err
+	}
+	return false, nil
+}
+
+// ConfirmIdentity 敏感操作前重新验证身份：有本地密码的账户需要密码，
+// 开启两步验证的账户还需要验证码或恢复码
+func ConfirmIdentity(ctx context.Context, user *models.User, password, code, recoveryCode string) (bool, error) {
+	if user.Password != "" {
+		if ok, _ := CheckPassword(user.Password, password); !ok {
+			return false, nil
+		}
+	}
+	if user.TOTPEnabled {
+		return verifySecondFactor(ctx, user, code, recoveryCode)
+	}
+	return true, nil
+}
+
+// writeLoginResponse 签发令牌并返回登录成功的响应
+func writeLoginResponse(w http.ResponseWriter, r *http.Request, user *models.User) {
+	promoteBootstrapAdmin(r.Context(), user)
+
+	tokens, err := IssueTokens(r.Context(), user)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// logs Login successful(terminal)
+	log.Printf("User logged in successfully: %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Login successful",
+		"username":      user.Username,
+		"role":          user.EffectiveRole(),
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// newTwoFactorChallenge 生成第一步认证通过后、提交验证码前使用的短期挑战令牌
+func newTwoFactorChallenge(user *models.User) (string, time.Duration, error) {
+	ttl := Login2FATTL()
+	challenge, err := GenerateActionToken(user.Email, PurposeLogin2FA, "", ttl)
+	return challenge, ttl, err
+}
+
+// writeTwoFactorChallenge 密码正确但需要两步验证时，返回短期有效的挑战令牌而不是访问令牌
+func writeTwoFactorChallenge(w http.ResponseWriter, user *models.User) {
+	challenge, ttl, err := newTwoFactorChallenge(user)
+	if err != nil {
+		log.Printf("Error generating 2FA challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Password accepted, two-factor code required for: %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":             "Two-factor authentication required",
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+		"expires_in":          int64(ttl.Seconds()),
+	})
+}
+
+// Login2FAHandler completes a login for an account with two-factor authentication
+// by exchanging the challenge token and a TOTP or recovery code for the app tokens
+func Login2FAHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		http.Error(w, "challenge_token is required", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		http.Error(w, "code or recovery_code is required", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := ParseActionToken(req.ChallengeToken, PurposeLogin2FA)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge, please sign in again", http.StatusUnauthorized)
+		return
+	}
+
+	// 验证码同样受登录失败次数限制
+	policy := LockoutPolicyFromEnv()
+	ip := clientIP(r)
+	block, err := checkLoginAllowed(r.Context(), policy, challenge.Email, ip)
+	if err != nil {
+		log.Printf("Error checking login attempts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		writeLoginBlock(w, block)
+		return
+	}
+
+	user, err := db.NewUserRepository().GetUserByEmail(r.Context(), challenge.Email)
+	if err != nil || !user.TOTPEnabled {
+		if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+			log.Printf("Error loading user for 2FA: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid or expired challenge, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	if user.Disabled {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	ok, err := verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(r.Context(), policy, user.Email, ip)
+		log.Printf("Login failed: invalid two-factor code for email: %s", user.Email)
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	// 挑战令牌只能完成一次登录
+	if _, err := consumeActionToken(r.Context(), req.ChallengeToken, PurposeLogin2FA); err != nil {
+		if errors.Is(err, ErrInvalidActionToken) {
+			http.Error(w, "Invalid or expired challenge, please sign in again", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error consuming 2FA challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearLoginFailures(r.Context(), user.Email)
+	writeLoginResponse(w, r, user)
+}
+
+// TwoFactorStatusHandler 返回当前用户的两步验证状态
+func TwoFactorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":                  user.TOTPEnabled,
+		"recovery_codes_remaining": len(user.RecoveryCodes),
+	})
+}
+
+// TwoFactorSetupHandler starts enrollment: it creates a new secret and returns the
+// provisioning URI for the authenticator app. 2FA is enabled only after the first code is confirmed.
+func TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := db.NewUserRepository().SetPendingTOTPSecret(r.Context(), user.Email, secret); err != nil {
+		log.Printf("Error saving TOTP secret for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": TOTPProvisioningURI(secret, totpIssuer(), user.Email),
+	})
+}
+
+// TwoFactorEnableHandler confirms enrollment with a code from the authenticator app
+// and returns the one-time recovery codes
+func TwoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		http.Error(w, "Start two-factor setup first", http.StatusBadRequest)
+		return
+	}
+
+	step, valid := ValidateTOTP(user.TOTPPendingSecret, req.Code, time.Now(), 0)
+	if !valid {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.NewUserRepository().EnableTOTP(r.Context(), user.Email, user.TOTPPendingSecret, step, hashes); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			// 期间重新开始了设置，密钥已变化
+			http.Error(w, "Two-factor setup has changed, please start again", http.StatusConflict)
+			return
+		}
+		log.Printf("Error enabling 2FA for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// TwoFactorDisableHandler turns 2FA off. It requires the password (for accounts that
+// have one) and a current code or recovery code.
+func TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	// 单点登录创建的账户没有本地密码
+	if user.Password != "" {
+		if ok, _ := CheckPassword(user.Password, req.Password); !ok {
+			http.Error(w, "Invalid password", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	valid, err := verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode)
+	if err != nil {
+		log.Printf("Error verifying second factor for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := db.NewUserRepository().DisableTOTP(r.Context(), user.Email); err != nil {
+		log.Printf("Error disabling 2FA for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodesHandler 验证当前验证码后生成新的恢复码，旧的恢复码全部失效
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := verifySecondFactor(r.Context(), user, req.Code, "")
+	if err != nil {
+		log.Printf("Error verifying second factor for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes, err := GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := db.NewUserRepository().SetRecoveryCodes(r.Context(), user.Email, hashes); err != nil {
+		log.Printf("Error saving recovery codes for %s: %v", user.Email, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
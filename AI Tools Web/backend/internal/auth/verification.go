@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"backend/internal/db"
+	"backend/internal/mail"
+	"backend/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// 找回密码和重发验证邮件的统一响应，不透露邮箱是否已注册
+const mailRequestAccepted = "If the email address is registered, a message has been sent"
+
+// appBaseURL 邮件中链接指向的前端地址
+func appBaseURL() string {
+	if u := os.Getenv("APP_BASE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// emailVerificationRequired 是否要求验证邮箱后才能登录 (REQUIRE_EMAIL_VERIFICATION=true)
+func emailVerificationRequired() bool {
+	return strings.EqualFold(os.Getenv("REQUIRE_EMAIL_VERIFICATION"), "true")
+}
+
+// sendVerificationEmail 发送邮箱验证链接
+func sendVerificationEmail(ctx context.Context, user *models.User) error {
+	ttl := EmailVerificationTTL()
+	token, err := GenerateActionToken(user.Email, PurposeVerifyEmail, "", ttl)
+	if err != nil {
+		return err
+	}
+
+	link := appBaseURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return mail.Default().Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			user.Username, link, ttl),
+	})
+}
+
+// sendPasswordResetEmail 发送密码重置链接
+func sendPasswordResetEmail(ctx context.Context, user *models.User) error {
+	ttl := PasswordResetTTL()
+	token, err := GenerateActionToken(user.Email, PurposeResetPassword, passwordFingerprint(user.Password), ttl)
+	if err != nil {
+		return err
+	}
+
+	link := appBaseURL() + "/reset-password?token=" + url.QueryEscape(token)
+	return mail.Default().Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not request a reset, you can ignore this email.\n",
+			user.Username, link, ttl),
+	})
+}
+
+// consumeActionToken 校验令牌并将其标记为已使用
+func consumeActionToken(ctx context.Context, tokenString, purpose string) (*ActionToken, error) {
+	token, err := ParseActionToken(tokenString, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.NewTokenRepository().ConsumeActionToken(ctx, token.ID, token.ExpiresAt); err != nil {
+		if errors.Is(err, db.ErrActionTokenUsed) {
+			return nil, ErrInvalidActionToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// writeActionTokenError 令牌无效时返回 400，其他错误返回 500
+func writeActionTokenError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrInvalidActionToken) || errors.Is(err, db.ErrUserNotFound) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Error processing action token: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// VerifyEmailHandler marks the user's email as verified using the token from the verification email
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := consumeActionToken(r.Context(), req.Token, PurposeVerifyEmail)
+	if err != nil {
+		writeActionTokenError(w, err)
+		return
+	}
+
+	if err := db.NewUserRepository().MarkEmailVerified(r.Context(), token.Email); err != nil {
+		writeActionTokenError(w, err)
+		return
+	}
+
+	log.Printf("Email verified for user: %s", token.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerificationHandler sends a new verification email to an unverified account
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.NewUserRepository().GetUserByEmail(r.Context(), req.Email)
+	switch {
+	case err == nil && !user.EmailVerified && !user.Disabled:
+		if err := sendVerificationEmail(r.Context(), user); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+	case err != nil && !errors.Is(err, db.ErrUserNotFound):
+		log.Printf("Error loading user for verification email: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": mailRequestAccepted,
+	})
+}
+
+// ForgotPasswordHandler emails a password reset link if the account exists
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := db.NewUserRepository().GetUserByEmail(r.Context(), req.Email)
+	switch {
+	case err == nil && !user.Disabled:
+		if err := sendPasswordResetEmail(r.Context(), user); err != nil {
+			log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Password reset requested for user: %s", user.Email)
+	case err != nil && !errors.Is(err, db.ErrUserNotFound):
+		log.Printf("Error loading user for password reset: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": mailRequestAccepted,
+	})
+}
+
+// ResetPasswordHandler sets a new password using the token from the reset email
+// and ends every existing session of the user
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == "" {
+		http.Error(w, "New password cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// 先校验签名和绑定的密码指纹，再消耗令牌，避免无效请求占用令牌
+	token, err := ParseActionToken(req.Token, PurposeResetPassword)
+	if err != nil {
+		writeActionTokenError(w, err)
+		return
+	}
+
+	repo := db.NewUserRepository()
+	user, err := repo.GetUserByEmail(r.Context(), token.Email)
+	if err != nil {
+		writeActionTokenError(w, err)
+		return
+	}
+	if user.Disabled || token.Binding != passwordFingerprint(user.Password) {
+		writeActionTokenError(w, ErrInvalidActionToken)
+		return
+	}
+
+	if _, err := consumeActionToken(r.Context(), req.Token, PurposeResetPassword); err != nil {
+		writeActionTokenError(w, err)
+		return
+	}
+
+	hashedPassword, err := HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Failed to hash new password: %v", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+	if err := repo.UpdatePassword(r.Context(), user.Email, hashedPassword); err != nil {
+		log.Printf("Failed to update password: %v", err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	// 能收到重置邮件说明用户拥有该邮箱
+	if !user.EmailVerified {
+		if err := repo.MarkEmailVerified(r.Context(), user.Email); err != nil {
+			log.Printf("Failed to mark email verified for %s: %v", user.Email, err)
+		}
+	}
+
+	if err := RevokeUserSessions(r.Context(), user.Email); err != nil {
+		log.Printf("Failed to revoke sessions after password reset for %s: %v", user.Email, err)
+	}
+
+	log.Printf("Password reset for user: %s", user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password has been reset",
+	})
+}
+
+// verificationPending 返回用户是否因邮箱未验证而不能登录
+func verificationPending(user *models.User) bool {
+	return emailVerificationRequired() && !user.EmailVerified
+}
+
+// sendVerificationEmailAsync 注册后在后台发送验证邮件，不阻塞注册响应
+func sendVerificationEmailAsync(user models.User) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := sendVerificationEmail(ctx, &user); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+		}
+	}()
+}
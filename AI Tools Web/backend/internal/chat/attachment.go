@@ -0,0 +1,249 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// 附件默认最大大小（MB），可通过 ATTACHMENT_MAX_SIZE_MB 配置
+	defaultAttachmentMaxSizeMB = 5
+	// 一条消息最多的附件数
+	maxAttachmentsPerMessage = 5
+	// 上传后没有用在消息中的附件保留的时间
+	unboundAttachmentTTL = 24 * time.Hour
+)
+
+// maxAttachmentSize 单个附件的最大字节数。附件保存在 MongoDB 文档中，不能超过 15MB。
+func maxAttachmentSize() int64 {
+	size := defaultAttachmentMaxSizeMB
+	if mb, err := strconv.Atoi(os.Getenv("ATTACHMENT_MAX_SIZE_MB")); err == nil && mb > 0 && mb <= 15 {
+		size = mb
+	}
+	return int64(size) << 20
+}
+
+// inputError 客户端的输入无法生成回复，错误信息直接返回给客户端
+type inputError struct {
+	message string
+}
+
+func (e *inputError) Error() string {
+	return e.message
+}
+
+// writeStartError 返回开始生成失败的原因：输入错误返回 400，其他错误返回 500
+func writeStartError(w http.ResponseWriter, err error) {
+	var inputErr *inputError
+	if errors.As(err, &inputErr) {
+		http.Error(w, inputErr.message, http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Failed to start generation", http.StatusInternalServerError)
+}
+
+// startErrorMessage 返回给 WebSocket 客户端的开始生成失败的原因
+func startErrorMessage(err error) string {
+	var inputErr *inputError
+	if errors.As(err, &inputErr) {
+		return inputErr.message
+	}
+	return "Failed to start generation"
+}
+
+// checkVision 历史中有图片时，模型必须支持视觉
+func checkVision(model string, history []models.Message) error {
+	if models.HasImages(history) && !models.SupportsVision(model) {
+		return &inputError{fmt.Sprintf("Model %s does not support image attachments; switch the chat to a vision model such as %s", model, models.ModelGPT4o)}
+	}
+	return nil
+}
+
+// parseAttachmentIDs 解析逗号分隔的附件 ID
+func parseAttachmentIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// loadAttachmentRefs 检查要添加到聊天消息中的附件：必须属于用户，且还没有用在其他聊天中
+func loadAttachmentRefs(ctx context.Context, email, chatID string, ids []string) ([]models.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if len(ids) > maxAttachmentsPerMessage {
+		return nil, &inputError{fmt.Sprintf("A message can have at most %d attachments", maxAttachmentsPerMessage)}
+	}
+
+	files, err := db.NewAttachmentRepository().FindAttachments(ctx, email, ids)
+	if err != nil {
+		if errors.Is(err, db.ErrAttachmentNotFound) {
+			return nil, &inputError{"Attachment not found or expired"}
+		}
+		return nil, err
+	}
+
+	attachments := make([]models.Attachment, 0, len(files))
+	seen := make(map[string]bool, len(files))
+	for i := range files {
+		if files[i].ChatID != "" && files[i].ChatID != chatID {
+			return nil, &inputError{"Attachment belongs to another chat"}
+		}
+		if seen[files[i].ID] {
+			continue
+		}
+		seen[files[i].ID] = true
+		attachments = append(attachments, files[i].Ref())
+	}
+	return attachments, nil
+}
+
+// expandAttachments 读取历史中附件的内容：图片放在 Data 中由服务按各自的多模态格式发送，
+// 文本文件附加到消息内容中。返回新的切片，不修改 history。
+func expandAttachments(ctx context.Context, chatID string, history []models.Message) []models.Message {
+	var ids []string
+	for _, m := range history {
+		for _, a := range m.Attachments {
+			ids = append(ids, a.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return history
+	}
+
+	data, err := db.NewAttachmentRepository().LoadAttachmentData(ctx, chatID, ids)
+	if err != nil {
+		// 读取失败时只发送文字
+		log.Printf("Error loading attachments of chat %s: %v", chatID, err)
+		return history
+	}
+
+	expanded := make([]models.Message, len(history))
+	for i, m := range history {
+		if len(m.Attachments) > 0 {
+			attachments := make([]models.Attachment, len(m.Attachments))
+			for j, a := range m.Attachments {
+				a.Data = data[a.ID]
+				attachments[j] = a
+			}
+			m.Attachments = attachments
+			m.Content = models.WithTextAttachments(m.Content, attachments)
+		}
+		expanded[i] = m
+	}
+	return expanded
+}
+
+// UploadAttachmentHandler 上传一个附件（multipart 的 file 字段），返回附件信息。
+// 发送消息时通过 attachments 引用附件，24 小时内没有使用的附件会被删除。
+func UploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	maxSize := maxAttachmentSize()
+	// 为 multipart 的边界和其他字段多留 1MB
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Attachment must be at most %d MB", maxSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to get file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		log.Printf("Error reading attachment: %v", err)
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		http.Error(w, fmt.Sprintf("Attachment must be at most %d MB", maxSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "Attachment is empty", http.StatusBadRequest)
+		return
+	}
+
+	filename := filepath.Base(strings.ReplaceAll(header.Filename, "\\", "/"))
+	mimeType, kind, ok := models.DetectAttachmentType(filename, data)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unsupported attachment type %s; supported types are PNG, JPEG, GIF and WebP images and UTF-8 text files", mimeType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	attachment := &models.AttachmentFile{
+		UserEmail: userClaims.Email,
+		Filename:  filename,
+		MimeType:  mimeType,
+		Kind:      kind,
+		Size:      int64(len(data)),
+		Data:      data,
+	}
+	if err := db.NewAttachmentRepository().SaveAttachment(r.Context(), attachment, unboundAttachmentTTL); err != nil {
+		log.Printf("Error saving attachment for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to save attachment", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Uploaded %s attachment %s (%s, %d bytes) for %s", kind, attachment.ID, mimeType, attachment.Size, userClaims.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// GetAttachmentHandler 下载用户的附件内容
+func GetAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := db.NewAttachmentRepository().GetAttachment(r.Context(), userClaims.Email, mux.Vars(r)["attachmentId"])
+	if err != nil {
+		if errors.Is(err, db.ErrAttachmentNotFound) {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error getting attachment: %v", err)
+		http.Error(w, "Failed to get attachment", http.StatusInternalServerError)
+		return
+	}
+
+	contentType := file.MimeType
+	if file.Kind == models.AttachmentKindText {
+		// 文本文件不按 HTML 等类型渲染
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	attachment(w, file.Filename)
+	w.Write(file.Data)
+}
@@ -0,0 +1,194 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// EditMessageHandler 编辑一条用户消息：在同一父消息下创建新的用户消息作为新分支，
+// 切换到该分支并流式返回新的回复。原来的分支保留，可以通过 /branch 切换回去。
+func EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	chatID, messageID := vars["id"], vars["messageId"]
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewChatRepository()
+	chatInfo, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error getting chat info: %v", err)
+		writeRepoError(w, err, "Failed to get chat information")
+		return
+	}
+
+	original, err := repo.GetMessage(r.Context(), userClaims.Email, chatID, messageID)
+	if err != nil {
+		log.Printf("Error getting message %s: %v", messageID, err)
+		writeRepoError(w, err, "Failed to get message")
+		return
+	}
+	if original.Role != "user" {
+		http.Error(w, "Only user messages can be edited", http.StatusBadRequest)
+		return
+	}
+
+	ro, err := replyOptionsFromQuery(r)
+	if err != nil {
+		http.Error(w, "Temperature must be between 0 and 2", http.StatusBadRequest)
+		return
+	}
+	cfg := resolveStreamConfig(r.Context(), repo, userClaims.Email, chatInfo, req.Content, ro)
+
+	// 编辑只修改文字，原消息的附件保留在新分支中
+	edited := &models.Message{
+		ChatID:      chatID,
+		Role:        "user",
+		Content:     req.Content,
+		ParentID:    original.ParentID,
+		Attachments: original.Attachments,
+	}
+	if err := repo.SaveBranchMessage(r.Context(), userClaims.Email, edited); err != nil {
+		log.Printf("Error saving edited message: %v", err)
+		writeRepoError(w, err, "Failed to save message")
+		return
+	}
+
+	history, err := repo.GetActivePath(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error getting chat history: %v", err)
+		writeRepoError(w, err, "Failed to get chat history")
+		return
+	}
+
+	log.Printf("Edited message %s in chat %s as %s", messageID, chatID, edited.ID)
+	streamReply(w, r, repo, userClaims.Email, chatID, cfg, history)
+}
+
+// RegenerateMessageHandler 重新生成一条助手回复：切换到它的父消息（用户消息），
+// 基于到该消息为止的历史流式返回新的回复，新回复与原回复互为分支。
+func RegenerateMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	chatID, messageID := vars["id"], vars["messageId"]
+
+	repo := db.NewChatRepository()
+	chatInfo, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error getting chat info: %v", err)
+		writeRepoError(w, err, "Failed to get chat information")
+		return
+	}
+
+	original, err := repo.GetMessage(r.Context(), userClaims.Email, chatID, messageID)
+	if err != nil {
+		log.Printf("Error getting message %s: %v", messageID, err)
+		writeRepoError(w, err, "Failed to get message")
+		return
+	}
+	if original.Role != "assistant" || original.ParentID == "" {
+		http.Error(w, "Only assistant replies can be regenerated", http.StatusBadRequest)
+		return
+	}
+
+	if err := repo.SetActiveLeaf(r.Context(), userClaims.Email, chatID, original.ParentID); err != nil {
+		log.Printf("Error switching branch: %v", err)
+		writeRepoError(w, err, "Failed to switch branch")
+		return
+	}
+
+	history, err := repo.GetActivePath(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error getting chat history: %v", err)
+		writeRepoError(w, err, "Failed to get chat history")
+		return
+	}
+
+	var prompt string
+	if len(history) > 0 {
+		prompt = history[len(history)-1].Content
+	}
+	ro, err := replyOptionsFromQuery(r)
+	if err != nil {
+		http.Error(w, "Temperature must be between 0 and 2", http.StatusBadRequest)
+		return
+	}
+	cfg := resolveStreamConfig(r.Context(), repo, userClaims.Email, chatInfo, prompt, ro)
+
+	log.Printf("Regenerating reply %s in chat %s", messageID, chatID)
+	streamReply(w, r, repo, userClaims.Email, chatID, cfg, history)
+}
+
+// SwitchBranchHandler 切换到包含指定消息的分支，沿该消息最新的后续消息一直到末端，
+// 返回切换后的当前分支
+func SwitchBranchHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	chatID := mux.Vars(r)["id"]
+
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == "" {
+		http.Error(w, "message_id is required", http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewChatRepository()
+	messages, err := repo.GetMessages(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error getting messages: %v", err)
+		writeRepoError(w, err, "Failed to get messages")
+		return
+	}
+
+	found := false
+	for _, m := range messages {
+		if m.ID == req.MessageID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	leafID := models.LatestLeaf(messages, req.MessageID)
+	if err := repo.SetActiveLeaf(r.Context(), userClaims.Email, chatID, leafID); err != nil {
+		log.Printf("Error switching branch: %v", err)
+		writeRepoError(w, err, "Failed to switch branch")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ActivePath(messages, leafID))
+}
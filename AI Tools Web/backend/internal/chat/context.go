@@ -0,0 +1,243 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/services"
+)
+
+const (
+	// 摘要最多占用的 token 数
+	summaryTokenBudget = 1000
+	// 生成摘要的模型为输出和提示预留的 token 数
+	summaryReserve = 1500
+)
+
+// contextPolicy 历史超出上下文时的处理方式：用户偏好优先，其次是 CONTEXT_POLICY，默认截断
+func contextPolicy(prefs models.UserPreferences) string {
+	if models.IsValidContextPolicy(prefs.ContextPolicy) {
+		return prefs.ContextPolicy
+	}
+	if policy := os.Getenv("CONTEXT_POLICY"); models.IsValidContextPolicy(policy) {
+		return policy
+	}
+	return models.ContextPolicyTruncate
+}
+
+// contextBudget 发送给模型的消息（包括系统提示）最多使用的 token 数。
+// MAX_CONTEXT_TOKENS 可以把上下文限制得比模型窗口更小，以控制成本。
+func contextBudget(model string) int {
+	window := models.ContextWindow(model)
+	if limit, err := strconv.Atoi(os.Getenv("MAX_CONTEXT_TOKENS")); err == nil && limit > 0 && limit < window {
+		window = limit
+	}
+	if window <= models.ReplyTokenReserve*2 {
+		return window / 2
+	}
+	return window - models.ReplyTokenReserve
+}
+
+// summaryModel 生成摘要使用的模型，可通过 CONTEXT_SUMMARY_MODEL 配置
+func summaryModel() string {
+	if model := os.Getenv("CONTEXT_SUMMARY_MODEL"); model != "" {
+		return model
+	}
+	return models.DefaultChatModel
+}
+
+// withSystemPrompt 在历史前加上系统提示
+func withSystemPrompt(systemPrompt string, history []models.Message) []models.Message {
+	messages := make([]models.Message, 0, len(history)+1)
+	messages = append(messages, models.Message{Role: "system", Content: systemPrompt})
+	return append(messages, history...)
+}
+
+// buildContext 组装发送给模型的消息：系统提示加上当前分支的历史。历史超出模型的上下文时，
+// 按用户的策略丢弃较早的对话或用摘要代替它们。返回的 ContextInfo 为 nil 表示发送了完整的历史。
+func buildContext(ctx context.Context, repo *db.ChatRepository, email, chatID string, cfg streamConfig, history []models.Message) ([]models.Message, *models.ContextInfo) {
+	// Build system prompt based on language preference, model information and custom instructions
+	systemPrompt := buildSystemPrompt(cfg.model, cfg.language, cfg.instructions)
+
+	// 添加调试日志，确认模型和系统提示
+	log.Printf("Sending request with model: %s", cfg.model)
+	log.Printf("System prompt: %s", systemPrompt)
+
+	budget := contextBudget(cfg.model)
+	full := withSystemPrompt(systemPrompt, history)
+	tokens := services.CountMessageTokens(cfg.model, full)
+	if tokens <= budget {
+		return full, nil
+	}
+
+	info := &models.ContextInfo{
+		Policy:        contextPolicy(cfg.prefs),
+		ContextWindow: models.ContextWindow(cfg.model),
+	}
+	log.Printf("History of chat %s needs %d tokens, over the budget of %d for %s, policy: %s",
+		chatID, tokens, budget, cfg.model, info.Policy)
+
+	if info.Policy == models.ContextPolicySummarize {
+		if summary, start, ok := summarizeContext(ctx, repo, email, chatID, cfg, systemPrompt, history, budget); ok {
+			systemPrompt += "\n\nSummary of the earlier part of this conversation (those messages are not included below):\n" + summary
+			messages := withSystemPrompt(systemPrompt, history[start:])
+			info.SummarizedMessages = start
+			info.PromptTokens = services.CountMessageTokens(cfg.model, messages)
+			return messages, info
+		}
+		// 摘要失败时退回到截断
+		info.Policy = models.ContextPolicyTruncate
+	}
+
+	systemTokens := services.CountMessageTokens(cfg.model, full[:1])
+	start := services.FitHistory(cfg.model, history, budget-systemTokens)
+	messages := withSystemPrompt(systemPrompt, history[start:])
+	info.OmittedMessages = start
+	info.PromptTokens = services.CountMessageTokens(cfg.model, messages)
+	return messages, info
+}
+
+// summarizeContext 用摘要代替较早的对话，返回摘要和需要原样发送的第一条消息的下标。
+// 摘要保存在聊天中，之后的回复只需把新超出的消息并入摘要；为了不在每一轮都更新摘要，
+// 最近的对话只使用一半的预算。
+func summarizeContext(ctx context.Context, repo *db.ChatRepository, email, chatID string, cfg streamConfig, systemPrompt string, history []models.Message, budget int) (string, int, bool) {
+	systemTokens := services.CountMessageTokens(cfg.model, []models.Message{{Role: "system", Content: systemPrompt}})
+	start := services.FitHistory(cfg.model, history, (budget-systemTokens-summaryTokenBudget)/2)
+	if start == 0 {
+		// 最后一条消息本身就超出了上下文，摘要也无济于事
+		return "", 0, false
+	}
+
+	chatInfo, err := repo.GetChat(ctx, email, chatID)
+	if err != nil {
+		log.Printf("Error getting chat for context summary: %v", err)
+		return "", 0, false
+	}
+
+	// 已有的摘要覆盖到当前分支上的哪条消息，不在当前分支上时从头开始。
+	// 重新生成回复后历史可能变短，摘要不能包含要回复的最后一条消息。
+	covered := -1
+	previous := ""
+	if s := chatInfo.ContextSummary; s != nil {
+		for i, m := range history[:len(history)-1] {
+			if m.ID == s.UpToMessageID {
+				covered, previous = i, s.Content
+				break
+			}
+		}
+	}
+
+	if covered >= start-1 {
+		// 已有的摘要足够，剩下的消息原样发送
+		return previous, covered + 1, true
+	}
+
+	summary, err := rollSummary(ctx, previous, history[covered+1:start], cfg.language)
+	if err != nil {
+		log.Printf("Error summarizing chat %s: %v", chatID, err)
+		return "", 0, false
+	}
+
+	saved := &models.ContextSummary{
+		Content:       summary,
+		UpToMessageID: history[start-1].ID,
+		MessageCount:  start,
+		UpdatedAt:     time.Now(),
+	}
+	if err := repo.UpdateContextSummary(ctx, email, chatID, saved); err != nil {
+		// 保存失败不影响这次回复，下次重新生成
+		log.Printf("Error saving context summary for chat %s: %v", chatID, err)
+	}
+	log.Printf("Summarized %d earlier messages of chat %s", start, chatID)
+	return summary, start, true
+}
+
+// rollSummary 把消息分批并入已有的摘要，每批都不超过摘要模型的上下文
+func rollSummary(ctx context.Context, summary string, messages []models.Message, language string) (string, error) {
+	model := summaryModel()
+	chunkBudget := contextBudget(model) - summaryReserve - summaryTokenBudget
+
+	var chunk strings.Builder
+	chunkTokens := 0
+	flush := func() error {
+		if chunk.Len() == 0 {
+			return nil
+		}
+		updated, err := summarizeChunk(ctx, model, summary, chunk.String(), language)
+		if err != nil {
+			return err
+		}
+		summary = updated
+		chunk.Reset()
+		chunkTokens = 0
+		return nil
+	}
+
+	for _, m := range messages {
+		content := m.Content
+		tokens := services.CountTokens(model, content)
+		if tokens > chunkBudget {
+			// 单条消息过长时只取开头
+			content = truncateRunes(content, chunkBudget)
+			tokens = services.CountTokens(model, content)
+		}
+		if chunkTokens+tokens > chunkBudget {
+			if err := flush(); err != nil {
+				return "", err
+			}
+		}
+		role := "User"
+		if m.Role == "assistant" {
+			role = "Assistant"
+		}
+		fmt.Fprintf(&chunk, "%s: %s\n\n", role, content)
+		chunkTokens += tokens
+	}
+	if err := flush(); err != nil {
+		return "", err
+	}
+	return summary, nil
+}
+
+// summarizeChunk 让模型把一批新的消息并入摘要
+func summarizeChunk(ctx context.Context, model, summary, transcript, language string) (string, error) {
+	prompt := "You maintain a running summary of a conversation between a user and an AI assistant. " +
+		"Update the summary with the new messages. Keep facts, decisions, names, code identifiers, " +
+		"the user's goals and preferences, and open questions. Write at most 300 words. Reply with the summary only."
+	if language == models.LanguageChinese {
+		prompt += " Write the summary in Chinese."
+	}
+
+	if summary == "" {
+		summary = "(empty)"
+	}
+	message := fmt.Sprintf("Current summary:\n%s\n\nNew messages:\n%s", summary, transcript)
+
+	updated, err := services.GetLLMService(model).CallModel(ctx, message, model, services.CallOptions{SystemPrompt: prompt})
+	if err != nil {
+		return "", err
+	}
+	updated = strings.TrimSpace(updated)
+	if updated == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return updated, nil
+}
+
+// writeSSEContext 以 context 事件告诉客户端较早的历史被摘要或省略
+func writeSSEContext(w http.ResponseWriter, info *models.ContextInfo) {
+	data, _ := json.Marshal(info)
+	fmt.Fprintf(w, "event: context\ndata: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
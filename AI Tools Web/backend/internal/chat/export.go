@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 导入的 JSON 文件最大字节数
+const maxImportSize = 10 << 20
+
+// exportFormat 读取 format 查询参数，为空时使用 defaultFormat
+func exportFormat(r *http.Request, defaultFormat string) (string, bool) {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format == "" {
+		return defaultFormat, true
+	}
+	if format == "markdown" {
+		format = models.ExportFormatMarkdown
+	}
+	return format, models.IsValidExportFormat(format)
+}
+
+// attachment 设置下载文件名，非 ASCII 的文件名按 RFC 2231 编码
+func attachment(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+// ExportChatHandler 以 Markdown、HTML 或 JSON 格式下载一个聊天
+func ExportChatHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	chatID := mux.Vars(r)["id"]
+
+	format, ok := exportFormat(r, models.ExportFormatMarkdown)
+	if !ok {
+		http.Error(w, "Format must be md, html or json", http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewChatRepository()
+	chat, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		writeRepoError(w, err, "Failed to export chat")
+		return
+	}
+	messages, err := repo.GetMessages(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error loading messages for export of chat %s: %v", chatID, err)
+		writeRepoError(w, err, "Failed to export chat")
+		return
+	}
+
+	data, err := models.RenderChatExport(models.NewChatExport(*chat, messages, time.Now()), format)
+	if err != nil {
+		log.Printf("Error rendering export of chat %s: %v", chatID, err)
+		http.Error(w, "Failed to export chat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", models.ExportContentType(format))
+	attachment(w, models.ExportFileName(*chat, format))
+	w.Write(data)
+}
+
+// ExportAllChatsHandler 将用户的全部聊天按指定格式（默认 JSON）打包为 zip 下载
+func ExportAllChatsHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	format, ok := exportFormat(r, models.ExportFormatJSON)
+	if !ok {
+		http.Error(w, "Format must be md, html or json", http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewChatRepository()
+	chats, err := repo.GetChatHistory(r.Context(), userClaims.Email)
+	if err != nil {
+		log.Printf("Error loading chats for export: %v", err)
+		http.Error(w, "Failed to export chats", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/zip")
+	attachment(w, fmt.Sprintf("chats-%s-%s.zip", format, now.Format("20060102")))
+
+	// 压缩包直接写入响应，出错时响应头已发送，只能中断下载
+	zw := zip.NewWriter(w)
+	for _, chat := range chats {
+		if err := writeChatEntry(r.Context(), zw, repo, userClaims.Email, chat, format, now); err != nil {
+			log.Printf("Error exporting chat %s for %s: %v", chat.ID, userClaims.Email, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Error writing chat export archive for %s: %v", userClaims.Email, err)
+		panic(http.ErrAbortHandler)
+	}
+	log.Printf("Exported %d chats as %s for %s", len(chats), format, userClaims.Email)
+}
+
+// writeChatEntry 将一个聊天渲染后写入压缩包
+func writeChatEntry(ctx context.Context, zw *zip.Writer, repo *db.ChatRepository, email string, chat models.Chat, format string, now time.Time) error {
+	messages, err := repo.GetMessages(ctx, email, chat.ID)
+	if err != nil {
+		return err
+	}
+	data, err := models.RenderChatExport(models.NewChatExport(chat, messages, now), format)
+	if err != nil {
+		return err
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     models.ExportFileName(chat, format),
+		Method:   zip.Deflate,
+		Modified: chat.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// ImportChatHandler 从 JSON 导出文件重建聊天，包括所有分支。消息使用新的 ID，
+// 原来的时间保留；模型不再可用时使用用户的默认模型。
+func ImportChatHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var export models.ChatExport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&export); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Import file must be at most %d MB", maxImportSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	messages, leafID, err := models.PrepareImport(&export, func() string { return primitive.NewObjectID().Hex() }, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chat := &models.Chat{
+		Title:        strings.TrimSpace(export.Chat.Title),
+		TitleSource:  models.TitleSourceUser,
+		Model:        export.Chat.Model,
+		ActiveLeafID: leafID,
+	}
+	if chat.Title == "" {
+		chat.Title = "Imported Chat"
+	}
+	if !isValidModel(chat.Model) {
+		chat.Model = defaultModel(loadPreferences(r.Context(), userClaims.Email))
+	}
+
+	if err := db.NewChatRepository().ImportChat(r.Context(), userClaims.Email, chat, messages); err != nil {
+		log.Printf("Error importing chat for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to import chat", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(chat)
+}
@@ -0,0 +1,353 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// generationRetention 生成结束后保留输出的时间，供断线的客户端取回最后的部分。
+// 可通过 GENERATION_RETENTION 配置。
+func generationRetention() time.Duration {
+	return config.Duration("GENERATION_RETENTION", 2*time.Minute)
+}
+
+// detachedTimeout 没有客户端连接时生成继续运行的时间，超时后取消，避免为无人接收的回复消耗 token。
+// 可通过 GENERATION_DETACHED_TIMEOUT 配置。
+func detachedTimeout() time.Duration {
+	return config.Duration("GENERATION_DETACHED_TIMEOUT", 30*time.Second)
+}
+
+// generation 一次回复生成。生成在后台运行，与发起它的 HTTP 连接无关；
+// 输出按 SSE 事件缓存在内存中，断线重连的客户端通过 Last-Event-ID 重放错过的事件。
+// generation 实现了 http.ResponseWriter，模型服务直接向它写入 SSE 输出。
+type generation struct {
+	id     string
+	chatID string
+	ctx    context.Context
+	cancel context.CancelFunc
+	header http.Header
+
+	mu sync.Mutex
+	// events 已完成的 SSE 事件（不含结尾的空行），事件 ID 为下标加一
+	events  []string
+	pending []byte
+	done    bool
+	// notify 有新事件或生成结束时关闭并替换
+	notify    chan struct{}
+	watchers  int
+	idleTimer *time.Timer
+	// reply 生成结束后保存的助手消息
+	reply *models.Message
+}
+
+// generations 按 ID 和聊天索引的生成，/stop 可以从其他连接取消它们
+var generations = struct {
+	sync.Mutex
+	byID   map[string]*generation
+	byChat map[string]map[*generation]struct{}
+}{
+	byID:   make(map[string]*generation),
+	byChat: make(map[string]map[*generation]struct{}),
+}
+
+// startGeneration 登记一次新的生成。生成结束后必须调用 finish。
+func startGeneration(chatID string) (*generation, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &generation{
+		id:     hex.EncodeToString(b),
+		chatID: chatID,
+		ctx:    ctx,
+		cancel: cancel,
+		header: make(http.Header),
+		notify: make(chan struct{}),
+	}
+
+	generations.Lock()
+	generations.byID[g.id] = g
+	if generations.byChat[chatID] == nil {
+		generations.byChat[chatID] = make(map[*generation]struct{})
+	}
+	generations.byChat[chatID][g] = struct{}{}
+	generations.Unlock()
+
+	return g, nil
+}
+
+// findGeneration 查找聊天中仍在内存里的生成
+func findGeneration(chatID, id string) *generation {
+	generations.Lock()
+	defer generations.Unlock()
+
+	g := generations.byID[id]
+	if g == nil || g.chatID != chatID {
+		return nil
+	}
+	return g
+}
+
+// stopGenerations 取消聊天中所有正在进行的生成，返回取消的数量
+func stopGenerations(chatID string) int {
+	generations.Lock()
+	defer generations.Unlock()
+
+	stopped := 0
+	for g := range generations.byChat[chatID] {
+		if !g.finished() {
+			g.cancel()
+			stopped++
+		}
+	}
+	return stopped
+}
+
+// Header 实现 http.ResponseWriter，模型服务设置的响应头被忽略
+func (g *generation) Header() http.Header {
+	return g.header
+}
+
+// WriteHeader 实现 http.ResponseWriter
+func (g *generation) WriteHeader(int) {}
+
+// Flush 实现 http.Flusher，事件在 Write 中已经发布
+func (g *generation) Flush() {}
+
+// Write 将模型服务的 SSE 输出按空行切分为事件并通知等待的客户端
+func (g *generation) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.pending = append(g.pending, p...)
+	published := false
+	for {
+		i := bytes.Index(g.pending, []byte("\n\n"))
+		if i < 0 {
+			break
+		}
+		g.events = append(g.events, string(g.pending[:i]))
+		g.pending = g.pending[i+2:]
+		published = true
+	}
+	if published {
+		g.broadcast()
+	}
+	return len(p), nil
+}
+
+// broadcast 唤醒所有等待的客户端，调用时必须持有 g.mu
+func (g *generation) broadcast() {
+	close(g.notify)
+	g.notify = make(chan struct{})
+}
+
+// finish 标记生成结束，保留输出一段时间后从内存中移除
+func (g *generation) finish() {
+	g.mu.Lock()
+	if len(bytes.TrimSpace(g.pending)) > 0 {
+		g.events = append(g.events, string(g.pending))
+	}
+	g.pending = nil
+	g.done = true
+	if g.idleTimer != nil {
+		g.idleTimer.Stop()
+	}
+	g.broadcast()
+	g.mu.Unlock()
+	g.cancel()
+
+	time.AfterFunc(generationRetention(), func() {
+		generations.Lock()
+		delete(generations.byID, g.id)
+		delete(generations.byChat[g.chatID], g)
+		if len(generations.byChat[g.chatID]) == 0 {
+			delete(generations.byChat, g.chatID)
+		}
+		generations.Unlock()
+	})
+}
+
+// setReply 记录保存的回复，在 finish 之前调用
+func (g *generation) setReply(reply *models.Message) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reply = reply
+}
+
+// result 返回保存的回复，生成未结束或没有内容时为 nil
+func (g *generation) result() *models.Message {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reply
+}
+
+func (g *generation) finished() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.done
+}
+
+// attach 记录一个连接的客户端
+func (g *generation) attach() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.watchers++
+	if g.idleTimer != nil {
+		g.idleTimer.Stop()
+		g.idleTimer = nil
+	}
+}
+
+// detach 客户端断开。所有客户端都断开后，如果在 detachedTimeout 内没有重连则取消生成
+func (g *generation) detach() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.watchers--
+	if g.watchers > 0 || g.done {
+		return
+	}
+	g.idleTimer = time.AfterFunc(detachedTimeout(), func() {
+		log.Printf("No client attached to generation %s in chat %s, canceling", g.id, g.chatID)
+		g.cancel()
+	})
+}
+
+// eventsAfter 返回 ID 大于 after 的事件、生成是否已结束，以及等待新事件的通道
+func (g *generation) eventsAfter(after int) ([]string, bool, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if after > len(g.events) {
+		after = len(g.events)
+	}
+	events := append([]string(nil), g.events[after:]...)
+	return events, g.done, g.notify
+}
+
+// eventID 事件 ID 的格式为 <生成 ID>-<序号>
+func (g *generation) eventID(seq int) string {
+	return fmt.Sprintf("%s-%d", g.id, seq)
+}
+
+// parseEventID 解析 Last-Event-ID
+func parseEventID(value string) (string, int, bool) {
+	i := strings.LastIndex(value, "-")
+	if i <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(value[i+1:])
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return value[:i], seq, true
+}
+
+// serveGeneration 从序号 after 之后开始向客户端发送生成的事件，直到生成结束或客户端断开
+func serveGeneration(w http.ResponseWriter, r *http.Request, g *generation, after int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	flusher, _ := w.(http.Flusher)
+
+	g.attach()
+	defer g.detach()
+
+	next := after
+	for {
+		events, done, notify := g.eventsAfter(next)
+		for _, event := range events {
+			next++
+			fmt.Fprintf(w, "id: %s\n%s\n\n", g.eventID(next), event)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-notify:
+		case <-r.Context().Done():
+			log.Printf("Client left generation %s in chat %s at event %d", g.id, g.chatID, next)
+			return
+		}
+	}
+}
+
+// resumeGeneration 处理带 Last-Event-ID 的重连，返回 false 表示请求不是重连
+func resumeGeneration(w http.ResponseWriter, r *http.Request, chatID string) bool {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		// fetch 等无法设置该请求头的客户端可以使用查询参数
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID == "" {
+		return false
+	}
+
+	id, seq, ok := parseEventID(lastEventID)
+	if !ok {
+		http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+		return true
+	}
+	g := findGeneration(chatID, id)
+	if g == nil {
+		// 生成已结束且输出已过期，204 让 EventSource 停止重连，客户端应重新获取消息
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	log.Printf("Resuming generation %s in chat %s after event %d", id, chatID, seq)
+	serveGeneration(w, r, g, seq)
+	return true
+}
+
+// StopGenerationHandler 停止聊天中正在生成的回复，已经生成的部分会被保存
+func StopGenerationHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	chatID := mux.Vars(r)["id"]
+
+	// 只能停止自己的聊天
+	if _, err := db.NewChatRepository().GetChat(r.Context(), userClaims.Email, chatID); err != nil {
+		log.Printf("Error getting chat info: %v", err)
+		writeRepoError(w, err, "Failed to get chat information")
+		return
+	}
+
+	stopped := stopGenerations(chatID)
+	if stopped == 0 {
+		http.Error(w, "No reply is being generated", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Stopped %d generation(s) in chat %s", stopped, chatID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Generation stopped"})
+}
@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventID(t *testing.T) {
+	id, seq, ok := parseEventID("9f86d081884c7d65-12")
+	require.True(t, ok)
+	assert.Equal(t, "9f86d081884c7d65", id)
+	assert.Equal(t, 12, seq)
+
+	id, seq, ok = parseEventID("gen-with-dashes-0")
+	require.True(t, ok)
+	assert.Equal(t, "gen-with-dashes", id)
+	assert.Equal(t, 0, seq)
+
+	for _, value := range []string{"", "9f86d081", "-3", "9f86d081-", "9f86d081-x", "9f86d081-1.5"} {
+		_, _, ok := parseEventID(value)
+		assert.False(t, ok, "%q should be rejected", value)
+	}
+}
+
+func TestGenerationReplay(t *testing.T) {
+	g, err := startGeneration("replay-chat")
+	require.NoError(t, err)
+	defer g.finish()
+
+	_, done, notify := g.eventsAfter(0)
+	assert.False(t, done)
+
+	// 事件可以跨多次写入，未结束的事件不会发布
+	fmt.Fprint(g, "data: \"Hel\"\n\ndata: \"lo\"\n\ndata: \"wor")
+	select {
+	case <-notify:
+	default:
+		t.Fatal("waiting clients are notified of new events")
+	}
+
+	events, done, _ := g.eventsAfter(0)
+	assert.Equal(t, []string{`data: "Hel"`, `data: "lo"`}, events)
+	assert.False(t, done)
+
+	fmt.Fprint(g, "ld\"\n\n")
+	events, _, _ = g.eventsAfter(1)
+	assert.Equal(t, []string{`data: "lo"`, `data: "world"`}, events, "replay starts after the last received event")
+
+	events, _, _ = g.eventsAfter(10)
+	assert.Empty(t, events, "a sequence beyond the buffer replays nothing")
+}
+
+func TestResumeGeneration(t *testing.T) {
+	g, err := startGeneration("owner-chat")
+	require.NoError(t, err)
+	fmt.Fprint(g, "data: \"one\"\n\ndata: \"two\"\n\ndata: [DONE]\n\n")
+	g.finish()
+
+	resume := func(chatID, lastEventID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/"+chatID+"/stream", nil)
+		r.Header.Set("Last-Event-ID", lastEventID)
+		w := httptest.NewRecorder()
+		require.True(t, resumeGeneration(w, r, chatID))
+		return w
+	}
+
+	w := resume("owner-chat", g.eventID(1))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id: "+g.eventID(2)+"\ndata: \"two\"\n\nid: "+g.eventID(3)+"\ndata: [DONE]\n\n", w.Body.String())
+
+	w = resume("other-chat", g.eventID(1))
+	assert.Equal(t, http.StatusNoContent, w.Code, "a generation cannot be resumed from another chat")
+
+	w = resume("owner-chat", "0000000000000000-1")
+	assert.Equal(t, http.StatusNoContent, w.Code, "unknown or expired generations end the stream")
+
+	w = resume("owner-chat", "not-a-number")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/chat/owner-chat/stream", nil)
+	assert.False(t, resumeGeneration(httptest.NewRecorder(), r, "owner-chat"), "requests without Last-Event-ID start a new reply")
+}
+
+func TestGenerationRetainedAfterFinish(t *testing.T) {
+	t.Setenv("GENERATION_RETENTION", "100ms")
+
+	g, err := startGeneration("retention-chat")
+	require.NoError(t, err)
+
+	fmt.Fprint(g, "data: \"done\"\n\ndata: [DONE]")
+	g.finish()
+
+	// 结束后仍可重放，包括没有以空行结束的最后一个事件
+	require.Same(t, g, findGeneration("retention-chat", g.id))
+	events, done, _ := g.eventsAfter(1)
+	assert.True(t, done)
+	assert.Equal(t, []string{"data: [DONE]"}, events)
+
+	assert.Eventually(t, func() bool {
+		return findGeneration("retention-chat", g.id) == nil
+	}, time.Second, 10*time.Millisecond, "output is dropped after the retention window")
+}
+
+func TestDetachedGenerationIsCanceled(t *testing.T) {
+	t.Setenv("GENERATION_DETACHED_TIMEOUT", "50ms")
+
+	t.Run("No client reconnects", func(t *testing.T) {
+		g, err := startGeneration("detached-chat")
+		require.NoError(t, err)
+		defer g.finish()
+
+		g.attach()
+		g.detach()
+		select {
+		case <-g.ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("generation without clients was not canceled")
+		}
+	})
+
+	t.Run("Client reconnects in time", func(t *testing.T) {
+		g, err := startGeneration("reattached-chat")
+		require.NoError(t, err)
+		defer g.finish()
+
+		g.attach()
+		g.detach()
+		g.attach()
+		select {
+		case <-g.ctx.Done():
+			t.Fatal("generation was canceled although a client reconnected")
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+
+	t.Run("Client leaves during the stream", func(t *testing.T) {
+		g, err := startGeneration("left-chat")
+		require.NoError(t, err)
+		defer g.finish()
+
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/left-chat/stream", nil)
+		ctx, leave := context.WithCancel(r.Context())
+		r = r.WithContext(ctx)
+		served := make(chan struct{})
+		go func() {
+			serveGeneration(httptest.NewRecorder(), r, g, 0)
+			close(served)
+		}()
+		fmt.Fprint(g, "data: \"partial\"\n\n")
+		leave()
+		<-served
+
+		select {
+		case <-g.ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("generation was not canceled after its only client left")
+		}
+	})
+}
@@ -2,10 +2,11 @@ package chat
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"backend/internal/auth"
@@ -19,72 +20,169 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// currentUser 从请求上下文获取已认证用户，失败时写入 401 响应
+func currentUser(w http.ResponseWriter, r *http.Request) (auth.UserClaims, bool) {
+	userClaims, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return userClaims, ok
+}
+
+// writeRepoError 将仓库错误转换为 HTTP 响应，越权访问与不存在一样返回 404
+func writeRepoError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, db.ErrChatNotFound) {
+		http.Error(w, "Chat not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, db.ErrMessageNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, db.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// 分页的默认和最大条数
+const (
+	defaultChatPageLimit    = 20
+	defaultMessagePageLimit = 50
+	maxPageLimit            = 100
+)
+
+// parsePageQuery 读取 before、after 和 limit 查询参数。三个参数都没有时返回 false，
+// 接口按原来的方式返回完整的数组。
+func parsePageQuery(r *http.Request, defaultLimit int) (models.PageQuery, bool, error) {
+	query := r.URL.Query()
+	q := models.PageQuery{
+		Before: query.Get("before"),
+		After:  query.Get("after"),
+		Limit:  defaultLimit,
+	}
+	limit := query.Get("limit")
+	if q.Before == "" && q.After == "" && limit == "" {
+		return q, false, nil
+	}
+
+	if q.Before != "" && q.After != "" {
+		return q, true, errors.New("before and after cannot be used together")
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return q, true, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		q.Limit = n
+	}
+	return q, true, nil
+}
+
 func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	repo := db.NewChatRepository()
-	history, err := repo.GetChatHistory(r.Context())
+
+	// 带分页参数时返回一页精简的聊天列表
+	q, paged, err := parsePageQuery(r, defaultChatPageLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if paged {
+		page, err := repo.ListChats(r.Context(), userClaims.Email, q)
+		if err != nil {
+			log.Printf("Error listing chats: %v", err)
+			writeRepoError(w, err, "Failed to get chat history")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+		return
+	}
+
+	history, err := repo.GetChatHistory(r.Context(), userClaims.Email)
 	if err != nil {
 		log.Printf("Error getting chat history: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if history == nil {
+		history = []models.Chat{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(history)
 }
 
 func CreateChatHandler(w http.ResponseWriter, r *http.Request) {
-	userClaims := r.Context().Value("user").(auth.UserClaims)
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
 	chatID := primitive.NewObjectID()
 
-	log.Printf("UserClaims: %v", userClaims)
-
-	// 解析请求体，允许客户端指定模型
+	// 解析请求体，允许客户端指定模型和角色
 	var req struct {
-		Title string `json:"title"`
-		Model string `json:"model"`
+		Title     string `json:"title"`
+		Model     string `json:"model"`
+		PersonaID string `json:"persona_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		// 如果请求体解析失败，使用默认值
-		req.Title = "New Chat"
-		req.Model = "gpt-3.5-turbo" // 默认模型
+		req.Title = ""
+		req.Model = ""
+		req.PersonaID = ""
 	}
 
-	// 如果没有提供标题，使用默认值
+	// 从角色创建的聊天在没有指定模型时使用角色的模型
+	if req.PersonaID != "" {
+		persona, err := db.NewPersonaRepository().GetPersona(r.Context(), userClaims.Email, req.PersonaID)
+		if err != nil {
+			log.Printf("Error getting persona %s: %v", req.PersonaID, err)
+			writePersonaError(w, err, "Failed to get persona")
+			return
+		}
+		if req.Model == "" {
+			req.Model = persona.Model
+		}
+	}
+
+	// 如果没有提供标题，使用默认值，第一轮问答后会自动生成标题
+	titleSource := models.TitleSourceUser
 	if req.Title == "" {
 		req.Title = "New Chat"
+		titleSource = ""
 	}
 
-	// 如果没有提供模型或模型无效，使用默认值
+	// 如果没有提供模型或模型无效，使用用户偏好的默认模型
+	prefs := loadPreferences(r.Context(), userClaims.Email)
 	if req.Model == "" {
-		req.Model = "gpt-3.5-turbo"
-	} else {
-		// 验证模型是否有效
-		validModels := models.GetAllValidModels()
-		isValidModel := false
-		for _, model := range validModels {
-			if model == req.Model {
-				isValidModel = true
-				break
-			}
-		}
-
-		if !isValidModel {
-			log.Printf("Invalid model specified: %s, using default model", req.Model)
-			req.Model = "gpt-3.5-turbo"
-		}
+		req.Model = defaultModel(prefs)
+	} else if !isValidModel(req.Model) {
+		log.Printf("Invalid model specified: %s, using default model", req.Model)
+		req.Model = defaultModel(prefs)
 	}
 
 	chat := &models.Chat{
-		ID:        chatID.Hex(),
-		UserID:    userClaims.Email,
-		Title:     req.Title,
-		Model:     req.Model,
-		CreatedAt: time.Now(),
+		ID:          chatID.Hex(),
+		UserID:      userClaims.Email,
+		Title:       req.Title,
+		TitleSource: titleSource,
+		Model:       req.Model,
+		PersonaID:   req.PersonaID,
+		CreatedAt:   time.Now(),
 	}
 
 	repo := db.NewChatRepository()
-	if err := repo.CreateChat(r.Context(), chat); err != nil {
+	if err := repo.CreateChat(r.Context(), userClaims.Email, chat); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -94,23 +192,50 @@ func CreateChatHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	chatID := vars["id"]
 
+	// 默认只返回当前分支，tree=true 时返回所有分支的消息
 	repo := db.NewChatRepository()
-	messages, err := repo.GetMessages(r.Context(), chatID)
+	tree := r.URL.Query().Get("tree") == "true"
+
+	// 带分页参数时返回一页消息和继续向前翻页的游标
+	q, paged, err := parsePageQuery(r, defaultMessagePageLimit)
 	if err != nil {
-		// 检查错误类型，如果是"没有找到消息"类型的错误，返回空数组而不是错误
-		if strings.Contains(err.Error(), "no documents") || strings.Contains(err.Error(), "not found") {
-			log.Printf("Chat %s exists but has no messages, returning empty array", chatID)
-			w.Header().Set("Content-Type", "application/json")
-			// 明确返回空数组，不要返回null
-			json.NewEncoder(w).Encode([]models.Message{})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if paged {
+		var page *models.MessagePage
+		if tree {
+			page, err = repo.GetMessagesPage(r.Context(), userClaims.Email, chatID, q)
+		} else {
+			page, err = repo.GetActivePathPage(r.Context(), userClaims.Email, chatID, q)
+		}
+		if err != nil {
+			log.Printf("Error getting messages: %v", err)
+			writeRepoError(w, err, "Failed to get messages")
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+		return
+	}
 
+	var messages []models.Message
+	if tree {
+		messages, err = repo.GetMessages(r.Context(), userClaims.Email, chatID)
+	} else {
+		messages, err = repo.GetActivePath(r.Context(), userClaims.Email, chatID)
+	}
+	if err != nil {
 		log.Printf("Error getting messages: %v", err)
-		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to get messages")
 		return
 	}
 
@@ -125,6 +250,11 @@ func GetChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	chatID := vars["id"]
 
@@ -135,37 +265,57 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Message string `json:"message"`
-		Model   string `json:"model"`
+		Message     string   `json:"message"`
+		Model       string   `json:"model"`
+		Language    string   `json:"language"`
+		Temperature *float64 `json:"temperature"`
+		// TemplateID 使用提示模板，Variables 为模板变量的值，Message 附加在模板之后
+		TemplateID string            `json:"template_id"`
+		Variables  map[string]string `json:"variables"`
+		// Attachments 此接口只发送文字，附件通过流式接口或 WebSocket 发送
+		Attachments []string `json:"attachments"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if err := validateTemperature(req.Temperature); err != nil {
+		http.Error(w, "Temperature must be between 0 and 2", http.StatusBadRequest)
+		return
+	}
+	if req.Language != "" && !models.IsValidLanguage(req.Language) {
+		http.Error(w, "Language must be english, chinese or auto", http.StatusBadRequest)
+		return
+	}
+	if len(req.Attachments) > 0 {
+		http.Error(w, "Attachments are only supported by the streaming and WebSocket endpoints", http.StatusBadRequest)
+		return
+	}
+
+	// 模板在发送时填充，填充后的内容作为用户消息保存和发送
+	content, err := applyTemplate(r.Context(), userClaims.Email, req.TemplateID, req.Variables, req.Message)
+	if err != nil {
+		log.Printf("Error applying prompt template: %v", err)
+		writeStartError(w, err)
+		return
+	}
+	req.Message = content
 
 	// 获取聊天仓库实例
 	repo := db.NewChatRepository()
 
-	// 获取聊天信息
-	chatInfo, err := repo.GetChat(r.Context(), chatID)
+	// 获取聊天信息，聊天必须已通过 /new 创建且属于当前用户
+	chatInfo, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
 	if err != nil {
-		log.Printf("Warning: Failed to get chat info: %v. Creating new record.", err)
-		// 如果聊天记录不存在，尝试创建一个新的
-		chatInfo = &models.Chat{
-			ID:        chatID,
-			Title:     "New Chat",
-			Model:     req.Model,
-			CreatedAt: time.Now(),
-		}
-		if err := repo.CreateChat(r.Context(), chatInfo); err != nil {
-			log.Printf("Error creating chat: %v", err)
-			http.Error(w, "Failed to create chat", http.StatusInternalServerError)
-			return
-		}
-	} else if chatInfo.Model == "" && req.Model != "" {
+		log.Printf("Error getting chat info: %v", err)
+		writeRepoError(w, err, "Failed to get chat information")
+		return
+	}
+
+	if chatInfo.Model == "" && req.Model != "" {
 		// 如果聊天存在但模型字段为空，使用请求中的模型
-		if err := repo.UpdateChatModel(r.Context(), chatID, req.Model); err != nil {
+		if err := repo.UpdateChatModel(r.Context(), userClaims.Email, chatID, req.Model); err != nil {
 			log.Printf("Error updating chat model: %v", err)
 			// 继续执行，不中断处理
 		} else {
@@ -173,7 +323,11 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 确定使用的模型: 优先使用聊天记录中的模型，其次是请求中的模型，最后是默认模型
+	prefs := loadPreferences(r.Context(), userClaims.Email)
+	persona := loadPersona(r.Context(), userClaims.Email, chatInfo.PersonaID)
+	instructions := chatInstructions(persona, prefs)
+
+	// 确定使用的模型: 优先使用聊天记录中的模型，其次是请求中的模型，最后是用户偏好的默认模型
 	model := chatInfo.Model
 	log.Printf("Initial model from chat history: %s", model)
 
@@ -183,7 +337,7 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if model == "" {
-		model = "gpt-3.5-turbo"
+		model = defaultModel(prefs)
 		log.Printf("Using default model: %s", model)
 	}
 
@@ -202,17 +356,35 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		Content: req.Message,
 	}
 
-	if err := repo.SaveMessage(r.Context(), userMessage); err != nil {
+	if err := repo.SaveMessage(r.Context(), userClaims.Email, userMessage); err != nil {
 		log.Printf("Error saving user message: %v", err)
-		http.Error(w, "Failed to save message", http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to save message")
 		return
 	}
 
+	// 请求中没有指定的参数使用用户偏好；语言和指令都未设置时保留服务默认的系统提示
+	language := req.Language
+	if language == "" {
+		language = prefs.Language
+	}
+	language = resolveLanguage(language, req.Message)
+
+	opts := services.CallOptions{Temperature: req.Temperature}
+	if opts.Temperature == nil && persona != nil {
+		opts.Temperature = persona.Temperature
+	}
+	if opts.Temperature == nil {
+		opts.Temperature = prefs.Temperature
+	}
+	if language != "" || instructions != "" {
+		opts.SystemPrompt = buildSystemPrompt(model, language, instructions)
+	}
+
 	// 使用服务接口调用相应的LLM服务
 	llmService := services.GetLLMService(model)
 	log.Printf("Using LLM service: %s for model: %s", llmService.GetModelProvider(), model)
 
-	aiResponse, apiErr := llmService.CallModel(req.Message, model)
+	aiResponse, apiErr := llmService.CallModel(r.Context(), req.Message, model, opts)
 	if apiErr != nil {
 		log.Printf("Error calling AI API: %v", apiErr)
 
@@ -221,12 +393,16 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 			strings.Contains(apiErr.Error(), "Anthropic API") ||
 			strings.Contains(apiErr.Error(), "No content received")) {
 			// 回退到使用OpenAI模型
-			fallbackModel := "gpt-3.5-turbo"
+			fallbackModel := models.DefaultChatModel
 			log.Printf("Falling back to %s due to Anthropic API error", fallbackModel)
 
+			if opts.SystemPrompt != "" {
+				opts.SystemPrompt = buildSystemPrompt(fallbackModel, language, instructions)
+			}
+
 			// 使用OpenAI服务
 			openaiService := &services.OpenAIService{}
-			fallbackResponse, fallbackErr := openaiService.CallModel(req.Message, fallbackModel)
+			fallbackResponse, fallbackErr := openaiService.CallModel(r.Context(), req.Message, fallbackModel, opts)
 
 			if fallbackErr != nil {
 				log.Printf("Error calling fallback model: %v", fallbackErr)
@@ -235,7 +411,7 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// 更新聊天记录中的模型
-			if err := repo.UpdateChatModel(r.Context(), chatID, fallbackModel); err != nil {
+			if err := repo.UpdateChatModel(r.Context(), userClaims.Email, chatID, fallbackModel); err != nil {
 				log.Printf("Error updating chat model to fallback: %v", err)
 			}
 
@@ -255,9 +431,9 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		Content: aiResponse,
 	}
 
-	if err := repo.SaveMessage(r.Context(), aiMessage); err != nil {
+	if err := repo.SaveMessage(r.Context(), userClaims.Email, aiMessage); err != nil {
 		log.Printf("Error saving AI message: %v", err)
-		http.Error(w, "Failed to save AI response", http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to save AI response")
 		return
 	}
 
@@ -268,6 +444,11 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateChatTitleHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	chatID := vars["id"]
 
@@ -282,9 +463,9 @@ func UpdateChatTitleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := db.NewChatRepository()
-	if err := repo.UpdateChatTitle(r.Context(), chatID, req.Title); err != nil {
+	if err := repo.UpdateChatTitle(r.Context(), userClaims.Email, chatID, req.Title, models.TitleSourceUser); err != nil {
 		log.Printf("Error updating chat title: %v", err)
-		http.Error(w, "Failed to update chat title", http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to update chat title")
 		return
 	}
 
@@ -294,13 +475,13 @@ func UpdateChatTitleHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// SendMessageStreamHandler 处理流式发送消息的请求
+// SendMessageStreamHandler 处理流式发送消息的请求，历史只包含当前分支上的消息。
+// 每个事件带有 ID，断线的客户端带上 Last-Event-ID 重新请求时继续接收同一个回复。
 func SendMessageStreamHandler(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
 
 	// 获取聊天ID
 	vars := mux.Vars(r)
@@ -313,288 +494,56 @@ func SendMessageStreamHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 获取聊天信息
 	repo := db.NewChatRepository()
-	chatInfo, err := repo.GetChat(r.Context(), chatID)
+	chatInfo, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
 	if err != nil {
 		log.Printf("Error getting chat info: %v", err)
-
-		// 如果找不到聊天记录，创建一个默认的记录
-		if strings.Contains(err.Error(), "no documents") || strings.Contains(err.Error(), "not found") {
-			log.Printf("Creating temporary chat info for streaming response, chat ID: %s", chatID)
-			chatInfo = &models.Chat{
-				ID:        chatID,
-				Title:     "New Chat",
-				CreatedAt: time.Now(),
-			}
-		} else {
-			// 如果是其他错误，返回错误信息
-			fmt.Fprintf(w, "data: ERROR: Failed to get chat information\n\n")
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
-			}
-			return
-		}
-	}
-
-	// 获取聊天历史
-	messages, err := repo.GetMessages(r.Context(), chatID)
-	if err != nil {
-		log.Printf("Error getting chat history: %v", err)
-		// 如果是"没有找到消息"类型的错误，设置为空数组
-		if strings.Contains(err.Error(), "no documents") || strings.Contains(err.Error(), "not found") {
-			log.Printf("No messages found for chat %s, using empty history", chatID)
-			messages = []models.Message{}
-		} else {
-			// 其他错误也设置为空数组，允许继续流式响应
-			messages = []models.Message{}
-		}
-	}
-
-	// 获取消息内容
-	message := r.URL.Query().Get("message")
-
-	// 使用聊天保存的模型，如果没有则使用查询参数中的模型作为备用
-	model := chatInfo.Model
-	if model == "" {
-		model = r.URL.Query().Get("model")
-		// 如果模型仍然为空，使用默认模型
-		if model == "" {
-			model = "gpt-3.5-turbo"
-		}
-
-		// 更新聊天的模型
-		err := repo.UpdateChatModel(r.Context(), chatID, model)
-		if err != nil {
-			log.Printf("Error updating chat model: %v", err)
-			// 继续执行，不中断处理
-		}
-	}
-
-	// 获取语言偏好
-	language := r.URL.Query().Get("language")
-	if language == "" {
-		language = "english" // Default to English, consistent with frontend
-	}
-
-	// Try to detect user input language (if frontend specifies auto or not specified)
-	if language == "auto" {
-		// Simple language detection: calculate the ratio of Chinese characters
-		// Chinese character range is roughly: \u4e00-\u9fff
-		totalChars := 0
-		chineseChars := 0
-
-		for _, r := range message {
-			if r > ' ' { // Ignore whitespace
-				totalChars++
-				if r >= 0x4e00 && r <= 0x9fff {
-					chineseChars++
-				}
-			}
-		}
-
-		// If Chinese characters are more than 15%, consider it Chinese input
-		if totalChars > 0 && float64(chineseChars)/float64(totalChars) > 0.15 {
-			language = "chinese"
-		} else {
-			language = "english"
-		}
-
-		log.Printf("Language auto-detection: total chars=%d, Chinese chars=%d, detected language=%s",
-			totalChars, chineseChars, language)
-	}
-
-	log.Printf("Received stream request for chat ID: %s, model: %s, language: %s", chatID, model, language)
-
-	// 保存用户消息到数据库
-	userMessage := &models.Message{
-		ChatID:    chatID,
-		Role:      "user",
-		Content:   message,
-		CreatedAt: time.Now(),
-	}
-
-	if err := repo.SaveMessage(r.Context(), userMessage); err != nil {
-		log.Printf("Error saving user message: %v", err)
-	}
-
-	// 设置响应头
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Build system prompt based on language preference and model information
-	systemPrompt := ""
-	if language == "english" {
-		systemPrompt = fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s. Please respond in English.", model, model)
-	} else {
-		systemPrompt = fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s. Please respond in Chinese.", model, model)
-	}
-
-	// 添加调试日志，确认模型和系统提示
-	log.Printf("Sending request with model: %s", model)
-	log.Printf("System prompt: %s", systemPrompt)
-
-	// Build complete message history, including system prompt
-	var fullMessages []models.Message
-	// Add system prompt
-	fullMessages = append(fullMessages, models.Message{
-		Role:    "system",
-		Content: systemPrompt,
-	})
-	// Add historical messages
-	fullMessages = append(fullMessages, messages...)
-	// Add current user message
-	fullMessages = append(fullMessages, *userMessage)
-
-	// 使用新的服务接口
-	llmService := services.GetLLMService(model)
-	log.Printf("Using LLM service: %s for model: %s", llmService.GetModelProvider(), model)
-
-	apiErr := llmService.CallModelStreamWithHistory(w, message, model, fullMessages)
-	if apiErr != nil {
-		log.Printf("Error calling AI stream: %v", apiErr)
-
-		// 检查是否是Claude模型错误，如果是，尝试回退到OpenAI
-		if models.IsAnthropicModel(model) && (strings.Contains(apiErr.Error(), "API key not found") ||
-			strings.Contains(apiErr.Error(), "Anthropic API") ||
-			strings.Contains(apiErr.Error(), "No content received")) {
-			// 回退到使用OpenAI模型
-			fallbackModel := "gpt-3.5-turbo"
-			log.Printf("Falling back to %s due to Anthropic API error", fallbackModel)
-
-			// 通知客户端
-			fmt.Fprintf(w, "data: ERROR: Claude模型不可用，正在使用%s代替\n\n", fallbackModel)
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
-			}
-
-			// 更新系统提示信息
-			for i, msg := range fullMessages {
-				if msg.Role == "system" {
-					if language == "english" {
-						fullMessages[i].Content = fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s. Please respond in English.", fallbackModel, fallbackModel)
-					} else {
-						fullMessages[i].Content = fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s. Please respond in Chinese.", fallbackModel, fallbackModel)
-					}
-					break
-				}
-			}
-
-			// 使用OpenAI服务
-			openaiService := &services.OpenAIService{}
-			fallbackErr := openaiService.CallModelStreamWithHistory(w, message, fallbackModel, fullMessages)
-
-			if fallbackErr != nil {
-				log.Printf("Error calling fallback model: %v", fallbackErr)
-				fmt.Fprintf(w, "data: ERROR: %s\n\n", fallbackErr.Error())
-				if f, ok := w.(http.Flusher); ok {
-					f.Flush()
-				}
-				return
-			}
-
-			// 更新聊天记录中的模型
-			if err := repo.UpdateChatModel(r.Context(), chatID, fallbackModel); err != nil {
-				log.Printf("Error updating chat model to fallback: %v", err)
-			}
-
-			log.Printf("Successfully used fallback model for chat ID: %s", chatID)
+		if errors.Is(err, db.ErrChatNotFound) {
+			http.Error(w, "Chat not found", http.StatusNotFound)
 			return
 		}
 
-		// 其他错误直接返回
-		fmt.Fprintf(w, "data: ERROR: %s\n\n", apiErr.Error())
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
-		}
+		// 如果是其他错误，返回错误信息
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeSSEError(w, "Failed to get chat information")
 		return
 	}
 
-	log.Printf("Stream completed for chat ID: %s", chatID)
-}
-
-// SaveAIMessageHandler 保存AI回复
-func SaveAIMessageHandler(w http.ResponseWriter, r *http.Request) {
-	// 设置CORS头
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-	// 处理预检请求
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	// 断线重连：重放错过的事件并继续接收，不发送新消息
+	if resumeGeneration(w, r, chatID) {
 		return
 	}
 
-	vars := mux.Vars(r)
-	chatID := vars["id"]
-
-	// 验证 chatID 是否有效
-	if chatID == "" {
-		log.Printf("Invalid chat ID in SaveAIMessageHandler")
-		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		Content string `json:"content"`
-	}
-
-	body, err := io.ReadAll(r.Body)
+	ro, err := replyOptionsFromQuery(r)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// 记录请求体用于调试
-	if len(body) > 100 {
-		log.Printf("SaveAIMessageHandler: Received AI message for chat %s, content length: %d, preview: %s...",
-			chatID, len(body), string(body)[:100])
-	} else if len(body) > 0 {
-		log.Printf("SaveAIMessageHandler: Received AI message for chat %s, content length: %d, full content: %s",
-			chatID, len(body), string(body))
-	} else {
-		log.Printf("SaveAIMessageHandler: Received empty AI message for chat %s", chatID)
-		http.Error(w, "Empty request body", http.StatusBadRequest)
+		http.Error(w, "Temperature must be between 0 and 2", http.StatusBadRequest)
 		return
 	}
 
-	if err := json.Unmarshal(body, &req); err != nil {
-		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if req.Content == "" {
-		log.Printf("Empty content in SaveAIMessageHandler for chat %s", chatID)
-		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+	// 使用提示模板时，模板中的变量由 var.<name> 参数提供
+	query := r.URL.Query()
+	content, err := applyTemplate(r.Context(), userClaims.Email, query.Get("template_id"), templateVarsFromQuery(r), query.Get("message"))
+	if err != nil {
+		log.Printf("Error applying prompt template: %v", err)
+		writeStartError(w, err)
 		return
 	}
 
-	// 保存 AI 回复
-	aiMessage := &models.Message{
-		ChatID:    chatID,
-		Role:      "assistant",
-		Content:   req.Content,
-		CreatedAt: time.Now(),
-	}
-
-	repo := db.NewChatRepository()
-	if err := repo.SaveMessage(r.Context(), aiMessage); err != nil {
-		log.Printf("Error saving AI message to chat %s: %v", chatID, err)
-		http.Error(w, "Failed to save message", http.StatusInternalServerError)
+	g, err := sendMessage(r.Context(), repo, userClaims.Email, chatInfo, content, parseAttachmentIDs(query.Get("attachments")), ro)
+	if err != nil {
+		log.Printf("Error starting generation: %v", err)
+		writeStartError(w, err)
 		return
 	}
-
-	log.Printf("Successfully saved AI message to chat %s, content length: %d", chatID, len(req.Content))
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	serveGeneration(w, r, g, 0)
 }
 
 // DeleteChatHandler 删除聊天
 func DeleteChatHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	chatID := vars["id"]
 
@@ -604,9 +553,9 @@ func DeleteChatHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := db.NewChatRepository()
-	if err := repo.DeleteChat(r.Context(), chatID); err != nil {
+	if err := repo.DeleteChat(r.Context(), userClaims.Email, chatID); err != nil {
 		log.Printf("Error deleting chat: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to delete chat")
 		return
 	}
 
@@ -616,6 +565,11 @@ func DeleteChatHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetChatInfoHandler 获取聊天信息
 func GetChatInfoHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	chatID := vars["id"]
 
@@ -625,27 +579,10 @@ func GetChatInfoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	repo := db.NewChatRepository()
-	chat, err := repo.GetChat(r.Context(), chatID)
+	chat, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
 	if err != nil {
-		// 如果是找不到聊天的错误，可能是数据库错误或真的不存在
 		log.Printf("Error getting chat info: %v", err)
-
-		// 尝试创建一个默认的聊天信息返回
-		if strings.Contains(err.Error(), "no documents") || strings.Contains(err.Error(), "not found") {
-			log.Printf("Creating default chat info for missing chat ID: %s", chatID)
-			defaultChat := &models.Chat{
-				ID:        chatID,
-				Title:     "New Chat",
-				CreatedAt: time.Now(),
-			}
-
-			// 不要试图保存这个默认聊天，只是返回给客户端
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(defaultChat)
-			return
-		}
-
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to get chat information")
 		return
 	}
 
@@ -655,6 +592,11 @@ func GetChatInfoHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdateChatModelHandler 更新聊天使用的模型
 func UpdateChatModelHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	chatID := vars["id"]
 
@@ -674,25 +616,16 @@ func UpdateChatModelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证模型是否有效
-	validModels := models.GetAllValidModels()
-	isValidModel := false
-	for _, model := range validModels {
-		if model == req.Model {
-			isValidModel = true
-			break
-		}
-	}
-
-	if !isValidModel {
+	if !isValidModel(req.Model) {
 		log.Printf("Invalid model: %s", req.Model)
 		http.Error(w, "Invalid model", http.StatusBadRequest)
 		return
 	}
 
 	repo := db.NewChatRepository()
-	if err := repo.UpdateChatModel(r.Context(), chatID, req.Model); err != nil {
+	if err := repo.UpdateChatModel(r.Context(), userClaims.Email, chatID, req.Model); err != nil {
 		log.Printf("Error updating chat model: %v", err)
-		http.Error(w, "Failed to update chat model", http.StatusInternalServerError)
+		writeRepoError(w, err, "Failed to update chat model")
 		return
 	}
 
@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// canManage 用户可以修改自己的角色和模板，全局的只有管理员可以修改
+func canManage(claims auth.UserClaims, ownerEmail string, global bool) bool {
+	if global {
+		return claims.HasPermission(auth.PermManageUsers)
+	}
+	return ownerEmail == claims.Email
+}
+
+// personaRequest 创建和修改角色的请求
+type personaRequest struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Instructions   string   `json:"instructions"`
+	Model          string   `json:"model"`
+	Temperature    *float64 `json:"temperature"`
+	StarterPrompts []string `json:"starter_prompts"`
+	Global         bool     `json:"global"`
+}
+
+// decodePersona 读取并检查角色请求，出错时已写入响应
+func decodePersona(w http.ResponseWriter, r *http.Request, claims auth.UserClaims) (*models.Persona, bool) {
+	var req personaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Instructions = strings.TrimSpace(req.Instructions)
+	req.Model = strings.TrimSpace(req.Model)
+
+	switch {
+	case req.Name == "" || len([]rune(req.Name)) > models.MaxPersonaNameLength:
+		http.Error(w, fmt.Sprintf("Name is required and must be at most %d characters", models.MaxPersonaNameLength), http.StatusBadRequest)
+		return nil, false
+	case len([]rune(req.Description)) > models.MaxPersonaDescriptionLength:
+		http.Error(w, fmt.Sprintf("Description must be at most %d characters", models.MaxPersonaDescriptionLength), http.StatusBadRequest)
+		return nil, false
+	case req.Instructions == "":
+		http.Error(w, "Instructions are required", http.StatusBadRequest)
+		return nil, false
+	case len([]rune(req.Instructions)) > maxInstructionsLength:
+		http.Error(w, fmt.Sprintf("Instructions must be at most %d characters", maxInstructionsLength), http.StatusBadRequest)
+		return nil, false
+	case req.Model != "" && !isValidModel(req.Model):
+		http.Error(w, "Invalid model", http.StatusBadRequest)
+		return nil, false
+	case validateTemperature(req.Temperature) != nil:
+		http.Error(w, "Temperature must be between 0 and 2", http.StatusBadRequest)
+		return nil, false
+	case req.Global && !claims.HasPermission(auth.PermManageUsers):
+		http.Error(w, "Only administrators can create global personas", http.StatusForbidden)
+		return nil, false
+	}
+
+	prompts := []string{}
+	for _, prompt := range req.StarterPrompts {
+		if prompt = strings.TrimSpace(prompt); prompt == "" {
+			continue
+		}
+		if len([]rune(prompt)) > models.MaxStarterPromptLength {
+			http.Error(w, fmt.Sprintf("Starter prompts must be at most %d characters", models.MaxStarterPromptLength), http.StatusBadRequest)
+			return nil, false
+		}
+		prompts = append(prompts, prompt)
+	}
+	if len(prompts) > models.MaxStarterPrompts {
+		http.Error(w, fmt.Sprintf("A persona can have at most %d starter prompts", models.MaxStarterPrompts), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &models.Persona{
+		OwnerEmail:     claims.Email,
+		Global:         req.Global,
+		Name:           req.Name,
+		Description:    req.Description,
+		Instructions:   req.Instructions,
+		Model:          req.Model,
+		Temperature:    req.Temperature,
+		StarterPrompts: prompts,
+	}, true
+}
+
+// writePersonaError 将角色仓库的错误转换为 HTTP 响应
+func writePersonaError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, db.ErrPersonaNotFound) {
+		http.Error(w, "Persona not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// loadPersona 获取聊天使用的角色，聊天没有角色或角色已被删除时返回 nil
+func loadPersona(ctx context.Context, email, personaID string) *models.Persona {
+	if personaID == "" {
+		return nil
+	}
+	persona, err := db.NewPersonaRepository().GetPersona(ctx, email, personaID)
+	if err != nil {
+		log.Printf("Error loading persona %s for %s: %v", personaID, email, err)
+		return nil
+	}
+	return persona
+}
+
+// chatInstructions 系统提示中的附加指令：角色的指令在前，用户的自定义指令在后
+func chatInstructions(persona *models.Persona, prefs models.UserPreferences) string {
+	if persona == nil {
+		return prefs.Instructions
+	}
+	if prefs.Instructions == "" {
+		return persona.Instructions
+	}
+	return persona.Instructions + "\n\n" + prefs.Instructions
+}
+
+// ListPersonasHandler 列出用户可用的角色，包括全局角色
+func ListPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	personas, err := db.NewPersonaRepository().ListPersonas(r.Context(), userClaims.Email)
+	if err != nil {
+		log.Printf("Error listing personas for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to list personas", http.StatusInternalServerError)
+		return
+	}
+	for i := range personas {
+		personas[i].Editable = canManage(userClaims, personas[i].OwnerEmail, personas[i].Global)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(personas)
+}
+
+// CreatePersonaHandler 创建角色，global 为 true 时需要管理员权限
+func CreatePersonaHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	persona, ok := decodePersona(w, r, userClaims)
+	if !ok {
+		return
+	}
+	if err := db.NewPersonaRepository().CreatePersona(r.Context(), persona); err != nil {
+		log.Printf("Error creating persona for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to create persona", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Created persona %s (global: %v) for %s", persona.ID, persona.Global, userClaims.Email)
+	persona.Editable = true
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(persona)
+}
+
+// UpdatePersonaHandler 替换角色的设置
+func UpdatePersonaHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	repo := db.NewPersonaRepository()
+	existing, err := repo.GetPersona(r.Context(), userClaims.Email, mux.Vars(r)["personaId"])
+	if err != nil {
+		writePersonaError(w, err, "Failed to update persona")
+		return
+	}
+	if !canManage(userClaims, existing.OwnerEmail, existing.Global) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	persona, ok := decodePersona(w, r, userClaims)
+	if !ok {
+		return
+	}
+	persona.ID = existing.ID
+	persona.OwnerEmail = existing.OwnerEmail
+	persona.CreatedAt = existing.CreatedAt
+	if err := repo.UpdatePersona(r.Context(), persona); err != nil {
+		log.Printf("Error updating persona %s: %v", persona.ID, err)
+		writePersonaError(w, err, "Failed to update persona")
+		return
+	}
+	persona.Editable = canManage(userClaims, persona.OwnerEmail, persona.Global)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(persona)
+}
+
+// DeletePersonaHandler 删除角色，使用它的聊天保留
+func DeletePersonaHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	repo := db.NewPersonaRepository()
+	persona, err := repo.GetPersona(r.Context(), userClaims.Email, mux.Vars(r)["personaId"])
+	if err != nil {
+		writePersonaError(w, err, "Failed to delete persona")
+		return
+	}
+	if !canManage(userClaims, persona.OwnerEmail, persona.Global) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err := repo.DeletePersona(r.Context(), persona.ID); err != nil {
+		log.Printf("Error deleting persona %s: %v", persona.ID, err)
+		writePersonaError(w, err, "Failed to delete persona")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Persona deleted successfully"})
+}
@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/db"
+	"backend/internal/models"
+)
+
+// 自定义指令的最大长度（字符数）
+const maxInstructionsLength = 4000
+
+// loadPreferences 获取用户偏好，没有保存过或读取失败时返回空偏好（全部使用默认值）
+func loadPreferences(ctx context.Context, email string) models.UserPreferences {
+	prefs, err := db.NewPreferencesRepository().GetPreferences(ctx, email)
+	if err != nil {
+		log.Printf("Error loading preferences for %s: %v", email, err)
+	}
+	if prefs == nil {
+		return models.UserPreferences{UserEmail: email}
+	}
+	return *prefs
+}
+
+// defaultModel 返回用户偏好的默认模型，没有设置时使用系统默认模型
+func defaultModel(prefs models.UserPreferences) string {
+	if prefs.DefaultModel != "" {
+		return prefs.DefaultModel
+	}
+	return models.DefaultChatModel
+}
+
+// isValidModel 检查模型是否在支持列表中
+func isValidModel(model string) bool {
+	for _, m := range models.GetAllValidModels() {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveLanguage 将 auto 解析为具体语言：中文字符超过 15% 时认为是中文输入
+func resolveLanguage(language, message string) string {
+	if language != models.LanguageAuto {
+		return language
+	}
+
+	// Chinese character range is roughly: \u4e00-\u9fff
+	totalChars := 0
+	chineseChars := 0
+	for _, r := range message {
+		if r > ' ' { // Ignore whitespace
+			totalChars++
+			if r >= 0x4e00 && r <= 0x9fff {
+				chineseChars++
+			}
+		}
+	}
+
+	detected := models.LanguageEnglish
+	if totalChars > 0 && float64(chineseChars)/float64(totalChars) > 0.15 {
+		detected = models.LanguageChinese
+	}
+
+	log.Printf("Language auto-detection: total chars=%d, Chinese chars=%d, detected language=%s",
+		totalChars, chineseChars, detected)
+	return detected
+}
+
+// buildSystemPrompt 生成包含模型身份、回复语言和用户自定义指令的系统提示
+func buildSystemPrompt(model, language, instructions string) string {
+	prompt := fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s.", model, model)
+	switch language {
+	case models.LanguageEnglish:
+		prompt += " Please respond in English."
+	case models.LanguageChinese:
+		prompt += " Please respond in Chinese."
+	}
+	if instructions != "" {
+		prompt += "\n\n" + instructions
+	}
+	return prompt
+}
+
+// parseTemperature 解析请求中的 temperature，未提供时返回 nil
+func parseTemperature(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid temperature %q", value)
+	}
+	if err := validateTemperature(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// validateTemperature temperature 必须在 0 到 2 之间
+func validateTemperature(t *float64) error {
+	if t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	return nil
+}
+
+// GetPreferencesHandler 获取当前用户的偏好设置，未设置的字段为空
+func GetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	prefs := loadPreferences(r.Context(), userClaims.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// UpdatePreferencesHandler 替换当前用户的偏好设置
+func UpdatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DefaultModel  string   `json:"default_model"`
+		Language      string   `json:"language"`
+		Instructions  string   `json:"instructions"`
+		Temperature   *float64 `json:"temperature"`
+		ContextPolicy string   `json:"context_policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.DefaultModel = strings.TrimSpace(req.DefaultModel)
+	req.Language = strings.ToLower(strings.TrimSpace(req.Language))
+	req.Instructions = strings.TrimSpace(req.Instructions)
+	req.ContextPolicy = strings.ToLower(strings.TrimSpace(req.ContextPolicy))
+
+	if req.DefaultModel != "" && !isValidModel(req.DefaultModel) {
+		http.Error(w, "Invalid model", http.StatusBadRequest)
+		return
+	}
+	if req.Language != "" && !models.IsValidLanguage(req.Language) {
+		http.Error(w, "Language must be english, chinese or auto", http.StatusBadRequest)
+		return
+	}
+	if len([]rune(req.Instructions)) > maxInstructionsLength {
+		http.Error(w, fmt.Sprintf("Instructions must be at most %d characters", maxInstructionsLength), http.StatusBadRequest)
+		return
+	}
+	if err := validateTemperature(req.Temperature); err != nil {
+		http.Error(w, "Temperature must be between 0 and 2", http.StatusBadRequest)
+		return
+	}
+	if req.ContextPolicy != "" && !models.IsValidContextPolicy(req.ContextPolicy) {
+		http.Error(w, "Context policy must be truncate or summarize", http.StatusBadRequest)
+		return
+	}
+
+	prefs := &models.UserPreferences{
+		UserEmail:     userClaims.Email,
+		DefaultModel:  req.DefaultModel,
+		Language:      req.Language,
+		Instructions:  req.Instructions,
+		Temperature:   req.Temperature,
+		ContextPolicy: req.ContextPolicy,
+	}
+	if err := db.NewPreferencesRepository().SavePreferences(r.Context(), prefs); err != nil {
+		log.Printf("Error saving preferences for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to save preferences", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// DeletePreferencesHandler 删除偏好设置，恢复默认值
+func DeletePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := db.NewPreferencesRepository().DeletePreferences(r.Context(), userClaims.Email); err != nil {
+		log.Printf("Error deleting preferences for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to reset preferences", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Preferences reset to defaults"})
+}
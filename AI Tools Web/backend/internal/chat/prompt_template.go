@@ -0,0 +1,227 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// templateVarPrefix 流式接口中模板变量的查询参数前缀，例如 var.topic=递归
+const templateVarPrefix = "var."
+
+// templateVarsFromQuery 读取查询参数中的模板变量
+func templateVarsFromQuery(r *http.Request) map[string]string {
+	values := make(map[string]string)
+	for key, v := range r.URL.Query() {
+		if name := strings.TrimPrefix(key, templateVarPrefix); name != key && len(v) > 0 {
+			values[name] = v[0]
+		}
+	}
+	return values
+}
+
+// applyTemplate 用变量填充模板作为消息内容，message 不为空时附加在模板之后。
+// 没有指定模板时原样返回 message；模板不存在或缺少变量时返回 *inputError。
+func applyTemplate(ctx context.Context, email, templateID string, values map[string]string, message string) (string, error) {
+	if templateID == "" {
+		return message, nil
+	}
+
+	template, err := db.NewPromptTemplateRepository().GetTemplate(ctx, email, templateID)
+	if err != nil {
+		if errors.Is(err, db.ErrTemplateNotFound) {
+			return "", &inputError{"Prompt template not found"}
+		}
+		return "", err
+	}
+
+	content, err := models.FillTemplate(template.Content, values)
+	if err != nil {
+		if errors.Is(err, models.ErrMissingTemplateVariables) {
+			return "", &inputError{fmt.Sprintf("Missing values for template variables: %s", strings.Join(missingVariables(template.Variables, values), ", "))}
+		}
+		return "", err
+	}
+	if message = strings.TrimSpace(message); message != "" {
+		content += "\n\n" + message
+	}
+	return content, nil
+}
+
+// missingVariables 没有值的模板变量
+func missingVariables(variables []string, values map[string]string) []string {
+	var missing []string
+	for _, name := range variables {
+		if strings.TrimSpace(values[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// decodeTemplate 读取并检查模板请求，出错时已写入响应
+func decodeTemplate(w http.ResponseWriter, r *http.Request, claims auth.UserClaims) (*models.PromptTemplate, bool) {
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Content     string `json:"content"`
+		Global      bool   `json:"global"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Content = strings.TrimSpace(req.Content)
+
+	switch {
+	case req.Name == "" || len([]rune(req.Name)) > models.MaxTemplateNameLength:
+		http.Error(w, fmt.Sprintf("Name is required and must be at most %d characters", models.MaxTemplateNameLength), http.StatusBadRequest)
+		return nil, false
+	case len([]rune(req.Description)) > models.MaxPersonaDescriptionLength:
+		http.Error(w, fmt.Sprintf("Description must be at most %d characters", models.MaxPersonaDescriptionLength), http.StatusBadRequest)
+		return nil, false
+	case req.Content == "" || len([]rune(req.Content)) > models.MaxTemplateContentLength:
+		http.Error(w, fmt.Sprintf("Content is required and must be at most %d characters", models.MaxTemplateContentLength), http.StatusBadRequest)
+		return nil, false
+	case req.Global && !claims.HasPermission(auth.PermManageUsers):
+		http.Error(w, "Only administrators can create global templates", http.StatusForbidden)
+		return nil, false
+	}
+
+	return &models.PromptTemplate{
+		OwnerEmail:  claims.Email,
+		Global:      req.Global,
+		Name:        req.Name,
+		Description: req.Description,
+		Content:     req.Content,
+	}, true
+}
+
+// writeTemplateError 将模板仓库的错误转换为 HTTP 响应
+func writeTemplateError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, db.ErrTemplateNotFound) {
+		http.Error(w, "Prompt template not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// ListTemplatesHandler 列出用户可用的提示模板，包括全局模板
+func ListTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	templates, err := db.NewPromptTemplateRepository().ListTemplates(r.Context(), userClaims.Email)
+	if err != nil {
+		log.Printf("Error listing prompt templates for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to list prompt templates", http.StatusInternalServerError)
+		return
+	}
+	for i := range templates {
+		templates[i].Editable = canManage(userClaims, templates[i].OwnerEmail, templates[i].Global)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// CreateTemplateHandler 创建提示模板，global 为 true 时需要管理员权限
+func CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	template, ok := decodeTemplate(w, r, userClaims)
+	if !ok {
+		return
+	}
+	if err := db.NewPromptTemplateRepository().CreateTemplate(r.Context(), template); err != nil {
+		log.Printf("Error creating prompt template for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to create prompt template", http.StatusInternalServerError)
+		return
+	}
+	template.Editable = true
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+// UpdateTemplateHandler 替换提示模板
+func UpdateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	repo := db.NewPromptTemplateRepository()
+	existing, err := repo.GetTemplate(r.Context(), userClaims.Email, mux.Vars(r)["templateId"])
+	if err != nil {
+		writeTemplateError(w, err, "Failed to update prompt template")
+		return
+	}
+	if !canManage(userClaims, existing.OwnerEmail, existing.Global) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	template, ok := decodeTemplate(w, r, userClaims)
+	if !ok {
+		return
+	}
+	template.ID = existing.ID
+	template.OwnerEmail = existing.OwnerEmail
+	template.CreatedAt = existing.CreatedAt
+	if err := repo.UpdateTemplate(r.Context(), template); err != nil {
+		log.Printf("Error updating prompt template %s: %v", template.ID, err)
+		writeTemplateError(w, err, "Failed to update prompt template")
+		return
+	}
+	template.Editable = canManage(userClaims, template.OwnerEmail, template.Global)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+// DeleteTemplateHandler 删除提示模板
+func DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	repo := db.NewPromptTemplateRepository()
+	template, err := repo.GetTemplate(r.Context(), userClaims.Email, mux.Vars(r)["templateId"])
+	if err != nil {
+		writeTemplateError(w, err, "Failed to delete prompt template")
+		return
+	}
+	if !canManage(userClaims, template.OwnerEmail, template.Global) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err := repo.DeleteTemplate(r.Context(), template.ID); err != nil {
+		log.Printf("Error deleting prompt template %s: %v", template.ID, err)
+		writeTemplateError(w, err, "Failed to delete prompt template")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Prompt template deleted successfully"})
+}
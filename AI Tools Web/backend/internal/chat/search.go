@@ -0,0 +1,247 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/services"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	// 查询的最大长度（字符数）
+	maxSearchQueryLength = 200
+	// 结果片段的长度（字符数）
+	snippetLength = 160
+	// 每次语义搜索最多为多少条新消息生成向量，其余的在之后的搜索中补上
+	embeddingBackfillLimit = 256
+	// 每次请求向量接口的消息数
+	embeddingBatchSize = 64
+	// 生成向量时每条消息最多使用的字符数
+	embeddingInputLength = 3000
+	// 相似度低于该值的消息不算匹配
+	minSemanticScore = 0.25
+)
+
+// searchParams 解析后的搜索参数
+type searchParams struct {
+	query string
+	mode  string
+	page  int
+	limit int
+}
+
+// parseSearchParams 读取 q、mode、page 和 limit 查询参数
+func parseSearchParams(r *http.Request) (searchParams, error) {
+	query := r.URL.Query()
+	p := searchParams{
+		query: strings.TrimSpace(query.Get("q")),
+		mode:  query.Get("mode"),
+		page:  1,
+		limit: defaultSearchLimit,
+	}
+
+	if p.query == "" {
+		return p, errors.New("q is required")
+	}
+	if len([]rune(p.query)) > maxSearchQueryLength {
+		return p, fmt.Errorf("q must be at most %d characters", maxSearchQueryLength)
+	}
+	if p.mode == "" {
+		p.mode = models.SearchModeText
+	}
+	if p.mode != models.SearchModeText && p.mode != models.SearchModeSemantic {
+		return p, errors.New("mode must be text or semantic")
+	}
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return p, errors.New("page must be a positive integer")
+		}
+		p.page = page
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+		}
+		p.limit = limit
+	}
+	return p, nil
+}
+
+// SearchHandler 搜索当前用户所有聊天中的消息 (/api/chat/search)。
+// mode=text（默认）使用全文索引，mode=semantic 按意思匹配；结果带有所在聊天的标题和高亮片段，按 page 和 limit 分页。
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	params, err := parseSearchParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewChatRepository()
+	titles, err := repo.ChatTitles(r.Context(), userClaims.Email)
+	if err != nil {
+		log.Printf("Error listing chats for search: %v", err)
+		http.Error(w, "Failed to search messages", http.StatusInternalServerError)
+		return
+	}
+	chatIDs := make([]string, 0, len(titles))
+	for id := range titles {
+		chatIDs = append(chatIDs, id)
+	}
+
+	response := models.SearchResponse{
+		Query:   params.query,
+		Mode:    params.mode,
+		Results: []models.SearchResult{},
+		Page:    params.page,
+		Limit:   params.limit,
+	}
+
+	var hits []models.SearchHit
+	skip := (params.page - 1) * params.limit
+	if params.mode == models.SearchModeSemantic {
+		if !services.EmbeddingsAvailable() {
+			http.Error(w, "Semantic search is not available", http.StatusServiceUnavailable)
+			return
+		}
+		hits, response.Total, response.Pending, err = semanticSearch(r.Context(), repo, userClaims.Email, chatIDs, params.query, skip, params.limit)
+	} else {
+		hits, response.Total, err = repo.SearchMessages(r.Context(), chatIDs, params.query, skip, params.limit)
+	}
+	if err != nil {
+		log.Printf("Error searching messages for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to search messages", http.StatusInternalServerError)
+		return
+	}
+
+	terms := models.SearchTerms(params.query)
+	for _, hit := range hits {
+		response.Results = append(response.Results, models.SearchResult{
+			ChatID:    hit.Message.ChatID,
+			ChatTitle: titles[hit.Message.ChatID],
+			MessageID: hit.Message.ID,
+			Role:      hit.Message.Role,
+			CreatedAt: hit.Message.CreatedAt,
+			Score:     hit.Score,
+			Snippet:   models.BuildSnippet(hit.Message.Content, terms, snippetLength),
+		})
+	}
+	response.HasMore = int64(skip+len(hits)) < response.Total
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// semanticSearch 按与查询的向量相似度搜索消息。还没有向量的消息先补建一部分，
+// 返回当前页的结果、匹配总数和仍未建立向量的消息数。
+func semanticSearch(ctx context.Context, repo *db.ChatRepository, email string, chatIDs []string, query string, skip, limit int) ([]models.SearchHit, int64, int64, error) {
+	embeddings := db.NewEmbeddingRepository()
+	model := services.EmbeddingModel()
+
+	pending, err := backfillEmbeddings(ctx, embeddings, email, model, chatIDs)
+	if err != nil {
+		// 补建失败时仍然搜索已有的向量
+		log.Printf("Error embedding messages for %s: %v", email, err)
+	}
+
+	vectors, err := services.CreateEmbeddings(ctx, []string{query})
+	if err != nil {
+		return nil, 0, pending, err
+	}
+	queryVector := vectors[0]
+
+	stored, err := embeddings.UserEmbeddings(ctx, email, model)
+	if err != nil {
+		return nil, 0, pending, err
+	}
+
+	var ranked []models.SearchHit
+	for _, e := range stored {
+		if score := models.CosineSimilarity(queryVector, e.Vector); score >= minSemanticScore {
+			ranked = append(ranked, models.SearchHit{Message: models.Message{ID: e.MessageID, ChatID: e.ChatID}, Score: score})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+
+	total := int64(len(ranked))
+	if skip >= len(ranked) {
+		return nil, total, pending, nil
+	}
+	page := ranked[skip:min(skip+limit, len(ranked))]
+
+	ids := make([]string, len(page))
+	for i, hit := range page {
+		ids[i] = hit.Message.ID
+	}
+	messages, err := repo.FindMessagesByID(ctx, chatIDs, ids)
+	if err != nil {
+		return nil, 0, pending, err
+	}
+
+	hits := make([]models.SearchHit, 0, len(page))
+	for _, hit := range page {
+		if m, ok := messages[hit.Message.ID]; ok {
+			hits = append(hits, models.SearchHit{Message: m, Score: hit.Score})
+		}
+	}
+	return hits, total, pending, nil
+}
+
+// backfillEmbeddings 为最多 embeddingBackfillLimit 条还没有向量的消息生成向量，返回剩余的数量
+func backfillEmbeddings(ctx context.Context, embeddings *db.EmbeddingRepository, email, model string, chatIDs []string) (int64, error) {
+	messages, total, err := embeddings.UnembeddedMessages(ctx, email, model, chatIDs, embeddingBackfillLimit)
+	if err != nil || len(messages) == 0 {
+		return total, err
+	}
+
+	done := 0
+	for start := 0; start < len(messages); start += embeddingBatchSize {
+		batch := messages[start:min(start+embeddingBatchSize, len(messages))]
+		inputs := make([]string, len(batch))
+		for i, m := range batch {
+			inputs[i] = truncateRunes(m.Content, embeddingInputLength)
+		}
+
+		vectors, err := services.CreateEmbeddings(ctx, inputs)
+		if err != nil {
+			return total - int64(done), err
+		}
+
+		records := make([]models.MessageEmbedding, len(batch))
+		for i, m := range batch {
+			records[i] = models.MessageEmbedding{
+				MessageID: m.ID,
+				ChatID:    m.ChatID,
+				UserID:    email,
+				Model:     model,
+				Vector:    vectors[i],
+				CreatedAt: time.Now(),
+			}
+		}
+		if err := embeddings.SaveEmbeddings(ctx, records); err != nil {
+			return total - int64(done), err
+		}
+		done += len(batch)
+	}
+
+	log.Printf("Embedded %d messages for %s, %d remaining", done, email, total-int64(done))
+	return total - int64(done), nil
+}
@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// 每个聊天最多同时存在的分享数量
+const maxSharesPerChat = 20
+
+// CreateShareHandler 为聊天创建公开只读分享链接，分享的是当前分支此刻的快照。
+// expires_in_days 为 0 表示永不过期；链接只在这里返回一次。
+func CreateShareHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	chatID := mux.Vars(r)["id"]
+
+	var req struct {
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+	// 请求体可以为空
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+		http.Error(w, "expires_in_days must be between 0 and 365", http.StatusBadRequest)
+		return
+	}
+
+	repo := db.NewChatRepository()
+	chat, err := repo.GetChat(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		writeRepoError(w, err, "Failed to share chat")
+		return
+	}
+	path, err := repo.GetActivePath(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error loading messages to share chat %s: %v", chatID, err)
+		writeRepoError(w, err, "Failed to share chat")
+		return
+	}
+	if len(path) == 0 {
+		http.Error(w, "Cannot share a chat without messages", http.StatusBadRequest)
+		return
+	}
+
+	shares := db.NewShareRepository()
+	count, err := shares.CountChatShares(r.Context(), userClaims.Email, chatID)
+	if err != nil {
+		log.Printf("Error counting shares of chat %s: %v", chatID, err)
+		http.Error(w, "Failed to share chat", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxSharesPerChat {
+		http.Error(w, fmt.Sprintf("A chat can have at most %d share links", maxSharesPerChat), http.StatusConflict)
+		return
+	}
+
+	token, tokenHash, err := auth.NewShareToken()
+	if err != nil {
+		log.Printf("Error generating share token: %v", err)
+		http.Error(w, "Failed to share chat", http.StatusInternalServerError)
+		return
+	}
+
+	share := &models.ChatShare{
+		UserEmail: userClaims.Email,
+		ChatID:    chat.ID,
+		Title:     chat.Title,
+		Model:     chat.Model,
+		Prefix:    token[:len(auth.ShareTokenPrefix)+6],
+		TokenHash: tokenHash,
+		Messages:  models.SnapshotMessages(path),
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := share.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		share.ExpiresAt = &expiresAt
+	}
+
+	if err := shares.CreateShare(r.Context(), share); err != nil {
+		log.Printf("Error saving share of chat %s: %v", chatID, err)
+		http.Error(w, "Failed to share chat", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Created share %s of chat %s for user %s", share.ID, chatID, userClaims.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"share": share,
+		"token": token,
+		"url":   auth.ShareURL(token),
+	})
+}
+
+// ListSharesHandler 列出当前用户未过期的分享，可用 chat_id 参数只列出一个聊天的分享
+func ListSharesHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := db.NewShareRepository().ListShares(r.Context(), userClaims.Email, r.URL.Query().Get("chat_id"))
+	if err != nil {
+		log.Printf("Error listing shares for %s: %v", userClaims.Email, err)
+		http.Error(w, "Failed to list shares", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// DeleteShareHandler 撤销分享，链接立即失效
+func DeleteShareHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	shareID := mux.Vars(r)["shareId"]
+	if err := db.NewShareRepository().DeleteShare(r.Context(), userClaims.Email, shareID); err != nil {
+		if errors.Is(err, db.ErrShareNotFound) {
+			http.Error(w, "Share not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error deleting share %s: %v", shareID, err)
+		http.Error(w, "Failed to revoke share", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Revoked share %s for user %s", shareID, userClaims.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Share revoked successfully",
+	})
+}
+
+// GetSharedChatHandler 不需要登录，按分享令牌返回聊天快照。
+// 令牌无效、已过期或已撤销时一律返回 404。
+func GetSharedChatHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	if !strings.HasPrefix(token, auth.ShareTokenPrefix) {
+		http.Error(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	share, err := db.NewShareRepository().GetShareByHash(r.Context(), auth.HashShareToken(token))
+	if err != nil {
+		if errors.Is(err, db.ErrShareNotFound) {
+			http.Error(w, "Share not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error loading shared chat: %v", err)
+		http.Error(w, "Failed to load shared chat", http.StatusInternalServerError)
+		return
+	}
+
+	// 撤销后不能再从缓存中看到，也不希望被搜索引擎收录
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(share.View())
+}
@@ -0,0 +1,313 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/services"
+)
+
+// 保存生成结果的超时时间
+const saveReplyTimeout = 10 * time.Second
+
+// streamConfig 一次流式回复使用的模型、语言和调用参数
+type streamConfig struct {
+	model    string
+	language string
+	prefs    models.UserPreferences
+	// instructions 角色和用户的自定义指令，附加到系统提示中
+	instructions string
+	opts         services.CallOptions
+}
+
+// replyOptions 客户端为一次回复指定的参数，为空时使用聊天设置和用户偏好
+type replyOptions struct {
+	Model       string
+	Language    string
+	Temperature *float64
+}
+
+// replyOptionsFromQuery 读取查询参数中的 model、language 和 temperature
+func replyOptionsFromQuery(r *http.Request) (replyOptions, error) {
+	query := r.URL.Query()
+	temperature, err := parseTemperature(query.Get("temperature"))
+	if err != nil {
+		return replyOptions{}, err
+	}
+	return replyOptions{
+		Model:       query.Get("model"),
+		Language:    query.Get("language"),
+		Temperature: temperature,
+	}, nil
+}
+
+// resolveStreamConfig 确定回复使用的模型、语言和 temperature，未指定的使用聊天设置、聊天的角色和用户偏好。
+// message 用于自动检测回复语言。
+func resolveStreamConfig(ctx context.Context, repo *db.ChatRepository, email string, chatInfo *models.Chat, message string, ro replyOptions) streamConfig {
+	cfg := streamConfig{prefs: loadPreferences(ctx, email)}
+	persona := loadPersona(ctx, email, chatInfo.PersonaID)
+	cfg.instructions = chatInstructions(persona, cfg.prefs)
+
+	// 使用聊天保存的模型，如果没有则使用请求中的模型作为备用
+	cfg.model = chatInfo.Model
+	if cfg.model == "" {
+		cfg.model = ro.Model
+		// 如果模型仍然为空，使用用户偏好的默认模型
+		if cfg.model == "" {
+			cfg.model = defaultModel(cfg.prefs)
+		}
+
+		// 更新聊天的模型
+		if err := repo.UpdateChatModel(ctx, email, chatInfo.ID, cfg.model); err != nil {
+			log.Printf("Error updating chat model: %v", err)
+			// 继续执行，不中断处理
+		}
+		chatInfo.Model = cfg.model
+	}
+
+	// 获取语言偏好：请求参数优先，其次是用户偏好
+	language := ro.Language
+	if language == "" {
+		language = cfg.prefs.Language
+	}
+	if language == "" {
+		language = models.DefaultLanguage
+	}
+	cfg.language = resolveLanguage(language, message)
+
+	// temperature 同样优先使用请求参数，其次是角色的设置
+	temperature := ro.Temperature
+	if temperature == nil && persona != nil {
+		temperature = persona.Temperature
+	}
+	if temperature == nil {
+		temperature = cfg.prefs.Temperature
+	}
+	cfg.opts = services.CallOptions{Temperature: temperature}
+	return cfg
+}
+
+// sendMessage 把用户消息（带有 attachmentIDs 引用的附件）追加到当前分支末尾，并在后台开始生成回复。
+// 附件无效或模型不支持图片时返回 *inputError，不保存消息；用户消息保存失败时不开始生成。
+func sendMessage(ctx context.Context, repo *db.ChatRepository, email string, chatInfo *models.Chat, content string, attachmentIDs []string, ro replyOptions) (*generation, error) {
+	attachments, err := loadAttachmentRefs(ctx, email, chatInfo.ID, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := resolveStreamConfig(ctx, repo, email, chatInfo, content, ro)
+	log.Printf("Received stream request for chat ID: %s, model: %s, language: %s", chatInfo.ID, cfg.model, cfg.language)
+
+	// 获取当前分支的历史
+	history, err := repo.GetActivePath(ctx, email, chatInfo.ID)
+	if err != nil {
+		// 获取历史失败时使用空历史，允许继续流式响应
+		log.Printf("Error getting chat history: %v", err)
+		history = nil
+	}
+
+	// 保存用户消息到数据库，追加在当前分支末尾
+	userMessage := &models.Message{
+		ChatID:      chatInfo.ID,
+		Role:        "user",
+		Content:     content,
+		Attachments: attachments,
+		CreatedAt:   time.Now(),
+	}
+	if err := checkVision(cfg.model, append(history, *userMessage)); err != nil {
+		return nil, err
+	}
+	// 先取消附件的过期时间再保存消息，避免消息引用的附件在 24 小时后被删除
+	if len(attachments) > 0 {
+		ids := make([]string, len(attachments))
+		for i, a := range attachments {
+			ids[i] = a.ID
+		}
+		if err := db.NewAttachmentRepository().BindAttachments(ctx, email, chatInfo.ID, ids); err != nil {
+			if errors.Is(err, db.ErrAttachmentNotFound) {
+				return nil, &inputError{"Attachment not found or expired"}
+			}
+			return nil, fmt.Errorf("failed to bind attachments: %w", err)
+		}
+	}
+	// 回复挂在用户消息下，用户消息没有保存时不能开始生成
+	if err := repo.SaveMessage(ctx, email, userMessage); err != nil {
+		return nil, fmt.Errorf("failed to save user message: %w", err)
+	}
+
+	return startReply(repo, email, chatInfo.ID, cfg, append(history, *userMessage))
+}
+
+// writeSSEError 以 SSE 数据的形式向客户端发送错误
+func writeSSEError(w http.ResponseWriter, message string) {
+	fmt.Fprintf(w, "data: ERROR: %s\n\n", message)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeSSEDone 发送流结束标记
+func writeSSEDone(w http.ResponseWriter) {
+	fmt.Fprintf(w, "data: [DONE]\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// startReply 基于 history（当前分支上的消息，最后一条是要回复的用户消息）在后台生成回复，
+// 并把回复保存在该用户消息下
+func startReply(repo *db.ChatRepository, email, chatID string, cfg streamConfig, history []models.Message) (*generation, error) {
+	if err := checkVision(cfg.model, history); err != nil {
+		return nil, err
+	}
+	g, err := startGeneration(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer g.finish()
+		g.setReply(runGeneration(g, repo, email, chatID, cfg, history))
+	}()
+	return g, nil
+}
+
+// streamReply 开始生成回复并以 SSE 发送给客户端。客户端断线后可以用 Last-Event-ID 继续接收。
+func streamReply(w http.ResponseWriter, r *http.Request, repo *db.ChatRepository, email, chatID string, cfg streamConfig, history []models.Message) {
+	g, err := startReply(repo, email, chatID, cfg, history)
+	if err != nil {
+		log.Printf("Error starting generation: %v", err)
+		writeStartError(w, err)
+		return
+	}
+	serveGeneration(w, r, g, 0)
+}
+
+// runGeneration 调用模型服务生成回复并保存，返回保存的消息（没有生成内容时为 nil）。
+// Anthropic 模型不可用时回退到默认的 OpenAI 模型。
+func runGeneration(g *generation, repo *db.ChatRepository, email, chatID string, cfg streamConfig, history []models.Message) *models.Message {
+	message, parentID := "", ""
+	if len(history) > 0 {
+		message = history[len(history)-1].Content
+		parentID = history[len(history)-1].ID
+	}
+
+	// 读取附件内容：图片由服务按多模态格式发送，文本文件附加到消息中
+	history = expandAttachments(g.ctx, chatID, history)
+
+	// 历史超出模型上下文时按用户的策略截断或摘要，并告诉客户端
+	fullMessages, contextInfo := buildContext(g.ctx, repo, email, chatID, cfg, history)
+	if contextInfo != nil {
+		writeSSEContext(g, contextInfo)
+	}
+
+	// 使用新的服务接口
+	llmService := services.GetLLMService(cfg.model)
+	log.Printf("Using LLM service: %s for model: %s (generation %s)", llmService.GetModelProvider(), cfg.model, g.id)
+
+	// 调用 /stop 或长时间没有客户端连接时 g.ctx 被取消，对模型服务的请求随之中止
+	reply, apiErr := llmService.CallModelStreamWithHistory(g.ctx, g, message, cfg.model, fullMessages, cfg.opts)
+	switch {
+	case apiErr == nil:
+	case g.ctx.Err() != nil:
+		// 被停止的生成正常结束流，已生成的部分在下面保存
+		log.Printf("Generation in chat %s canceled after %d characters", chatID, len(reply))
+		writeSSEDone(g)
+	case reply == "" && models.IsAnthropicModel(cfg.model) && (strings.Contains(apiErr.Error(), "API key not found") ||
+		strings.Contains(apiErr.Error(), "Anthropic API") ||
+		strings.Contains(apiErr.Error(), "No content received")):
+		// Claude模型错误，尝试回退到OpenAI
+		log.Printf("Error calling AI stream: %v", apiErr)
+		reply, contextInfo, apiErr = streamFallback(g, repo, email, chatID, cfg, history, message)
+	default:
+		// 其他错误直接返回
+		log.Printf("Error calling AI stream: %v", apiErr)
+		writeSSEError(g, apiErr.Error())
+	}
+
+	saved := saveReply(repo, email, chatID, parentID, reply, apiErr, contextInfo)
+	log.Printf("Stream completed for chat ID: %s", chatID)
+
+	// 第一轮完整的问答结束后生成标题，标题事件在 [DONE] 之后发送
+	if saved != nil && saved.Status == "" && len(history) == 1 {
+		generateTitle(g, repo, email, chatID, message, reply)
+	}
+	return saved
+}
+
+// streamFallback 使用默认的 OpenAI 模型重新生成回复。默认模型的上下文可能更小，历史按它重新组装。
+func streamFallback(g *generation, repo *db.ChatRepository, email, chatID string, cfg streamConfig, history []models.Message, message string) (string, *models.ContextInfo, error) {
+	// 回退到使用OpenAI模型，有图片时使用支持视觉的模型
+	fallbackModel := models.DefaultChatModel
+	if models.HasImages(history) {
+		fallbackModel = models.ModelGPT4o
+	}
+	log.Printf("Falling back to %s due to Anthropic API error", fallbackModel)
+
+	// 通知客户端
+	writeSSEError(g, fmt.Sprintf("Claude模型不可用，正在使用%s代替", fallbackModel))
+
+	// 按回退模型重新生成系统提示和历史
+	fallbackCfg := cfg
+	fallbackCfg.model = fallbackModel
+	fullMessages, contextInfo := buildContext(g.ctx, repo, email, chatID, fallbackCfg, history)
+	if contextInfo != nil {
+		writeSSEContext(g, contextInfo)
+	}
+
+	// 使用OpenAI服务
+	openaiService := &services.OpenAIService{}
+	reply, err := openaiService.CallModelStreamWithHistory(g.ctx, g, message, fallbackModel, fullMessages, cfg.opts)
+	if err != nil {
+		log.Printf("Error calling fallback model: %v", err)
+		if g.ctx.Err() != nil {
+			writeSSEDone(g)
+		} else {
+			writeSSEError(g, err.Error())
+		}
+		return reply, contextInfo, err
+	}
+
+	// 更新聊天记录中的模型
+	if err := repo.UpdateChatModel(g.ctx, email, chatID, fallbackModel); err != nil {
+		log.Printf("Error updating chat model to fallback: %v", err)
+	}
+
+	log.Printf("Successfully used fallback model for chat ID: %s", chatID)
+	return reply, contextInfo, nil
+}
+
+// saveReply 保存流式生成的回复，流中断或被停止时保存已收到的部分并标记为 incomplete。
+// contextInfo 记录生成时较早的历史是否被摘要或省略。
+func saveReply(repo *db.ChatRepository, email, chatID, parentID, reply string, streamErr error, contextInfo *models.ContextInfo) *models.Message {
+	if reply == "" {
+		return nil
+	}
+
+	aiMessage := &models.Message{
+		ChatID:   chatID,
+		Role:     "assistant",
+		Content:  reply,
+		ParentID: parentID,
+		Context:  contextInfo,
+	}
+	if streamErr != nil {
+		aiMessage.Status = models.MessageStatusIncomplete
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveReplyTimeout)
+	defer cancel()
+	if err := repo.SaveBranchMessage(ctx, email, aiMessage); err != nil {
+		log.Printf("Error saving AI message to chat %s: %v", chatID, err)
+		return nil
+	}
+	log.Printf("Saved AI message %s to chat %s, content length: %d, status: %q", aiMessage.ID, chatID, len(reply), aiMessage.Status)
+	return aiMessage
+}
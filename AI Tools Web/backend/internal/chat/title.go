@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/services"
+)
+
+const (
+	// 生成标题的超时时间，超时后聊天保留默认标题
+	titleTimeout = 15 * time.Second
+	// 生成标题时每条消息最多使用的字符数
+	titleContextLength = 1000
+)
+
+// titleModel 生成标题使用的模型，可通过 CHAT_TITLE_MODEL 配置，默认使用便宜的默认模型
+func titleModel() string {
+	if model := os.Getenv("CHAT_TITLE_MODEL"); model != "" {
+		return model
+	}
+	return models.DefaultChatModel
+}
+
+// titlePrompt 要求模型用对话的语言给出简短的标题
+func titlePrompt(language string) string {
+	prompt := "Write a short title (at most 6 words) that summarizes the conversation. " +
+		"Reply with the title only, without quotes or punctuation at the end."
+	if language == models.LanguageChinese {
+		prompt += " The title must be in Chinese (at most 15 characters)."
+	} else {
+		prompt += " The title must be in English."
+	}
+	return prompt
+}
+
+// truncateRunes 截断过长的消息，生成标题不需要完整内容
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// generateTitle 为还没有标题的聊天根据第一轮问答生成标题并保存，
+// 成功后以 title 事件发送给客户端。用户设置过的标题不会被覆盖。
+func generateTitle(g *generation, repo *db.ChatRepository, email, chatID, question, answer string) {
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+
+	chatInfo, err := repo.GetChat(ctx, email, chatID)
+	if err != nil {
+		log.Printf("Error getting chat info for title: %v", err)
+		return
+	}
+	if chatInfo.TitleSource != "" {
+		return
+	}
+
+	// 标题使用对话的语言，而不是用户偏好的回复语言
+	language := resolveLanguage(models.LanguageAuto, question)
+	conversation := fmt.Sprintf("User: %s\n\nAssistant: %s",
+		truncateRunes(question, titleContextLength), truncateRunes(answer, titleContextLength))
+
+	model := titleModel()
+	raw, err := services.GetLLMService(model).CallModel(ctx, conversation, model, services.CallOptions{
+		SystemPrompt: titlePrompt(language),
+	})
+	if err != nil {
+		log.Printf("Error generating title for chat %s: %v", chatID, err)
+		return
+	}
+
+	title := models.CleanChatTitle(raw)
+	if title == "" {
+		log.Printf("Model returned an empty title for chat %s", chatID)
+		return
+	}
+
+	if err := repo.UpdateChatTitle(ctx, email, chatID, title, models.TitleSourceAuto); err != nil {
+		if errors.Is(err, db.ErrTitleAlreadySet) {
+			// 生成期间用户修改了标题
+			log.Printf("Chat %s was renamed while generating its title, keeping the user's title", chatID)
+		} else {
+			log.Printf("Error saving title for chat %s: %v", chatID, err)
+		}
+		return
+	}
+
+	log.Printf("Generated title for chat %s: %q", chatID, title)
+	writeSSETitle(g, title)
+}
+
+// writeSSETitle 以 title 事件发送聊天的新标题
+func writeSSETitle(w http.ResponseWriter, title string) {
+	data, _ := json.Marshal(map[string]string{"title": title})
+	fmt.Fprintf(w, "event: title\ndata: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,322 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 消息类型。客户端发送 send 和 stop；服务端发送 typing、delta、title、done 和 error。
+const (
+	wsTypeSend    = "send"
+	wsTypeStop    = "stop"
+	wsTypeTyping  = "typing"
+	wsTypeDelta   = "delta"
+	wsTypeTitle   = "title"
+	wsTypeContext = "context"
+	wsTypeDone    = "done"
+	wsTypeError   = "error"
+)
+
+const (
+	// 客户端必须在这段时间内回应 ping
+	wsPongWait = 60 * time.Second
+	// 发送 ping 的间隔，必须小于 wsPongWait
+	wsPingInterval = 30 * time.Second
+	wsWriteWait    = 10 * time.Second
+	// 单条客户端消息的最大长度
+	wsMaxMessageSize = 1 << 20
+)
+
+// wsMessage WebSocket 上的 JSON 消息，一个连接可以同时进行多个聊天，用 chat_id 区分
+type wsMessage struct {
+	Type   string `json:"type"`
+	ChatID string `json:"chat_id,omitempty"`
+	// send 的消息内容，或 delta 的回复片段
+	Content string `json:"content,omitempty"`
+	// send 的可选参数，含义与流式接口的查询参数相同
+	Model       string   `json:"model,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	// send 中附加的附件 ID，由 /api/chat/attachments 上传
+	Attachments []string `json:"attachments,omitempty"`
+	// send 中使用的提示模板及其变量的值，填充后的模板作为消息内容，content 附加在后面
+	TemplateID string            `json:"template_id,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
+	// typing 中为保存的用户消息，done 中为保存的助手回复
+	MessageID string `json:"message_id,omitempty"`
+	// done 中回复的状态，生成中断时为 incomplete
+	Status string `json:"status,omitempty"`
+	// title 中为自动生成的聊天标题
+	Title string `json:"title,omitempty"`
+	// context 中为较早的历史被摘要或省略的情况
+	Context *models.ContextInfo `json:"context,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// 令牌通过子协议传递时需要在握手响应中确认
+	Subprotocols: []string{auth.WebSocketBearerProtocol},
+	CheckOrigin:  checkWebSocketOrigin,
+}
+
+// checkWebSocketOrigin 允许非浏览器客户端、同源页面和前端开发服务器
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "http://localhost:3000" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// wsConn 一个已认证的 WebSocket 连接
+type wsConn struct {
+	conn    *websocket.Conn
+	user    auth.UserClaims
+	repo    *db.ChatRepository
+	ctx     context.Context
+	writeMu sync.Mutex
+}
+
+// write 发送一条消息，多个聊天的回复可能同时写入
+func (c *wsConn) write(msg wsMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *wsConn) writeError(chatID, message string) {
+	c.write(wsMessage{Type: wsTypeError, ChatID: chatID, Error: message})
+}
+
+// ChatWebSocketHandler 通过 WebSocket 收发聊天消息 (/api/chat/ws)。
+// 与 SSE 接口使用相同的生成流程：回复在后台生成并保存，连接断开后未完成的生成在一段时间后取消。
+func ChatWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已经向客户端返回了错误
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &wsConn{conn: conn, user: userClaims, repo: db.NewChatRepository(), ctx: ctx}
+	defer conn.Close()
+
+	log.Printf("WebSocket connected for %s", userClaims.Email)
+	go c.keepAlive()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket read error for %s: %v", userClaims.Email, err)
+			}
+			break
+		}
+
+		switch msg.Type {
+		case wsTypeSend:
+			c.handleSend(msg)
+		case wsTypeStop:
+			c.handleStop(msg)
+		default:
+			c.writeError(msg.ChatID, "Unknown message type")
+		}
+	}
+	log.Printf("WebSocket disconnected for %s", userClaims.Email)
+}
+
+// keepAlive 定期发送 ping，连接关闭后退出
+func (c *wsConn) keepAlive() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSend 保存用户消息并开始生成回复，回复片段在后台转发给客户端
+func (c *wsConn) handleSend(msg wsMessage) {
+	if msg.ChatID == "" || (strings.TrimSpace(msg.Content) == "" && len(msg.Attachments) == 0 && msg.TemplateID == "") {
+		c.writeError(msg.ChatID, "chat_id and content are required")
+		return
+	}
+	if err := validateTemperature(msg.Temperature); err != nil {
+		c.writeError(msg.ChatID, "Temperature must be between 0 and 2")
+		return
+	}
+	if msg.Language != "" && !models.IsValidLanguage(msg.Language) {
+		c.writeError(msg.ChatID, "Language must be english, chinese or auto")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	defer cancel()
+
+	chatInfo, err := c.repo.GetChat(ctx, c.user.Email, msg.ChatID)
+	if err != nil {
+		log.Printf("Error getting chat info: %v", err)
+		c.writeError(msg.ChatID, "Chat not found")
+		return
+	}
+
+	content, err := applyTemplate(ctx, c.user.Email, msg.TemplateID, msg.Variables, msg.Content)
+	if err != nil {
+		log.Printf("Error applying prompt template: %v", err)
+		c.writeError(msg.ChatID, startErrorMessage(err))
+		return
+	}
+
+	ro := replyOptions{Model: msg.Model, Language: msg.Language, Temperature: msg.Temperature}
+	g, err := sendMessage(ctx, c.repo, c.user.Email, chatInfo, content, msg.Attachments, ro)
+	if err != nil {
+		log.Printf("Error starting generation: %v", err)
+		c.writeError(msg.ChatID, startErrorMessage(err))
+		return
+	}
+
+	go c.forward(g)
+}
+
+// handleStop 停止聊天中正在生成的回复
+func (c *wsConn) handleStop(msg wsMessage) {
+	ctx, cancel := context.WithTimeout(c.ctx, 10*time.Second)
+	defer cancel()
+
+	if _, err := c.repo.GetChat(ctx, c.user.Email, msg.ChatID); err != nil {
+		c.writeError(msg.ChatID, "Chat not found")
+		return
+	}
+	if stopGenerations(msg.ChatID) == 0 {
+		c.writeError(msg.ChatID, "No reply is being generated")
+	}
+}
+
+// forward 将生成的 SSE 事件转换为 typing、delta、done 和 error 消息发送给客户端
+func (c *wsConn) forward(g *generation) {
+	g.attach()
+	defer g.detach()
+
+	if err := c.write(wsMessage{Type: wsTypeTyping, ChatID: g.chatID}); err != nil {
+		return
+	}
+
+	next := 0
+	for {
+		events, done, notify := g.eventsAfter(next)
+		for _, event := range events {
+			next++
+			if msg, ok := wsMessageFromEvent(g.chatID, event); ok {
+				if err := c.write(msg); err != nil {
+					return
+				}
+			}
+		}
+		if done {
+			break
+		}
+
+		select {
+		case <-notify:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+
+	doneMsg := wsMessage{Type: wsTypeDone, ChatID: g.chatID}
+	if reply := g.result(); reply != nil {
+		doneMsg.MessageID = reply.ID
+		doneMsg.Status = reply.Status
+	}
+	c.write(doneMsg)
+}
+
+// wsMessageFromEvent 解析模型服务写入的 SSE 事件。OpenAI 的片段是 JSON 字符串，
+// Anthropic 的片段是原始文本；title 和 context 事件转换为同名消息；[DONE] 和空事件被忽略，
+// 生成结束时统一发送 done。
+func wsMessageFromEvent(chatID, event string) (wsMessage, bool) {
+	var eventType string
+	var data strings.Builder
+	for i, line := range strings.Split(event, "\n") {
+		if strings.HasPrefix(line, "event:") {
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		}
+		if i > 0 && data.Len() > 0 {
+			data.WriteString("\n")
+		}
+		data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+	}
+	payload := data.String()
+
+	if eventType == "title" {
+		var title struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal([]byte(payload), &title); err != nil || title.Title == "" {
+			return wsMessage{}, false
+		}
+		return wsMessage{Type: wsTypeTitle, ChatID: chatID, Title: title.Title}, true
+	}
+	if eventType == "context" {
+		var info models.ContextInfo
+		if err := json.Unmarshal([]byte(payload), &info); err != nil {
+			return wsMessage{}, false
+		}
+		return wsMessage{Type: wsTypeContext, ChatID: chatID, Context: &info}, true
+	}
+
+	switch {
+	case strings.TrimSpace(payload) == "" || strings.TrimSpace(payload) == "[DONE]":
+		return wsMessage{}, false
+	case strings.HasPrefix(payload, "ERROR:"):
+		return wsMessage{Type: wsTypeError, ChatID: chatID, Error: strings.TrimSpace(strings.TrimPrefix(payload, "ERROR:"))}, true
+	}
+
+	content := payload
+	if strings.HasPrefix(payload, `"`) {
+		var decoded string
+		if err := json.Unmarshal([]byte(payload), &decoded); err == nil {
+			content = decoded
+		}
+	}
+	return wsMessage{Type: wsTypeDelta, ChatID: chatID, Content: content}, true
+}
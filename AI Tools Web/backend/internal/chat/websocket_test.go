@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWsMessageFromEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+		want  wsMessage
+		ok    bool
+	}{
+		{
+			name:  "OpenAI JSON delta",
+			event: `data: "Hel\nlo \"world\""`,
+			want:  wsMessage{Type: wsTypeDelta, ChatID: "c1", Content: "Hel\nlo \"world\""},
+			ok:    true,
+		},
+		{
+			name:  "Anthropic raw delta",
+			event: "data: Hello world",
+			want:  wsMessage{Type: wsTypeDelta, ChatID: "c1", Content: "Hello world"},
+			ok:    true,
+		},
+		{
+			name:  "multi-line raw delta",
+			event: "data: first\ndata: second",
+			want:  wsMessage{Type: wsTypeDelta, ChatID: "c1", Content: "first\nsecond"},
+			ok:    true,
+		},
+		{
+			name:  "title",
+			event: "event: title\ndata: {\"title\":\"Trip plans\"}",
+			want:  wsMessage{Type: wsTypeTitle, ChatID: "c1", Title: "Trip plans"},
+			ok:    true,
+		},
+		{
+			name:  "empty title",
+			event: "event: title\ndata: {\"title\":\"\"}",
+		},
+		{
+			name:  "invalid title",
+			event: "event: title\ndata: not json",
+		},
+		{
+			name:  "context",
+			event: "event: context\ndata: {\"policy\":\"summarize\",\"summarized_messages\":4,\"prompt_tokens\":900,\"context_window\":8000}",
+			want: wsMessage{Type: wsTypeContext, ChatID: "c1", Context: &models.ContextInfo{
+				Policy: "summarize", SummarizedMessages: 4, PromptTokens: 900, ContextWindow: 8000,
+			}},
+			ok: true,
+		},
+		{
+			name:  "invalid context",
+			event: "event: context\ndata: not json",
+		},
+		{
+			name:  "error",
+			event: "data: ERROR: model unavailable ",
+			want:  wsMessage{Type: wsTypeError, ChatID: "c1", Error: "model unavailable"},
+			ok:    true,
+		},
+		{
+			name:  "done marker",
+			event: "data: [DONE]",
+		},
+		{
+			name:  "empty event",
+			event: "",
+		},
+		{
+			name:  "raw delta starting with a quote",
+			event: `data: "quoted" text`,
+			want:  wsMessage{Type: wsTypeDelta, ChatID: "c1", Content: `"quoted" text`},
+			ok:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := wsMessageFromEvent("c1", tt.event)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.want, msg)
+			}
+		})
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		host   string
+		want   bool
+	}{
+		{name: "no origin", host: "chat.example.com", want: true},
+		{name: "dev server", origin: "http://localhost:3000", host: "localhost:8080", want: true},
+		{name: "same host", origin: "https://chat.example.com", host: "chat.example.com", want: true},
+		{name: "same host different case", origin: "https://Chat.Example.com", host: "chat.example.com", want: true},
+		{name: "other port", origin: "http://localhost:3001", host: "localhost:8080", want: false},
+		{name: "foreign origin", origin: "https://evil.example.net", host: "chat.example.com", want: false},
+		{name: "unparsable origin", origin: "http://%zz", host: "chat.example.com", want: false},
+		{name: "null origin", origin: "null", host: "chat.example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/chat/ws", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			assert.Equal(t, tt.want, checkWebSocketOrigin(r))
+		})
+	}
+}
+
+func TestWebSocketForward(t *testing.T) {
+	g, err := startGeneration("ws-chat")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		c := &wsConn{conn: conn, ctx: ctx}
+		c.forward(g)
+		// 等待客户端读完后关闭
+		conn.ReadMessage()
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	read := func() wsMessage {
+		var msg wsMessage
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		require.NoError(t, conn.ReadJSON(&msg))
+		return msg
+	}
+
+	assert.Equal(t, wsMessage{Type: wsTypeTyping, ChatID: "ws-chat"}, read())
+
+	fmt.Fprint(g, "data: \"Hi\"\n\nevent: title\ndata: {\"title\":\"Greeting\"}\n\n")
+	assert.Equal(t, wsMessage{Type: wsTypeDelta, ChatID: "ws-chat", Content: "Hi"}, read())
+	assert.Equal(t, wsMessage{Type: wsTypeTitle, ChatID: "ws-chat", Title: "Greeting"}, read())
+
+	// [DONE] 不转发，生成结束后发送 done 和保存的回复
+	fmt.Fprint(g, "data: [DONE]\n\n")
+	g.setReply(&models.Message{ID: "reply-1", Status: "incomplete"})
+	g.finish()
+	assert.Equal(t, wsMessage{Type: wsTypeDone, ChatID: "ws-chat", MessageID: "reply-1", Status: "incomplete"}, read())
+}
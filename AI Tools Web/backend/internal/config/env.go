@@ -0,0 +1,22 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Duration 从环境变量读取时长，例如 "15m" 或 "168h"，未设置或无效时返回 fallback
+func Duration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s %q, using default %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAPIKeyNotFound 个人访问令牌不存在或已过期
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// 最近使用时间的更新间隔，避免每个请求都写数据库
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyRepository 管理个人访问令牌
+type APIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAPIKeyRepository 创建新的 APIKeyRepository 实例
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{
+		collection: GetCollection(APIKeyCollection),
+	}
+}
+
+// CreateAPIKey 保存新的访问令牌
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if key.ID == "" {
+		key.ID = primitive.NewObjectID().Hex()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+// CountAPIKeys 统计用户的访问令牌数量
+func (r *APIKeyRepository) CountAPIKeys(ctx context.Context, email string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_email": email})
+}
+
+// ListAPIKeys 列出用户的访问令牌，按创建时间倒序
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, email string) ([]models.APIKey, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_email": email},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []models.APIKey{}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash 根据令牌哈希获取未过期的访问令牌
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.collection.FindOne(ctx, bson.M{
+		"key_hash": keyHash,
+		"$or": []bson.M{
+			{"expires_at": bson.M{"$exists": false}},
+			{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("error finding api key: %w", err)
+	}
+	return &key, nil
+}
+
+// TouchAPIKey 更新最近使用时间，间隔不足一分钟时跳过
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id string) error {
+	now := time.Now()
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id": id,
+			"$or": []bson.M{
+				{"last_used_at": bson.M{"$exists": false}},
+				{"last_used_at": bson.M{"$lt": now.Add(-apiKeyTouchInterval)}},
+			},
+		},
+		bson.M{"$set": bson.M{"last_used_at": now}},
+	)
+	return err
+}
+
+// DeleteAPIKey 删除用户的访问令牌
+func (r *APIKeyRepository) DeleteAPIKey(ctx context.Context, email, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_email": email})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// DeleteUserAPIKeys 删除用户的全部访问令牌
+func (r *APIKeyRepository) DeleteUserAPIKeys(ctx context.Context, email string) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_email": email})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
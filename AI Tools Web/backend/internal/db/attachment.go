@@ -0,0 +1,123 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAttachmentNotFound 附件不存在、已过期或不属于当前用户
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// AttachmentRepository 管理消息附件
+type AttachmentRepository struct {
+	collection *mongo.Collection
+}
+
+// NewAttachmentRepository 创建新的 AttachmentRepository 实例
+func NewAttachmentRepository() *AttachmentRepository {
+	return &AttachmentRepository{
+		collection: GetCollection(AttachmentCollection),
+	}
+}
+
+// SaveAttachment 保存上传的附件，ttl 后仍未用在消息中时自动删除
+func (r *AttachmentRepository) SaveAttachment(ctx context.Context, file *models.AttachmentFile, ttl time.Duration) error {
+	if file.ID == "" {
+		file.ID = primitive.NewObjectID().Hex()
+	}
+	file.CreatedAt = time.Now()
+	expiresAt := file.CreatedAt.Add(ttl)
+	file.ExpiresAt = &expiresAt
+	_, err := r.collection.InsertOne(ctx, file)
+	return err
+}
+
+// GetAttachment 获取用户的附件，包括文件内容
+func (r *AttachmentRepository) GetAttachment(ctx context.Context, email, id string) (*models.AttachmentFile, error) {
+	var file models.AttachmentFile
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "user_email": email}).Decode(&file)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: %s", ErrAttachmentNotFound, id)
+		}
+		return nil, fmt.Errorf("error finding attachment: %w", err)
+	}
+	return &file, nil
+}
+
+// FindAttachments 按 ids 的顺序获取用户的附件信息，不读取文件内容。任何一个不存在时返回 ErrAttachmentNotFound。
+func (r *AttachmentRepository) FindAttachments(ctx context.Context, email string, ids []string) ([]models.AttachmentFile, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_email": email},
+		options.Find().SetProjection(bson.M{"data": 0}))
+	if err != nil {
+		return nil, err
+	}
+	var found []models.AttachmentFile
+	if err = cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.AttachmentFile, len(found))
+	for _, f := range found {
+		byID[f.ID] = f
+	}
+	files := make([]models.AttachmentFile, 0, len(ids))
+	for _, id := range ids {
+		f, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrAttachmentNotFound, id)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// LoadAttachmentData 读取聊天中附件的文件内容，返回附件 ID 到内容的映射
+func (r *AttachmentRepository) LoadAttachmentData(ctx context.Context, chatID string, ids []string) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(ids))
+	if len(ids) == 0 {
+		return data, nil
+	}
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "chat_id": chatID},
+		options.Find().SetProjection(bson.M{"data": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var files []models.AttachmentFile
+	if err = cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data[f.ID] = f.Data
+	}
+	return data, nil
+}
+
+// BindAttachments 把附件关联到聊天，关联后不再自动过期，随聊天一起删除。
+// 有附件已过期被删除时返回 ErrAttachmentNotFound。
+func (r *AttachmentRepository) BindAttachments(ctx context.Context, email, chatID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	result, err := r.collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "user_email": email},
+		bson.M{"$set": bson.M{"chat_id": chatID}, "$unset": bson.M{"expires_at": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount < int64(len(ids)) {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
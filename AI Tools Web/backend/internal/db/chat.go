@@ -3,6 +3,7 @@ package db
 import (
 	"backend/internal/models"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -13,6 +14,15 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrChatNotFound 聊天不存在或不属于当前用户
+var ErrChatNotFound = errors.New("chat not found")
+
+// ErrMessageNotFound 消息不存在或不属于该聊天
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrTitleAlreadySet 自动生成的标题不会覆盖已有的标题
+var ErrTitleAlreadySet = errors.New("chat title already set")
+
 // ChatRepository 定义
 type ChatRepository struct {
 	collection *mongo.Collection
@@ -25,19 +35,75 @@ func NewChatRepository() *ChatRepository {
 	}
 }
 
+// chatFilter 构建限定在用户范围内的聊天查询条件
+func chatFilter(userID, chatID string) bson.M {
+	return bson.M{"_id": chatID, "user_id": userID}
+}
+
+// chatNotFound 返回包装了 ErrChatNotFound 的错误
+func chatNotFound(chatID string) error {
+	return fmt.Errorf("%w: %s", ErrChatNotFound, chatID)
+}
+
 // CreateChat 创建新的聊天
-func (r *ChatRepository) CreateChat(ctx context.Context, chat *models.Chat) error {
+func (r *ChatRepository) CreateChat(ctx context.Context, userID string, chat *models.Chat) error {
+	if userID == "" {
+		return errors.New("chat owner is required")
+	}
 	if chat.ID == "" {
 		chat.ID = primitive.NewObjectID().Hex()
 	}
+	chat.UserID = userID
 	chat.CreatedAt = time.Now()
 
 	_, err := r.collection.InsertOne(ctx, chat)
 	return err
 }
 
-// SaveMessage 保存消息
-func (r *ChatRepository) SaveMessage(ctx context.Context, message *models.Message) error {
+// ensureChatOwner 确认聊天存在且属于该用户
+func (r *ChatRepository) ensureChatOwner(ctx context.Context, userID, chatID string) error {
+	count, err := r.collection.CountDocuments(ctx, chatFilter(userID, chatID), options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("error finding chat: %w", err)
+	}
+	if count == 0 {
+		return chatNotFound(chatID)
+	}
+	return nil
+}
+
+// SaveMessage 将消息追加到当前分支的末尾，并把它设为新的分支末端。
+// message.ParentID 由当前分支决定，调用方设置的值会被覆盖。
+func (r *ChatRepository) SaveMessage(ctx context.Context, userID string, message *models.Message) error {
+	chat, err := r.GetChat(ctx, userID, message.ChatID)
+	if err != nil {
+		return err
+	}
+	leafID, err := r.migrateLegacyMessages(ctx, chat)
+	if err != nil {
+		return err
+	}
+
+	message.ParentID = leafID
+	return r.insertMessage(ctx, userID, message)
+}
+
+// SaveBranchMessage 在 message.ParentID 下保存消息（为空时作为第一条消息），
+// 用于编辑消息时创建新的分支，以及把回复保存在它所回答的消息下。新消息成为当前分支末端。
+func (r *ChatRepository) SaveBranchMessage(ctx context.Context, userID string, message *models.Message) error {
+	if err := r.ensureChatOwner(ctx, userID, message.ChatID); err != nil {
+		return err
+	}
+	if message.ParentID != "" {
+		if _, err := r.findMessage(ctx, message.ChatID, message.ParentID); err != nil {
+			return err
+		}
+	}
+	return r.insertMessage(ctx, userID, message)
+}
+
+// insertMessage 写入消息并更新聊天的分支末端
+func (r *ChatRepository) insertMessage(ctx context.Context, userID string, message *models.Message) error {
 	// 确保消息有唯一ID
 	if message.ID == "" {
 		message.ID = primitive.NewObjectID().Hex()
@@ -49,8 +115,8 @@ func (r *ChatRepository) SaveMessage(ctx context.Context, message *models.Messag
 	}
 
 	// 记录函数调用信息
-	log.Printf("Saving message: ChatID=%s, Role=%s, ContentLength=%d",
-		message.ChatID, message.Role, len(message.Content))
+	log.Printf("Saving message: ChatID=%s, Role=%s, ParentID=%s, ContentLength=%d",
+		message.ChatID, message.Role, message.ParentID, len(message.Content))
 
 	collection := GetCollection(MessageCollection)
 	_, err := collection.InsertOne(ctx, message)
@@ -59,13 +125,56 @@ func (r *ChatRepository) SaveMessage(ctx context.Context, message *models.Messag
 		return err
 	}
 
+	if err := r.SetActiveLeaf(ctx, userID, message.ChatID, message.ID); err != nil {
+		return err
+	}
+
 	log.Printf("Message saved successfully: ChatID=%s, Role=%s", message.ChatID, message.Role)
 	return nil
 }
 
-// GetChatHistory 获取聊天历史
-func (r *ChatRepository) GetChatHistory(ctx context.Context) ([]models.Chat, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{},
+// migrateLegacyMessages 为引入分支之前的聊天补全 ParentID：按创建时间把消息连成一条路径，
+// 并把最后一条消息设为分支末端。返回当前分支末端的 ID。
+func (r *ChatRepository) migrateLegacyMessages(ctx context.Context, chat *models.Chat) (string, error) {
+	if chat.ActiveLeafID != "" {
+		return chat.ActiveLeafID, nil
+	}
+
+	messages, err := r.findMessages(ctx, chat.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", nil
+	}
+
+	chained, leafID := models.ChainMessages(messages)
+	var updates []mongo.WriteModel
+	for _, m := range chained {
+		if m.ParentID == "" {
+			continue
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": m.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"parent_id": m.ParentID}}))
+	}
+	if len(updates) > 0 {
+		if _, err := GetCollection(MessageCollection).BulkWrite(ctx, updates); err != nil {
+			return "", fmt.Errorf("failed to link messages of chat %s: %w", chat.ID, err)
+		}
+	}
+	if err := r.SetActiveLeaf(ctx, chat.UserID, chat.ID, leafID); err != nil {
+		return "", err
+	}
+
+	log.Printf("Linked %d legacy messages of chat %s", len(messages), chat.ID)
+	chat.ActiveLeafID = leafID
+	return leafID, nil
+}
+
+// GetChatHistory 获取用户的聊天历史
+func (r *ChatRepository) GetChatHistory(ctx context.Context, userID string) ([]models.Chat, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID},
 		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, err
@@ -79,11 +188,64 @@ func (r *ChatRepository) GetChatHistory(ctx context.Context) ([]models.Chat, err
 	return chats, nil
 }
 
-// GetMessages 获取消息
-func (r *ChatRepository) GetMessages(ctx context.Context, chatID string) ([]models.Message, error) {
-	messageCollection := GetCollection(MessageCollection)
+// GetMessages 获取聊天的全部消息（包括所有分支），按创建时间排序
+func (r *ChatRepository) GetMessages(ctx context.Context, userID string, chatID string) ([]models.Message, error) {
+	chat, err := r.GetChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.migrateLegacyMessages(ctx, chat); err != nil {
+		return nil, err
+	}
+	return r.findMessages(ctx, chatID)
+}
 
-	cursor, err := messageCollection.Find(ctx,
+// GetActivePath 获取当前分支上的消息，从第一条消息到分支末端
+func (r *ChatRepository) GetActivePath(ctx context.Context, userID string, chatID string) ([]models.Message, error) {
+	chat, err := r.GetChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.migrateLegacyMessages(ctx, chat); err != nil {
+		return nil, err
+	}
+
+	messages, err := r.findMessages(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return models.ActivePath(messages, chat.ActiveLeafID), nil
+}
+
+// GetMessage 获取聊天中的一条消息。引入分支之前的聊天先补全 ParentID，
+// 编辑和重新生成依据返回的 ParentID 创建分支。
+func (r *ChatRepository) GetMessage(ctx context.Context, userID string, chatID string, messageID string) (*models.Message, error) {
+	chat, err := r.GetChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.migrateLegacyMessages(ctx, chat); err != nil {
+		return nil, err
+	}
+	return r.findMessage(ctx, chatID, messageID)
+}
+
+// SetActiveLeaf 设置当前分支末端
+func (r *ChatRepository) SetActiveLeaf(ctx context.Context, userID string, chatID string, messageID string) error {
+	result, err := r.collection.UpdateOne(ctx, chatFilter(userID, chatID),
+		bson.M{"$set": bson.M{"active_leaf_id": messageID}})
+	if err != nil {
+		return fmt.Errorf("failed to update active branch: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return chatNotFound(chatID)
+	}
+	return nil
+}
+
+// findMessages 查询聊天的全部消息，不检查所有者
+func (r *ChatRepository) findMessages(ctx context.Context, chatID string) ([]models.Message, error) {
+	cursor, err := GetCollection(MessageCollection).Find(ctx,
 		bson.M{"chat_id": chatID},
 		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
 	if err != nil {
@@ -98,14 +260,36 @@ func (r *ChatRepository) GetMessages(ctx context.Context, chatID string) ([]mode
 	return messages, nil
 }
 
-// UpdateChatTitle 更新聊天标题
-func (r *ChatRepository) UpdateChatTitle(ctx context.Context, chatID string, title string) error {
+// findMessage 查询聊天中的一条消息，不检查所有者
+func (r *ChatRepository) findMessage(ctx context.Context, chatID string, messageID string) (*models.Message, error) {
+	var message models.Message
+	err := GetCollection(MessageCollection).FindOne(ctx, bson.M{"_id": messageID, "chat_id": chatID}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding message: %w", err)
+	}
+	return &message, nil
+}
+
+// UpdateChatTitle 更新聊天标题，source 记录标题的来源。
+// 自动生成的标题 (TitleSourceAuto) 只在聊天还没有设置过标题时保存，否则返回 ErrTitleAlreadySet；
+// 用户设置的标题总是保存，之后不会再被自动生成的标题覆盖。
+func (r *ChatRepository) UpdateChatTitle(ctx context.Context, userID string, chatID string, title string, source string) error {
+	filter := chatFilter(userID, chatID)
+	if source == models.TitleSourceAuto {
+		// 条件写在查询中，避免与用户同时修改标题时覆盖用户的标题
+		filter["title_source"] = bson.M{"$exists": false}
+	}
+
 	result, err := r.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": chatID},
+		filter,
 		bson.M{"$set": bson.M{
-			"title":      title,
-			"updated_at": time.Now(),
+			"title":        title,
+			"title_source": source,
+			"updated_at":   time.Now(),
 		}},
 	)
 
@@ -115,37 +299,65 @@ func (r *ChatRepository) UpdateChatTitle(ctx context.Context, chatID string, tit
 	}
 
 	if result.MatchedCount == 0 {
+		if source == models.TitleSourceAuto {
+			return fmt.Errorf("%w: %s", ErrTitleAlreadySet, chatID)
+		}
 		log.Printf("No chat found with ID: %s", chatID)
-		return fmt.Errorf("chat not found: %s", chatID)
+		return chatNotFound(chatID)
 	}
 
 	return nil
 }
 
-// DeleteChat 删除聊天及其所有消息
-func (r *ChatRepository) DeleteChat(ctx context.Context, chatID string) error {
+// UpdateContextSummary 保存当前分支较早对话的摘要
+func (r *ChatRepository) UpdateContextSummary(ctx context.Context, userID string, chatID string, summary *models.ContextSummary) error {
+	result, err := r.collection.UpdateOne(ctx, chatFilter(userID, chatID),
+		bson.M{"$set": bson.M{"context_summary": summary}})
+	if err != nil {
+		return fmt.Errorf("failed to save context summary: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return chatNotFound(chatID)
+	}
+	return nil
+}
+
+// DeleteChat 删除聊天及其所有消息、附件和分享
+func (r *ChatRepository) DeleteChat(ctx context.Context, userID string, chatID string) error {
 	// 删除聊天记录
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": chatID})
+	result, err := r.collection.DeleteOne(ctx, chatFilter(userID, chatID))
 	if err != nil {
 		return fmt.Errorf("failed to delete chat: %w", err)
 	}
+	if result.DeletedCount == 0 {
+		return chatNotFound(chatID)
+	}
 
 	// 删除该聊天的所有消息
 	_, err = GetCollection(MessageCollection).DeleteMany(ctx, bson.M{"chat_id": chatID})
 	if err != nil {
 		return fmt.Errorf("failed to delete chat messages: %w", err)
 	}
+	if _, err := GetCollection(MessageEmbeddingCollection).DeleteMany(ctx, bson.M{"chat_id": chatID}); err != nil {
+		return fmt.Errorf("failed to delete chat embeddings: %w", err)
+	}
+	if _, err := GetCollection(ChatShareCollection).DeleteMany(ctx, bson.M{"chat_id": chatID}); err != nil {
+		return fmt.Errorf("failed to delete chat shares: %w", err)
+	}
+	if _, err := GetCollection(AttachmentCollection).DeleteMany(ctx, bson.M{"chat_id": chatID}); err != nil {
+		return fmt.Errorf("failed to delete chat attachments: %w", err)
+	}
 
 	return nil
 }
 
 // GetChat 获取单个聊天信息
-func (r *ChatRepository) GetChat(ctx context.Context, chatID string) (*models.Chat, error) {
+func (r *ChatRepository) GetChat(ctx context.Context, userID string, chatID string) (*models.Chat, error) {
 	var chat models.Chat
-	err := r.collection.FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat)
+	err := r.collection.FindOne(ctx, chatFilter(userID, chatID)).Decode(&chat)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("chat not found: %s", chatID)
+			return nil, chatNotFound(chatID)
 		}
 		return nil, fmt.Errorf("error finding chat: %w", err)
 	}
@@ -153,10 +365,10 @@ func (r *ChatRepository) GetChat(ctx context.Context, chatID string) (*models.Ch
 }
 
 // UpdateChatModel 更新聊天使用的模型
-func (r *ChatRepository) UpdateChatModel(ctx context.Context, chatID string, model string) error {
+func (r *ChatRepository) UpdateChatModel(ctx context.Context, userID string, chatID string, model string) error {
 	result, err := r.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": chatID},
+		chatFilter(userID, chatID),
 		bson.M{"$set": bson.M{
 			"model":      model,
 			"updated_at": time.Now(),
@@ -170,8 +382,40 @@ func (r *ChatRepository) UpdateChatModel(ctx context.Context, chatID string, mod
 
 	if result.MatchedCount == 0 {
 		log.Printf("No chat found with ID: %s", chatID)
-		return fmt.Errorf("chat not found: %s", chatID)
+		return chatNotFound(chatID)
 	}
 
 	return nil
 }
+
+// DeleteUserChats 删除用户的所有聊天及其消息、附件和分享
+func (r *ChatRepository) DeleteUserChats(ctx context.Context, userID string) (int64, error) {
+	// 嵌入、分享和附件按用户记录，没有聊天时也可能存在（例如上传后未发送的附件）
+	if _, err := GetCollection(MessageEmbeddingCollection).DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return 0, fmt.Errorf("failed to delete chat embeddings: %w", err)
+	}
+	if _, err := GetCollection(ChatShareCollection).DeleteMany(ctx, bson.M{"user_email": userID}); err != nil {
+		return 0, fmt.Errorf("failed to delete chat shares: %w", err)
+	}
+	if _, err := GetCollection(AttachmentCollection).DeleteMany(ctx, bson.M{"user_email": userID}); err != nil {
+		return 0, fmt.Errorf("failed to delete chat attachments: %w", err)
+	}
+
+	chatIDs, err := r.collection.Distinct(ctx, "_id", bson.M{"user_id": userID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list user chats: %w", err)
+	}
+	if len(chatIDs) == 0 {
+		return 0, nil
+	}
+
+	if _, err := GetCollection(MessageCollection).DeleteMany(ctx, bson.M{"chat_id": bson.M{"$in": chatIDs}}); err != nil {
+		return 0, fmt.Errorf("failed to delete chat messages: %w", err)
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete chats: %w", err)
+	}
+	return result.DeletedCount, nil
+}
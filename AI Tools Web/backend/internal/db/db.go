@@ -18,6 +18,24 @@ const (
 	UserCollection    = "users"
 	ChatCollection    = "chats"
 	MessageCollection = "messages"
+
+	RefreshTokenCollection = "refresh_tokens"
+	RevokedTokenCollection = "revoked_tokens"
+	OIDCStateCollection    = "oidc_states"
+	APIKeyCollection       = "api_keys"
+	LoginAttemptCollection = "login_attempts"
+	PreferencesCollection  = "user_preferences"
+	DocumentCollection     = "documents"
+	JobCollection          = "jobs"
+	// 语义搜索使用的消息向量
+	MessageEmbeddingCollection = "message_embeddings"
+	// 聊天的公开分享及其消息快照
+	ChatShareCollection = "chat_shares"
+	// 消息附件及其文件内容
+	AttachmentCollection = "attachments"
+	// 助手角色和提示模板
+	PersonaCollection        = "personas"
+	PromptTemplateCollection = "prompt_templates"
 )
 
 // InitDB initializes the database connection
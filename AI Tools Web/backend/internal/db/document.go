@@ -0,0 +1,53 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DocumentRepository 记录 RAG 文档属于哪个用户，文档内容和向量保存在 RAG 服务中
+type DocumentRepository struct {
+	collection *mongo.Collection
+}
+
+// NewDocumentRepository 创建新的 DocumentRepository 实例
+func NewDocumentRepository() *DocumentRepository {
+	return &DocumentRepository{
+		collection: GetCollection(DocumentCollection),
+	}
+}
+
+// SaveDocument 保存文档记录，同一文档重复上传时覆盖
+func (r *DocumentRepository) SaveDocument(ctx context.Context, doc *models.Document) error {
+	if doc.UploadedAt.IsZero() {
+		doc.UploadedAt = time.Now()
+	}
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": doc.ID}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// ListUserDocuments 列出用户上传的文档，按上传时间倒序
+func (r *DocumentRepository) ListUserDocuments(ctx context.Context, email string) ([]models.Document, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_email": email},
+		options.Find().SetSort(bson.D{{Key: "uploaded_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	docs := []models.Document{}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// DeleteDocument 删除文档记录
+func (r *DocumentRepository) DeleteDocument(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
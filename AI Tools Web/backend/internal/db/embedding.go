@@ -0,0 +1,92 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmbeddingRepository 保存语义搜索使用的消息向量
+type EmbeddingRepository struct {
+	collection *mongo.Collection
+}
+
+// NewEmbeddingRepository 创建新的 EmbeddingRepository 实例
+func NewEmbeddingRepository() *EmbeddingRepository {
+	return &EmbeddingRepository{
+		collection: GetCollection(MessageEmbeddingCollection),
+	}
+}
+
+// SaveEmbeddings 保存消息向量，已存在的向量被替换
+func (r *EmbeddingRepository) SaveEmbeddings(ctx context.Context, embeddings []models.MessageEmbedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	writes := make([]mongo.WriteModel, len(embeddings))
+	for i := range embeddings {
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": embeddings[i].MessageID}).
+			SetReplacement(embeddings[i]).
+			SetUpsert(true)
+	}
+	_, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// UserEmbeddings 返回用户使用指定模型生成的全部向量
+func (r *EmbeddingRepository) UserEmbeddings(ctx context.Context, userID, model string) ([]models.MessageEmbedding, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID, "model": model})
+	if err != nil {
+		return nil, err
+	}
+
+	var embeddings []models.MessageEmbedding
+	if err = cursor.All(ctx, &embeddings); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// UnembeddedMessages 返回 chatIDs 对应的聊天中还没有用该模型生成向量的消息（最多 limit 条），
+// 以及这类消息的总数
+func (r *EmbeddingRepository) UnembeddedMessages(ctx context.Context, userID, model string, chatIDs []string, limit int) ([]models.Message, int64, error) {
+	if len(chatIDs) == 0 {
+		return nil, 0, nil
+	}
+
+	embedded, err := r.collection.Distinct(ctx, "_id", bson.M{"user_id": userID, "model": model})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list embedded messages: %w", err)
+	}
+
+	filter := bson.M{
+		"chat_id": bson.M{"$in": chatIDs},
+		"_id":     bson.M{"$nin": embedded},
+		"content": bson.M{"$ne": ""},
+	}
+	messages := GetCollection(MessageCollection)
+	total, err := messages.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	cursor, err := messages.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var pending []models.Message
+	if err = cursor.All(ctx, &pending); err != nil {
+		return nil, 0, err
+	}
+	return pending, total, nil
+}
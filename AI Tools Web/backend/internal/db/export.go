@@ -0,0 +1,31 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"fmt"
+	"log"
+)
+
+// ImportChat 创建聊天并一次写入它的全部消息。消息需要已有 ID 和父消息（见 models.PrepareImport），
+// chat.ActiveLeafID 指向其中一条消息。写入消息失败时删除已创建的聊天。
+func (r *ChatRepository) ImportChat(ctx context.Context, userID string, chat *models.Chat, messages []models.Message) error {
+	if err := r.CreateChat(ctx, userID, chat); err != nil {
+		return err
+	}
+
+	docs := make([]interface{}, len(messages))
+	for i := range messages {
+		messages[i].ChatID = chat.ID
+		docs[i] = messages[i]
+	}
+	if _, err := GetCollection(MessageCollection).InsertMany(ctx, docs); err != nil {
+		if delErr := r.DeleteChat(ctx, userID, chat.ID); delErr != nil {
+			log.Printf("Error cleaning up imported chat %s: %v", chat.ID, delErr)
+		}
+		return fmt.Errorf("failed to import messages: %w", err)
+	}
+
+	log.Printf("Imported chat %s with %d messages for %s", chat.ID, len(messages), userID)
+	return nil
+}
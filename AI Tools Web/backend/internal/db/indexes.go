@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionIndexes 列出启动时需要确保存在的索引
+var collectionIndexes = map[string][]mongo.IndexModel{
+	UserCollection: {
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}},
+			Options: options.Index().SetSparse(true)},
+	},
+	ChatCollection: {
+		// 聊天列表按 (created_at, _id) 分页
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+	},
+	MessageCollection: {
+		// 消息历史分页，也用于查找聊天的最后一条消息
+		{Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		// 聊天记录全文搜索，每个集合只能有一个全文索引
+		{Keys: bson.D{{Key: "content", Value: "text"}}, Options: options.Index().SetName("content_text")},
+	},
+	MessageEmbeddingCollection: {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "model", Value: 1}}},
+		{Keys: bson.D{{Key: "chat_id", Value: 1}}},
+	},
+	AttachmentCollection: {
+		{Keys: bson.D{{Key: "user_email", Value: 1}}},
+		{Keys: bson.D{{Key: "chat_id", Value: 1}}},
+		// 上传后没有发送的附件由 MongoDB 自动清理
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	ChatShareCollection: {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "chat_id", Value: 1}}},
+		// 过期的分享连同快照由 MongoDB 自动清理
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	PersonaCollection: {
+		{Keys: bson.D{{Key: "owner_email", Value: 1}, {Key: "name", Value: 1}}},
+		{Keys: bson.D{{Key: "global", Value: 1}, {Key: "name", Value: 1}}},
+	},
+	PromptTemplateCollection: {
+		{Keys: bson.D{{Key: "owner_email", Value: 1}, {Key: "name", Value: 1}}},
+		{Keys: bson.D{{Key: "global", Value: 1}, {Key: "name", Value: 1}}},
+	},
+	RefreshTokenCollection: {
+		{Keys: bson.D{{Key: "user_email", Value: 1}}},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		// 过期的刷新令牌由 MongoDB 自动清理
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	RevokedTokenCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	APIKeyCollection: {
+		{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	LoginAttemptCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	DocumentCollection: {
+		{Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "uploaded_at", Value: -1}}},
+	},
+	JobCollection: {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "user_email", Value: 1}, {Key: "type", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	OIDCStateCollection: {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+}
+
+// EnsureIndexes creates the indexes the repositories rely on
+func EnsureIndexes(ctx context.Context) error {
+	for name, indexes := range collectionIndexes {
+		if _, err := GetCollection(name).Indexes().CreateMany(ctx, indexes); err != nil {
+			log.Printf("Failed to create indexes for collection %s: %v", name, err)
+			return err
+		}
+	}
+	log.Printf("Database indexes ensured for %d collections", len(collectionIndexes))
+	return nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrJobNotFound 后台任务不存在
+var ErrJobNotFound = errors.New("job not found")
+
+// 结束的任务记录保留时间
+const finishedJobRetention = 30 * 24 * time.Hour
+
+// JobRepository 管理后台任务记录
+type JobRepository struct {
+	collection *mongo.Collection
+}
+
+// NewJobRepository 创建新的 JobRepository 实例
+func NewJobRepository() *JobRepository {
+	return &JobRepository{
+		collection: GetCollection(JobCollection),
+	}
+}
+
+// activeJobFilter 匹配尚未结束的任务
+func activeJobFilter() bson.M {
+	return bson.M{"status": bson.M{"$in": bson.A{models.JobStatusPending, models.JobStatusRunning}}}
+}
+
+// CreateJob 保存新任务
+func (r *JobRepository) CreateJob(ctx context.Context, job *models.Job) error {
+	now := time.Now()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if job.Status == "" {
+		job.Status = models.JobStatusPending
+	}
+	_, err := r.collection.InsertOne(ctx, job)
+	return err
+}
+
+// GetJob 获取任务
+func (r *JobRepository) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FindActiveJob 查找用户指定类型的未结束任务，没有时返回 nil
+func (r *JobRepository) FindActiveJob(ctx context.Context, jobType, email string) (*models.Job, error) {
+	filter := activeJobFilter()
+	filter["type"] = jobType
+	filter["user_email"] = email
+
+	var job models.Job
+	err := r.collection.FindOne(ctx, filter).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListActiveJobs 列出所有未结束的任务，用于服务启动时继续执行
+func (r *JobRepository) ListActiveJobs(ctx context.Context) ([]models.Job, error) {
+	cursor, err := r.collection.Find(ctx, activeJobFilter(),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []models.Job{}
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// StartAttempt 将任务标记为执行中并增加尝试次数
+func (r *JobRepository) StartAttempt(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{"status": models.JobStatusRunning, "updated_at": time.Now()},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CompleteJob 标记任务成功完成
+func (r *JobRepository) CompleteJob(ctx context.Context, id string, result map[string]int64) error {
+	now := time.Now()
+	expiresAt := now.Add(finishedJobRetention)
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"status":       models.JobStatusCompleted,
+			"result":       result,
+			"updated_at":   now,
+			"completed_at": now,
+			"expires_at":   expiresAt,
+		},
+		"$unset": bson.M{"error": ""},
+	})
+	return err
+}
+
+// FailAttempt 记录一次失败。final 为 true 时任务最终失败，否则回到等待状态等待重试
+func (r *JobRepository) FailAttempt(ctx context.Context, id string, message string, final bool) error {
+	now := time.Now()
+	set := bson.M{
+		"status":     models.JobStatusPending,
+		"error":      message,
+		"updated_at": now,
+	}
+	if final {
+		set["status"] = models.JobStatusFailed
+		set["completed_at"] = now
+		set["expires_at"] = now.Add(finishedJobRetention)
+	}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	return err
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepository 管理登录失败记录，记录保存在数据库中，重启后依然有效
+type LoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+// NewLoginAttemptRepository 创建新的 LoginAttemptRepository 实例
+func NewLoginAttemptRepository() *LoginAttemptRepository {
+	return &LoginAttemptRepository{
+		collection: GetCollection(LoginAttemptCollection),
+	}
+}
+
+// GetAttempts 获取登录失败记录，没有记录时返回 nil
+func (r *LoginAttemptRepository) GetAttempts(ctx context.Context, id string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RecordFailure 原子地增加失败次数。距上次失败超过 window 时重新计数，
+// 失败次数达到 maxFailures 时锁定到 now+lockout。
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, id string, maxFailures int, window, lockout time.Duration) (*models.LoginAttempt, error) {
+	now := time.Now()
+
+	// 使用聚合管道更新，保证计数和锁定在一次写入中完成
+	failures := bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{"$last_failure_at", now.Add(-window)}},
+		bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+		1,
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"failures": failures}}},
+		{{Key: "$set", Value: bson.M{
+			"last_failure_at": now,
+			"locked_until": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{"$failures", maxFailures}},
+				now.Add(lockout),
+				"$$REMOVE",
+			}},
+			"expires_at": now.Add(window + lockout),
+		}}},
+	}
+
+	var attempt models.LoginAttempt
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// ClearAttempts 登录成功或管理员解锁时清除失败记录
+func (r *LoginAttemptRepository) ClearAttempts(ctx context.Context, id string) (bool, error) {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
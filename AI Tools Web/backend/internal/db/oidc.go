@@ -0,0 +1,49 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrOIDCStateNotFound state 不存在、已使用或已过期
+var ErrOIDCStateNotFound = errors.New("oidc state not found")
+
+// OIDCStateRepository 管理单点登录的授权状态
+type OIDCStateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewOIDCStateRepository 创建新的 OIDCStateRepository 实例
+func NewOIDCStateRepository() *OIDCStateRepository {
+	return &OIDCStateRepository{
+		collection: GetCollection(OIDCStateCollection),
+	}
+}
+
+// SaveState 保存授权请求的状态
+func (r *OIDCStateRepository) SaveState(ctx context.Context, state *models.OIDCState) error {
+	_, err := r.collection.InsertOne(ctx, state)
+	return err
+}
+
+// ConsumeState 取出并删除状态，保证每个 state 只能使用一次
+func (r *OIDCStateRepository) ConsumeState(ctx context.Context, id string) (*models.OIDCState, error) {
+	var state models.OIDCState
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&state)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOIDCStateNotFound
+		}
+		return nil, err
+	}
+	// TTL 索引的清理有延迟，这里再检查一次
+	if time.Now().After(state.ExpiresAt) {
+		return nil, ErrOIDCStateNotFound
+	}
+	return &state, nil
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCursor 分页游标不存在或不属于该列表
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 聊天列表中最后一条消息预览的长度（字符数）
+const messagePreviewLength = 100
+
+// chatSummaryProjection 聊天列表只读取这些字段
+var chatSummaryProjection = bson.M{"_id": 1, "title": 1, "title_source": 1, "model": 1, "created_at": 1}
+
+// cursorRange 按 (created_at, _id) 排序时位于游标之前 (older) 或之后的 $or 条件，
+// 创建时间相同的记录用 _id 区分
+func cursorRange(createdAt time.Time, id string, older bool) []bson.M {
+	op := "$gt"
+	if older {
+		op = "$lt"
+	}
+	return []bson.M{
+		{"created_at": bson.M{op: createdAt}},
+		{"created_at": createdAt, "_id": bson.M{op: id}},
+	}
+}
+
+// pageDirection 返回游标 ID 以及是否向更早的方向翻页
+func pageDirection(q models.PageQuery) (string, bool) {
+	if q.After != "" {
+		return q.After, false
+	}
+	return q.Before, true
+}
+
+// ListChats 分页获取用户的聊天列表，按创建时间从新到旧排列，每项带有消息数和最后一条消息的预览
+func (r *ChatRepository) ListChats(ctx context.Context, userID string, q models.PageQuery) (*models.ChatPage, error) {
+	filter := bson.M{"user_id": userID}
+	cursorID, older := pageDirection(q)
+	if cursorID != "" {
+		var c models.Chat
+		err := r.collection.FindOne(ctx, chatFilter(userID, cursorID),
+			options.FindOne().SetProjection(bson.M{"created_at": 1})).Decode(&c)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, cursorID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		filter["$or"] = cursorRange(c.CreatedAt, c.ID, older)
+	}
+
+	// 向新的方向翻页时按升序取紧挨着游标的一页，之后再反转
+	dir := -1
+	if !older {
+		dir = 1
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(q.Limit+1)).
+		SetProjection(chatSummaryProjection))
+	if err != nil {
+		return nil, err
+	}
+
+	chats := []models.ChatSummary{}
+	if err = cursor.All(ctx, &chats); err != nil {
+		return nil, err
+	}
+
+	more := len(chats) > q.Limit
+	if more {
+		chats = chats[:q.Limit]
+	}
+	page := &models.ChatPage{Chats: chats}
+	if !older {
+		for i, j := 0, len(chats)-1; i < j; i, j = i+1, j-1 {
+			chats[i], chats[j] = chats[j], chats[i]
+		}
+	}
+	if more {
+		if older {
+			page.NextCursor = chats[len(chats)-1].ID
+		} else {
+			page.NextCursor = chats[0].ID
+		}
+	}
+
+	if err := r.attachMessageStats(ctx, chats); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// attachMessageStats 一次查询所有聊天的消息数和最后一条消息
+func (r *ChatRepository) attachMessageStats(ctx context.Context, chats []models.ChatSummary) error {
+	if len(chats) == 0 {
+		return nil
+	}
+	ids := make([]string, len(chats))
+	for i, c := range chats {
+		ids[i] = c.ID
+	}
+
+	cursor, err := GetCollection(MessageCollection).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"chat_id": bson.M{"$in": ids}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "chat_id", Value: 1}, {Key: "created_at", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$chat_id",
+			"count": bson.M{"$sum": 1},
+			"last": bson.M{"$first": bson.M{
+				"_id":        "$_id",
+				"role":       "$role",
+				"preview":    bson.M{"$substrCP": bson.A{"$content", 0, messagePreviewLength}},
+				"created_at": "$created_at",
+			}},
+		}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to aggregate chat messages: %w", err)
+	}
+
+	var stats []struct {
+		ChatID string                `bson:"_id"`
+		Count  int64                 `bson:"count"`
+		Last   models.MessagePreview `bson:"last"`
+	}
+	if err = cursor.All(ctx, &stats); err != nil {
+		return err
+	}
+
+	byChat := make(map[string]int, len(chats))
+	for i, c := range chats {
+		byChat[c.ID] = i
+	}
+	for _, s := range stats {
+		i, ok := byChat[s.ChatID]
+		if !ok {
+			continue
+		}
+		last := s.Last
+		// 预览显示在一行中
+		last.Preview = strings.Join(strings.Fields(last.Preview), " ")
+		chats[i].MessageCount = s.Count
+		chats[i].LastMessage = &last
+	}
+	return nil
+}
+
+// GetActivePathPage 在当前分支上分页获取消息。先只读取消息的 ID 和父消息确定分支，
+// 再读取这一页消息的内容，长对话不需要每次加载全部内容。
+func (r *ChatRepository) GetActivePathPage(ctx context.Context, userID string, chatID string, q models.PageQuery) (*models.MessagePage, error) {
+	chat, err := r.GetChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.migrateLegacyMessages(ctx, chat); err != nil {
+		return nil, err
+	}
+
+	collection := GetCollection(MessageCollection)
+	cursor, err := collection.Find(ctx, bson.M{"chat_id": chatID}, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(bson.M{"_id": 1, "parent_id": 1, "created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var skeleton []models.Message
+	if err = cursor.All(ctx, &skeleton); err != nil {
+		return nil, err
+	}
+
+	path := models.ActivePath(skeleton, chat.ActiveLeafID)
+	ids := make([]string, len(path))
+	for i, m := range path {
+		ids[i] = m.ID
+	}
+	start, end, next, ok := models.PageBounds(ids, q)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, q.Before+q.After)
+	}
+	path = path[start:end]
+
+	page := &models.MessagePage{Messages: []models.Message{}, NextCursor: next}
+	if len(path) == 0 {
+		return page, nil
+	}
+
+	full, err := r.FindMessagesByID(ctx, []string{chatID}, ids[start:end])
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range path {
+		if message, ok := full[m.ID]; ok {
+			message.Siblings = m.Siblings
+			page.Messages = append(page.Messages, message)
+		}
+	}
+	return page, nil
+}
+
+// GetMessagesPage 分页获取聊天的全部消息（包括所有分支），按创建时间从旧到新排列
+func (r *ChatRepository) GetMessagesPage(ctx context.Context, userID string, chatID string, q models.PageQuery) (*models.MessagePage, error) {
+	chat, err := r.GetChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.migrateLegacyMessages(ctx, chat); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"chat_id": chatID}
+	cursorID, older := pageDirection(q)
+	if cursorID != "" {
+		m, err := r.findMessage(ctx, chatID, cursorID)
+		if errors.Is(err, ErrMessageNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, cursorID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		filter["$or"] = cursorRange(m.CreatedAt, m.ID, older)
+	}
+
+	// 默认和向前翻页时取紧挨着游标的最新一页，之后反转为从旧到新
+	dir := -1
+	if !older {
+		dir = 1
+	}
+	cursor, err := GetCollection(MessageCollection).Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(q.Limit+1)))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.Message{}
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	more := len(messages) > q.Limit
+	if more {
+		messages = messages[:q.Limit]
+	}
+	if older {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	page := &models.MessagePage{Messages: messages}
+	if more {
+		if older {
+			page.NextCursor = messages[0].ID
+		} else {
+			page.NextCursor = messages[len(messages)-1].ID
+		}
+	}
+	return page, nil
+}
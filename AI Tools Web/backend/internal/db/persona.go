@@ -0,0 +1,117 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrPersonaNotFound 角色不存在或对当前用户不可见
+var ErrPersonaNotFound = errors.New("persona not found")
+
+// visibleTo 用户自己的和全局的角色或模板
+func visibleTo(email string) bson.M {
+	return bson.M{"$or": []bson.M{{"owner_email": email}, {"global": true}}}
+}
+
+// PersonaRepository 管理助手角色
+type PersonaRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPersonaRepository 创建新的 PersonaRepository 实例
+func NewPersonaRepository() *PersonaRepository {
+	return &PersonaRepository{
+		collection: GetCollection(PersonaCollection),
+	}
+}
+
+// CreatePersona 保存新的角色
+func (r *PersonaRepository) CreatePersona(ctx context.Context, persona *models.Persona) error {
+	if persona.ID == "" {
+		persona.ID = primitive.NewObjectID().Hex()
+	}
+	persona.CreatedAt = time.Now()
+	persona.UpdatedAt = persona.CreatedAt
+	_, err := r.collection.InsertOne(ctx, persona)
+	return err
+}
+
+// ListPersonas 列出用户可用的角色：全局角色在前，然后按名称排序
+func (r *PersonaRepository) ListPersonas(ctx context.Context, email string) ([]models.Persona, error) {
+	cursor, err := r.collection.Find(ctx, visibleTo(email), options.Find().
+		SetSort(bson.D{{Key: "global", Value: -1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	personas := []models.Persona{}
+	if err = cursor.All(ctx, &personas); err != nil {
+		return nil, err
+	}
+	return personas, nil
+}
+
+// GetPersona 获取用户可用的角色
+func (r *PersonaRepository) GetPersona(ctx context.Context, email, id string) (*models.Persona, error) {
+	filter := visibleTo(email)
+	filter["_id"] = id
+	var persona models.Persona
+	if err := r.collection.FindOne(ctx, filter).Decode(&persona); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: %s", ErrPersonaNotFound, id)
+		}
+		return nil, fmt.Errorf("error finding persona: %w", err)
+	}
+	return &persona, nil
+}
+
+// UpdatePersona 保存修改后的角色，调用方负责检查修改权限
+func (r *PersonaRepository) UpdatePersona(ctx context.Context, persona *models.Persona) error {
+	persona.UpdatedAt = time.Now()
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": persona.ID}, persona)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrPersonaNotFound, persona.ID)
+	}
+	return nil
+}
+
+// DeletePersona 删除角色，调用方负责检查删除权限。使用该角色的聊天保留，之后不再应用角色设置。
+func (r *PersonaRepository) DeletePersona(ctx context.Context, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrPersonaNotFound, id)
+	}
+	return nil
+}
+
+// DeleteUserPersonas 删除用户的角色。用户创建的全局角色其他人仍在使用，只去掉创建者。
+func (r *PersonaRepository) DeleteUserPersonas(ctx context.Context, email string) (int64, error) {
+	return deleteOwned(ctx, r.collection, email)
+}
+
+// deleteOwned 删除用户自己的角色或模板，保留全局的并去掉创建者
+func deleteOwned(ctx context.Context, collection *mongo.Collection, email string) (int64, error) {
+	result, err := collection.DeleteMany(ctx, bson.M{"owner_email": email, "global": false})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := collection.UpdateMany(ctx, bson.M{"owner_email": email},
+		bson.M{"$unset": bson.M{"owner_email": ""}}); err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
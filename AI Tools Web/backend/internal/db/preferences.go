@@ -0,0 +1,52 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PreferencesRepository 管理用户偏好，每个用户一条记录，以邮箱作为 _id
+type PreferencesRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPreferencesRepository 创建新的 PreferencesRepository 实例
+func NewPreferencesRepository() *PreferencesRepository {
+	return &PreferencesRepository{
+		collection: GetCollection(PreferencesCollection),
+	}
+}
+
+// GetPreferences 获取用户偏好，没有保存过时返回 nil
+func (r *PreferencesRepository) GetPreferences(ctx context.Context, email string) (*models.UserPreferences, error) {
+	var prefs models.UserPreferences
+	err := r.collection.FindOne(ctx, bson.M{"_id": email}).Decode(&prefs)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// SavePreferences 保存（替换）用户偏好
+func (r *PreferencesRepository) SavePreferences(ctx context.Context, prefs *models.UserPreferences) error {
+	prefs.UpdatedAt = time.Now()
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": prefs.UserEmail}, prefs, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DeletePreferences 删除用户偏好，恢复默认值
+func (r *PreferencesRepository) DeletePreferences(ctx context.Context, email string) (bool, error) {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": email})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrTemplateNotFound 模板不存在或对当前用户不可见
+var ErrTemplateNotFound = errors.New("prompt template not found")
+
+// PromptTemplateRepository 管理提示模板
+type PromptTemplateRepository struct {
+	collection *mongo.Collection
+}
+
+// NewPromptTemplateRepository 创建新的 PromptTemplateRepository 实例
+func NewPromptTemplateRepository() *PromptTemplateRepository {
+	return &PromptTemplateRepository{
+		collection: GetCollection(PromptTemplateCollection),
+	}
+}
+
+// CreateTemplate 保存新的模板
+func (r *PromptTemplateRepository) CreateTemplate(ctx context.Context, template *models.PromptTemplate) error {
+	if template.ID == "" {
+		template.ID = primitive.NewObjectID().Hex()
+	}
+	template.Variables = models.TemplateVariables(template.Content)
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = template.CreatedAt
+	_, err := r.collection.InsertOne(ctx, template)
+	return err
+}
+
+// ListTemplates 列出用户可用的模板：全局模板在前，然后按名称排序
+func (r *PromptTemplateRepository) ListTemplates(ctx context.Context, email string) ([]models.PromptTemplate, error) {
+	cursor, err := r.collection.Find(ctx, visibleTo(email), options.Find().
+		SetSort(bson.D{{Key: "global", Value: -1}, {Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []models.PromptTemplate{}
+	if err = cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetTemplate 获取用户可用的模板
+func (r *PromptTemplateRepository) GetTemplate(ctx context.Context, email, id string) (*models.PromptTemplate, error) {
+	filter := visibleTo(email)
+	filter["_id"] = id
+	var template models.PromptTemplate
+	if err := r.collection.FindOne(ctx, filter).Decode(&template); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+		}
+		return nil, fmt.Errorf("error finding prompt template: %w", err)
+	}
+	return &template, nil
+}
+
+// UpdateTemplate 保存修改后的模板，调用方负责检查修改权限
+func (r *PromptTemplateRepository) UpdateTemplate(ctx context.Context, template *models.PromptTemplate) error {
+	template.Variables = models.TemplateVariables(template.Content)
+	template.UpdatedAt = time.Now()
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": template.ID}, template)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, template.ID)
+	}
+	return nil
+}
+
+// DeleteTemplate 删除模板，调用方负责检查删除权限
+func (r *PromptTemplateRepository) DeleteTemplate(ctx context.Context, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	return nil
+}
+
+// DeleteUserTemplates 删除用户的模板，全局模板保留并去掉创建者
+func (r *PromptTemplateRepository) DeleteUserTemplates(ctx context.Context, email string) (int64, error) {
+	return deleteOwned(ctx, r.collection, email)
+}
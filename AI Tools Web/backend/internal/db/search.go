@@ -0,0 +1,120 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"fmt"
+	"regexp"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChatTitles 返回用户所有聊天的标题（按聊天 ID 索引），搜索结果限定在这些聊天中
+func (r *ChatRepository) ChatTitles(ctx context.Context, userID string) (map[string]string, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetProjection(bson.M{"_id": 1, "title": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user chats: %w", err)
+	}
+
+	var chats []models.Chat
+	if err = cursor.All(ctx, &chats); err != nil {
+		return nil, err
+	}
+
+	titles := make(map[string]string, len(chats))
+	for _, chat := range chats {
+		titles[chat.ID] = chat.Title
+	}
+	return titles, nil
+}
+
+// containsCJK 检查查询中是否有中日韩文字。MongoDB 的全文索引不能对这些文字分词，
+// 这类查询改用不区分大小写的子串匹配。
+func containsCJK(query string) bool {
+	for _, r := range query {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchMessages 在 chatIDs 对应的聊天中搜索消息，返回当前页的结果和匹配总数。
+// 全文搜索的结果按相关度排序，子串匹配的结果按时间倒序。
+func (r *ChatRepository) SearchMessages(ctx context.Context, chatIDs []string, query string, skip, limit int) ([]models.SearchHit, int64, error) {
+	if len(chatIDs) == 0 {
+		return nil, 0, nil
+	}
+
+	filter := bson.M{"chat_id": bson.M{"$in": chatIDs}}
+	opts := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit))
+	if containsCJK(query) {
+		// 每个词都必须出现
+		var conditions []bson.M
+		for _, term := range models.SearchTerms(query) {
+			conditions = append(conditions, bson.M{"content": bson.M{"$regex": regexp.QuoteMeta(term), "$options": "i"}})
+		}
+		if len(conditions) == 0 {
+			return nil, 0, nil
+		}
+		filter["$and"] = conditions
+		opts.SetSort(bson.D{{Key: "created_at", Value: -1}})
+	} else {
+		filter["$text"] = bson.M{"$search": query}
+		opts.SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "created_at", Value: -1}})
+	}
+
+	collection := GetCollection(MessageCollection)
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if total == 0 {
+		return nil, 0, nil
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	var docs []struct {
+		models.Message `bson:",inline"`
+		Score          float64 `bson:"score"`
+	}
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]models.SearchHit, len(docs))
+	for i, doc := range docs {
+		hits[i] = models.SearchHit{Message: doc.Message, Score: doc.Score}
+	}
+	return hits, total, nil
+}
+
+// FindMessagesByID 查询 chatIDs 对应的聊天中的指定消息，不在这些聊天中的消息被忽略
+func (r *ChatRepository) FindMessagesByID(ctx context.Context, chatIDs []string, messageIDs []string) (map[string]models.Message, error) {
+	cursor, err := GetCollection(MessageCollection).Find(ctx, bson.M{
+		"_id":     bson.M{"$in": messageIDs},
+		"chat_id": bson.M{"$in": chatIDs},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []models.Message
+	if err = cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.Message, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+	return byID, nil
+}
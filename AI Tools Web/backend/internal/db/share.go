@@ -0,0 +1,100 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrShareNotFound 分享不存在、已过期或已撤销
+var ErrShareNotFound = errors.New("share not found")
+
+// ShareRepository 管理聊天的公开分享
+type ShareRepository struct {
+	collection *mongo.Collection
+}
+
+// NewShareRepository 创建新的 ShareRepository 实例
+func NewShareRepository() *ShareRepository {
+	return &ShareRepository{
+		collection: GetCollection(ChatShareCollection),
+	}
+}
+
+// notExpired 未过期的分享
+func notExpired() []bson.M {
+	return []bson.M{
+		{"expires_at": bson.M{"$exists": false}},
+		{"expires_at": bson.M{"$gt": time.Now()}},
+	}
+}
+
+// CreateShare 保存分享及其消息快照
+func (r *ShareRepository) CreateShare(ctx context.Context, share *models.ChatShare) error {
+	if share.ID == "" {
+		share.ID = primitive.NewObjectID().Hex()
+	}
+	if share.CreatedAt.IsZero() {
+		share.CreatedAt = time.Now()
+	}
+	share.MessageCount = len(share.Messages)
+	_, err := r.collection.InsertOne(ctx, share)
+	return err
+}
+
+// CountChatShares 统计聊天的有效分享数量
+func (r *ShareRepository) CountChatShares(ctx context.Context, email, chatID string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"user_email": email, "chat_id": chatID, "$or": notExpired()})
+}
+
+// ListShares 列出用户未过期的分享，按创建时间倒序，chatID 不为空时只列出该聊天的分享。不读取消息快照。
+func (r *ShareRepository) ListShares(ctx context.Context, email, chatID string) ([]models.ChatShare, error) {
+	filter := bson.M{"user_email": email, "$or": notExpired()}
+	if chatID != "" {
+		filter["chat_id"] = chatID
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"messages": 0}))
+	if err != nil {
+		return nil, err
+	}
+
+	shares := []models.ChatShare{}
+	if err = cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// GetShareByHash 根据令牌哈希获取未过期的分享，包括消息快照
+func (r *ShareRepository) GetShareByHash(ctx context.Context, tokenHash string) (*models.ChatShare, error) {
+	var share models.ChatShare
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash, "$or": notExpired()}).Decode(&share)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrShareNotFound
+		}
+		return nil, fmt.Errorf("error finding share: %w", err)
+	}
+	return &share, nil
+}
+
+// DeleteShare 撤销用户的分享
+func (r *ShareRepository) DeleteShare(ctx context.Context, email, id string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_email": email})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
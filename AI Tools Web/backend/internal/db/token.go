@@ -0,0 +1,167 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRefreshTokenNotFound 刷新令牌不存在或已过期
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用
+var ErrRefreshTokenReused = errors.New("refresh token already used")
+
+// ErrActionTokenUsed 邮箱验证或密码重置令牌已被使用
+var ErrActionTokenUsed = errors.New("action token already used")
+
+// TokenRepository 管理刷新令牌和访问令牌撤销记录
+type TokenRepository struct {
+	refreshTokens *mongo.Collection
+	revokedTokens *mongo.Collection
+}
+
+// NewTokenRepository 创建新的 TokenRepository 实例
+func NewTokenRepository() *TokenRepository {
+	return &TokenRepository{
+		refreshTokens: GetCollection(RefreshTokenCollection),
+		revokedTokens: GetCollection(RevokedTokenCollection),
+	}
+}
+
+// SaveRefreshToken 保存新的刷新令牌
+func (r *TokenRepository) SaveRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	_, err := r.refreshTokens.InsertOne(ctx, token)
+	return err
+}
+
+// GetRefreshToken 根据令牌哈希获取未过期的刷新令牌
+func (r *TokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.refreshTokens.FindOne(ctx, bson.M{
+		"_id":        tokenHash,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("error finding refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken 将旧令牌标记为已使用并保存替代它的新令牌。
+// 旧令牌已被使用过时返回 ErrRefreshTokenReused。
+func (r *TokenRepository) RotateRefreshToken(ctx context.Context, oldHash string, next *models.RefreshToken) error {
+	now := time.Now()
+	result, err := r.refreshTokens.UpdateOne(ctx,
+		bson.M{"_id": oldHash, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now, "replaced_by": next.ID}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	return r.SaveRefreshToken(ctx, next)
+}
+
+// RevokeRefreshToken 撤销单个刷新令牌
+func (r *TokenRepository) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := r.refreshTokens.UpdateOne(ctx,
+		bson.M{"_id": tokenHash, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeTokenFamily 撤销同一登录会话轮换出的所有刷新令牌
+func (r *TokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	_, err := r.refreshTokens.UpdateMany(ctx,
+		bson.M{"family_id": familyID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeUserRefreshTokens 撤销用户的所有刷新令牌
+func (r *TokenRepository) RevokeUserRefreshTokens(ctx context.Context, email string) error {
+	_, err := r.refreshTokens.UpdateMany(ctx,
+		bson.M{"user_email": email, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeAccessToken 按 jti 撤销访问令牌，记录保留到令牌自然过期
+func (r *TokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	now := time.Now()
+	_, err := r.revokedTokens.UpdateOne(ctx,
+		bson.M{"_id": "jti:" + jti},
+		bson.M{"$set": bson.M{
+			"jti":        jti,
+			"created_at": now,
+			"expires_at": expiresAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// RevokeUserAccessTokens 撤销用户到当前时间为止签发的所有访问令牌。令牌的签发时间只精确到秒，
+// 与撤销同一秒内签发的令牌也会失效；exceptJTI 不为空时，该令牌（撤销时为当前客户端新签发的）保留。
+func (r *TokenRepository) RevokeUserAccessTokens(ctx context.Context, email string, maxTokenTTL time.Duration, exceptJTI string) error {
+	now := time.Now()
+	_, err := r.revokedTokens.UpdateOne(ctx,
+		bson.M{"_id": "user:" + email},
+		bson.M{"$set": bson.M{
+			"user_email":     email,
+			"revoked_before": now,
+			"except_jti":     exceptJTI,
+			"created_at":     now,
+			"expires_at":     now.Add(maxTokenTTL),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsAccessTokenRevoked 检查访问令牌是否已被撤销
+func (r *TokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string, email string, issuedAt time.Time) (bool, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"_id": "jti:" + jti},
+		{"_id": "user:" + email, "revoked_before": bson.M{"$gte": issuedAt}, "except_jti": bson.M{"$ne": jti}},
+	}}
+
+	count, err := r.revokedTokens.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("error checking token revocation: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ConsumeActionToken 记录一次性令牌已被使用，令牌已使用过时返回 ErrActionTokenUsed
+func (r *TokenRepository) ConsumeActionToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := r.revokedTokens.InsertOne(ctx, bson.M{
+		"_id":        "action:" + jti,
+		"jti":        jti,
+		"created_at": time.Now(),
+		"expires_at": expiresAt,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrActionTokenUsed
+	}
+	return err
+}
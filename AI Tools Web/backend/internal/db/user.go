@@ -0,0 +1,251 @@
+package db
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("user not found")
+
+// UserRepository 管理 users 集合
+type UserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewUserRepository 创建新的 UserRepository 实例
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		collection: GetCollection(UserCollection),
+	}
+}
+
+// userIDFilter 按 ID 构建查询条件。用户的 _id 由数据库生成为 ObjectID，十六进制 ID 只匹配 ObjectID，
+// 一个 ID 不会同时匹配到同值的字符串 _id 账户
+func userIDFilter(userID string) bson.M {
+	if oid, err := primitive.ObjectIDFromHex(userID); err == nil {
+		return bson.M{"_id": oid}
+	}
+	return bson.M{"_id": userID}
+}
+
+func (r *UserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error finding user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUserByEmail 根据邮箱获取用户
+func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+// GetUserByID 根据 ID 获取用户
+func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return r.findOne(ctx, userIDFilter(userID))
+}
+
+// GetUserByOIDC 根据单点登录身份获取用户
+func (r *UserRepository) GetUserByOIDC(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"oidc_issuer": issuer, "oidc_subject": subject})
+}
+
+// UsernameExists 检查用户名是否已被使用
+func (r *UserRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"username": username})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateUser 插入新用户并回填 ID
+func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	result, err := r.collection.InsertOne(ctx, user)
+	if err != nil {
+		return err
+	}
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		user.ID = oid.Hex()
+	}
+	return nil
+}
+
+// LinkOIDCIdentity 将单点登录身份关联到已有用户，已关联其他身份的用户不会被覆盖
+func (r *UserRepository) LinkOIDCIdentity(ctx context.Context, userID, issuer, subject string) error {
+	filter := userIDFilter(userID)
+	filter["$or"] = []bson.M{
+		{"oidc_subject": bson.M{"$exists": false}},
+		{"oidc_issuer": issuer, "oidc_subject": subject},
+	}
+	return r.updateUser(ctx, filter, bson.M{"oidc_issuer": issuer, "oidc_subject": subject})
+}
+
+// MarkEmailVerified 将用户邮箱标记为已验证
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, email string) error {
+	return r.updateUser(ctx, bson.M{"email": email}, bson.M{
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
+	})
+}
+
+// UpdatePassword 更新用户的密码哈希
+func (r *UserRepository) UpdatePassword(ctx context.Context, email, passwordHash string) error {
+	return r.updateUser(ctx, bson.M{"email": email}, bson.M{"password": passwordHash})
+}
+
+// SetPendingTOTPSecret 保存尚未确认的两步验证密钥
+func (r *UserRepository) SetPendingTOTPSecret(ctx context.Context, email, secret string) error {
+	return r.updateUser(ctx, bson.M{"email": email}, bson.M{"totp_pending_secret": secret})
+}
+
+// EnableTOTP 确认待启用的密钥并开启两步验证，密钥已变化时返回 ErrUserNotFound
+func (r *UserRepository) EnableTOTP(ctx context.Context, email, pendingSecret string, step int64, recoveryHashes []string) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"email": email, "totp_pending_secret": pendingSecret},
+		bson.M{
+			"$set": bson.M{
+				"totp_enabled":   true,
+				"totp_secret":    pendingSecret,
+				"totp_last_step": step,
+				"recovery_codes": recoveryHashes,
+			},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DisableTOTP 关闭两步验证并删除密钥和恢复码
+func (r *UserRepository) DisableTOTP(ctx context.Context, email string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{
+		"$unset": bson.M{
+			"totp_enabled":        "",
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      "",
+			"recovery_codes":      "",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// AdvanceTOTPStep 记录最近使用的时间步，只能前进，防止同一验证码被重复使用
+func (r *UserRepository) AdvanceTOTPStep(ctx context.Context, email string, step int64) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"email": email, "$or": []bson.M{
+			{"totp_last_step": bson.M{"$exists": false}},
+			{"totp_last_step": bson.M{"$lt": step}},
+		}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// SetRecoveryCodes 替换用户的恢复码
+func (r *UserRepository) SetRecoveryCodes(ctx context.Context, email string, hashes []string) error {
+	return r.updateUser(ctx, bson.M{"email": email}, bson.M{"recovery_codes": hashes})
+}
+
+// ConsumeRecoveryCode 原子地删除一个恢复码，恢复码不存在时返回 false
+func (r *UserRepository) ConsumeRecoveryCode(ctx context.Context, email, hash string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"email": email, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// ListUsers 按注册时间列出所有用户
+func (r *UserRepository) ListUsers(ctx context.Context) ([]models.User, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// updateUser 更新单个用户的字段
+func (r *UserRepository) updateUser(ctx context.Context, filter bson.M, set bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetDisabled 启用或禁用用户
+func (r *UserRepository) SetDisabled(ctx context.Context, userID string, disabled bool) error {
+	return r.updateUser(ctx, userIDFilter(userID), bson.M{"disabled": disabled})
+}
+
+// SetRole 修改用户角色。管理员设置的角色优先，之后不再按 ADMIN_EMAILS 自动授予。
+func (r *UserRepository) SetRole(ctx context.Context, userID string, role string) error {
+	return r.updateUser(ctx, userIDFilter(userID), bson.M{"role": role, "admin_bootstrapped": true})
+}
+
+// BootstrapAdmin 将邮箱已验证的用户设为管理员，每个账户只执行一次，之后通过管理接口修改的角色不会被覆盖。
+// 返回是否进行了授予。
+func (r *UserRepository) BootstrapAdmin(ctx context.Context, email string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"email": email, "email_verified": true, "admin_bootstrapped": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"role": models.RoleAdmin, "admin_bootstrapped": true}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// DeleteUser 删除用户记录
+func (r *UserRepository) DeleteUser(ctx context.Context, userID string) error {
+	result, err := r.collection.DeleteOne(ctx, userIDFilter(userID))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
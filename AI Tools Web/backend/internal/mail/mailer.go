@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends outgoing email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer 通过 SMTP 服务器发送邮件，本地开发可以指向 MailHog (localhost:1025)
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message through the configured SMTP server
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.Host, m.Port)
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		// PlainAuth 只在 TLS 连接或 localhost 上发送凭据
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.From, []string{msg.To}, buildMessage(m.From, msg))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to send mail via %s: %w", addr, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMessage 组装 RFC 5322 格式的邮件内容
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + headerValue(from) + "\r\n")
+	b.WriteString("To: " + headerValue(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue 去掉换行，防止邮件头注入
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
+
+// LogMailer 未配置 SMTP 时使用，只把邮件写入日志，方便开发调试
+type LogMailer struct{}
+
+// Send writes the message to the server log instead of delivering it
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail (not sent, SMTP_HOST not configured) to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+var (
+	defaultMailer Mailer
+	mailerMu      sync.Mutex
+)
+
+// NewMailerFromEnv 根据 SMTP_* 环境变量创建 Mailer，未配置 SMTP_HOST 时返回 LogMailer
+func NewMailerFromEnv() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogMailer{}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+// Default 返回全局使用的 Mailer，首次调用时根据环境变量创建
+func Default() Mailer {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	if defaultMailer == nil {
+		defaultMailer = NewMailerFromEnv()
+	}
+	return defaultMailer
+}
+
+// SetDefault 替换全局 Mailer，用于测试或接入其他邮件服务
+func SetDefault(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	defaultMailer = m
+}
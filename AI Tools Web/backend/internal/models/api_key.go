@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// APIKey 个人访问令牌，只保存令牌的 SHA-256 哈希
+type APIKey struct {
+	ID         string     `json:"id" bson:"_id"`
+	UserEmail  string     `json:"-" bson:"user_email"`
+	Name       string     `json:"name" bson:"name"`
+	Prefix     string     `json:"prefix" bson:"prefix"` // 令牌开头几位，便于用户辨认
+	KeyHash    string     `json:"-" bson:"key_hash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 附件类型：图片以多模态格式发送给支持视觉的模型，文本文件附加在消息内容中发送给任何模型
+const (
+	AttachmentKindImage = "image"
+	AttachmentKindText  = "text"
+)
+
+// 两家服务商都支持的图片格式
+var attachmentImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Attachment 消息中的附件信息，文件内容单独保存
+type Attachment struct {
+	ID       string `json:"id" bson:"id"`
+	Filename string `json:"filename" bson:"filename"`
+	MimeType string `json:"mime_type" bson:"mime_type"`
+	Kind     string `json:"kind" bson:"kind"`
+	Size     int64  `json:"size" bson:"size"`
+	// Data 文件内容，只在发送给模型前加载
+	Data []byte `json:"-" bson:"-"`
+}
+
+// AttachmentFile 上传的附件及其内容。没有用在消息中的附件到 ExpiresAt 时自动删除。
+type AttachmentFile struct {
+	ID        string     `json:"id" bson:"_id"`
+	UserEmail string     `json:"-" bson:"user_email"`
+	ChatID    string     `json:"chat_id,omitempty" bson:"chat_id,omitempty"`
+	Filename  string     `json:"filename" bson:"filename"`
+	MimeType  string     `json:"mime_type" bson:"mime_type"`
+	Kind      string     `json:"kind" bson:"kind"`
+	Size      int64      `json:"size" bson:"size"`
+	Data      []byte     `json:"-" bson:"data,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// Ref 返回保存在消息中的附件信息
+func (f *AttachmentFile) Ref() Attachment {
+	return Attachment{ID: f.ID, Filename: f.Filename, MimeType: f.MimeType, Kind: f.Kind, Size: f.Size, Data: f.Data}
+}
+
+// DetectAttachmentType 根据文件内容判断附件类型，不信任客户端提供的 Content-Type。
+// 支持 PNG、JPEG、GIF、WebP 图片和 UTF-8 文本文件，其他类型 ok 为 false。
+func DetectAttachmentType(filename string, data []byte) (mimeType, kind string, ok bool) {
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if attachmentImageTypes[detected] {
+		return detected, AttachmentKindImage, true
+	}
+	if strings.HasPrefix(detected, "text/") && utf8.Valid(data) {
+		// 源代码、Markdown、CSV 等都按纯文本处理，保留扩展名对应的类型便于显示
+		if byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(filename))); err == nil && strings.HasPrefix(byExt, "text/") {
+			return byExt, AttachmentKindText, true
+		}
+		return "text/plain", AttachmentKindText, true
+	}
+	return detected, "", false
+}
+
+// DataURL 以 data URL 表示图片，用于 OpenAI 的 image_url
+func (a Attachment) DataURL() string {
+	return fmt.Sprintf("data:%s;base64,%s", a.MimeType, base64.StdEncoding.EncodeToString(a.Data))
+}
+
+// Images 返回消息中已加载内容的图片附件
+func (m Message) Images() []Attachment {
+	var images []Attachment
+	for _, a := range m.Attachments {
+		if a.Kind == AttachmentKindImage && len(a.Data) > 0 {
+			images = append(images, a)
+		}
+	}
+	return images
+}
+
+// HasImages 判断消息中是否有图片附件（不要求已加载内容）
+func HasImages(messages []Message) bool {
+	for _, m := range messages {
+		for _, a := range m.Attachments {
+			if a.Kind == AttachmentKindImage {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithTextAttachments 把文本附件的内容附加到消息内容中，每个文件放在 <file> 标签里
+func WithTextAttachments(content string, attachments []Attachment) string {
+	var b strings.Builder
+	b.WriteString(content)
+	for _, a := range attachments {
+		if a.Kind != AttachmentKindText || len(a.Data) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "<file name=%q>\n%s\n</file>", a.Filename, strings.TrimRight(string(a.Data), "\n"))
+	}
+	return b.String()
+}
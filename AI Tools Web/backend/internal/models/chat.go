@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type Chat struct {
 	ID        string    `json:"id" bson:"_id"`
@@ -8,14 +11,85 @@ type Chat struct {
 	Title     string    `json:"title" bson:"title"`
 	Model     string    `json:"model" bson:"model"`
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// ActiveLeafID 当前分支最后一条消息，历史和新消息都基于这条路径
+	ActiveLeafID string `json:"active_leaf_id,omitempty" bson:"active_leaf_id,omitempty"`
+	// TitleSource 标题的来源，为空表示还是默认标题
+	TitleSource string `json:"title_source,omitempty" bson:"title_source,omitempty"`
+	// PersonaID 创建聊天时选择的角色，角色的指令和参数用于之后的每次回复
+	PersonaID string `json:"persona_id,omitempty" bson:"persona_id,omitempty"`
+	// ContextSummary 较早对话的摘要，历史超出模型上下文时代替这些消息
+	ContextSummary *ContextSummary `json:"context_summary,omitempty" bson:"context_summary,omitempty"`
 }
 
+// ContextSummary 当前分支从第一条消息到 UpToMessageID 的摘要。
+// 切换分支后该消息不在当前分支上时摘要失效，需要时重新生成。
+type ContextSummary struct {
+	Content       string    `json:"content" bson:"content"`
+	UpToMessageID string    `json:"up_to_message_id" bson:"up_to_message_id"`
+	MessageCount  int       `json:"message_count" bson:"message_count"`
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// ContextInfo 生成回复时如何处理了超出上下文的历史，保存在回复中让用户知道模型没有看到完整的历史
+type ContextInfo struct {
+	Policy string `json:"policy" bson:"policy"`
+	// SummarizedMessages 被摘要代替的较早消息数
+	SummarizedMessages int `json:"summarized_messages,omitempty" bson:"summarized_messages,omitempty"`
+	// OmittedMessages 没有发送给模型的较早消息数
+	OmittedMessages int `json:"omitted_messages,omitempty" bson:"omitted_messages,omitempty"`
+	PromptTokens    int `json:"prompt_tokens" bson:"prompt_tokens"`
+	ContextWindow   int `json:"context_window" bson:"context_window"`
+}
+
+// 聊天标题的来源，用户设置的标题不会被自动生成的标题覆盖
+const (
+	TitleSourceAuto = "auto"
+	TitleSourceUser = "user"
+)
+
+// MaxChatTitleLength 自动生成的标题的最大长度（字符数）
+const MaxChatTitleLength = 50
+
+// CleanChatTitle 整理模型生成的标题：只取第一行，去掉 "Title:" 前缀、引号、
+// 结尾的标点和多余的空白，超长时截断
+func CleanChatTitle(raw string) string {
+	title := strings.TrimSpace(raw)
+	if i := strings.IndexAny(title, "\r\n"); i >= 0 {
+		title = title[:i]
+	}
+	for _, prefix := range []string{"Title:", "title:", "标题：", "标题:"} {
+		title = strings.TrimPrefix(title, prefix)
+	}
+	const quotes = " \t\"'`*#“”‘’「」《》"
+	title = strings.TrimLeft(title, quotes)
+	title = strings.TrimRight(title, quotes+".。!！?？,，;；:：")
+	title = strings.Join(strings.Fields(title), " ")
+
+	if runes := []rune(title); len(runes) > MaxChatTitleLength {
+		title = strings.TrimSpace(string(runes[:MaxChatTitleLength]))
+	}
+	return title
+}
+
+// MessageStatusIncomplete 流式生成中断时保存的部分回复
+const MessageStatusIncomplete = "incomplete"
+
 type Message struct {
 	ID        string    `json:"id" bson:"_id"`
 	ChatID    string    `json:"chat_id" bson:"chat_id"`
 	Role      string    `json:"role" bson:"role"`
 	Content   string    `json:"content" bson:"content"`
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// ParentID 上一条消息，为空表示对话的第一条消息。编辑和重新生成会在同一个父消息下产生新的分支
+	ParentID string `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	// Status 助手回复的状态，流式生成中断时为 incomplete，为空表示完整
+	Status string `json:"status,omitempty" bson:"status,omitempty"`
+	// Context 回复生成时较早的历史被摘要或省略，为空表示模型看到了完整的历史
+	Context *ContextInfo `json:"context,omitempty" bson:"context,omitempty"`
+	// Attachments 用户消息附带的图片和文件
+	Attachments []Attachment `json:"attachments,omitempty" bson:"attachments,omitempty"`
+	// Siblings 同一父消息下所有分支的消息 ID（按创建时间排序），只在返回当前路径时填充
+	Siblings []string `json:"siblings,omitempty" bson:"-"`
 }
 
 type ChatResponse struct {
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Document 上传到 RAG 服务的文档及其所属用户
+type Document struct {
+	ID         string    `json:"id" bson:"_id"` // RAG 服务返回的文档 ID
+	UserEmail  string    `json:"-" bson:"user_email"`
+	Filename   string    `json:"filename" bson:"filename"`
+	Size       int64     `json:"size" bson:"size"`
+	UploadedAt time.Time `json:"uploaded_at" bson:"uploaded_at"`
+}
@@ -0,0 +1,301 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ChatExportVersion JSON 导出格式的版本，导入时拒绝更新的版本
+const ChatExportVersion = 1
+
+// 聊天导出格式，同时用作文件扩展名
+const (
+	ExportFormatMarkdown = "md"
+	ExportFormatHTML     = "html"
+	ExportFormatJSON     = "json"
+)
+
+// IsValidExportFormat 检查导出格式是否受支持
+func IsValidExportFormat(format string) bool {
+	return format == ExportFormatMarkdown || format == ExportFormatHTML || format == ExportFormatJSON
+}
+
+// ExportContentType 返回导出格式的 Content-Type
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatHTML:
+		return "text/html; charset=utf-8"
+	case ExportFormatJSON:
+		return "application/json"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+// ChatExport 一个聊天的导出内容。JSON 格式包含所有分支的消息，可以原样导入；
+// Markdown 和 HTML 只包含当前分支，便于阅读。
+type ChatExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Chat       Chat      `json:"chat"`
+	Messages   []Message `json:"messages"`
+}
+
+// NewChatExport 创建导出内容，去掉只在本系统内有意义的字段
+func NewChatExport(chat Chat, messages []Message, now time.Time) *ChatExport {
+	chat.UserID = ""
+	chat.ContextSummary = nil
+	if messages == nil {
+		messages = []Message{}
+	}
+	return &ChatExport{Version: ChatExportVersion, ExportedAt: now, Chat: chat, Messages: messages}
+}
+
+// exportTime 导出中显示的时间
+func exportTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+// roleName 导出中显示的角色名
+func roleName(role string) string {
+	if role == "assistant" {
+		return "Assistant"
+	}
+	return "User"
+}
+
+// fenceLine 匹配代码块的开始或结束行，分组为语言
+var fenceLine = regexp.MustCompile("^\\s*```\\s*([\\w+#.-]*)")
+
+// closeFences 中断的回复可能停在代码块中间，补上结束标记，避免吞掉后面的内容
+func closeFences(content string) string {
+	open := false
+	for _, line := range strings.Split(content, "\n") {
+		if fenceLine.MatchString(line) {
+			open = !open
+		}
+	}
+	if open {
+		return content + "\n```"
+	}
+	return content
+}
+
+// RenderMarkdown 将当前分支渲染为 Markdown，消息内容原样保留，代码块不受影响
+func RenderMarkdown(e *ChatExport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", e.Chat.Title)
+	fmt.Fprintf(&b, "- Model: %s\n", e.Chat.Model)
+	fmt.Fprintf(&b, "- Created: %s\n", exportTime(e.Chat.CreatedAt))
+	fmt.Fprintf(&b, "- Exported: %s\n", exportTime(e.ExportedAt))
+
+	for _, m := range ActivePath(e.Messages, e.Chat.ActiveLeafID) {
+		fmt.Fprintf(&b, "\n---\n\n**%s** · %s", roleName(m.Role), exportTime(m.CreatedAt))
+		if m.Status == MessageStatusIncomplete {
+			b.WriteString(" · *incomplete*")
+		}
+		fmt.Fprintf(&b, "\n\n%s\n", closeFences(strings.TrimRight(m.Content, "\n")))
+	}
+	return b.String()
+}
+
+// inlineCode 匹配行内代码
+var inlineCode = regexp.MustCompile("`([^`\n]+)`")
+
+// contentToHTML 将消息内容转换为 HTML：代码块放在 <pre><code> 中并标注语言，
+// 其余文本按空行分段，保留换行和行内代码
+func contentToHTML(content string) string {
+	var b strings.Builder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		text := html.EscapeString(strings.Join(paragraph, "\n"))
+		text = inlineCode.ReplaceAllString(text, "<code>$1</code>")
+		fmt.Fprintf(&b, "<p>%s</p>\n", strings.ReplaceAll(text, "\n", "<br>\n"))
+		paragraph = nil
+	}
+
+	var code []string
+	inCode, language := false, ""
+	for _, line := range strings.Split(content, "\n") {
+		match := fenceLine.FindStringSubmatch(line)
+		switch {
+		case match != nil && !inCode:
+			flush()
+			inCode, language, code = true, match[1], nil
+		case match != nil && inCode:
+			writeCodeBlock(&b, language, code)
+			inCode = false
+		case inCode:
+			code = append(code, line)
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	if inCode {
+		writeCodeBlock(&b, language, code)
+	}
+	flush()
+	return b.String()
+}
+
+// writeCodeBlock 写入一个代码块
+func writeCodeBlock(b *strings.Builder, language string, lines []string) {
+	class := ""
+	if language != "" {
+		class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(language))
+	}
+	fmt.Fprintf(b, "<pre><code%s>%s</code></pre>\n", class, html.EscapeString(strings.Join(lines, "\n")))
+}
+
+const exportHTMLStyle = `body{font-family:-apple-system,"Segoe UI",Roboto,"PingFang SC","Microsoft YaHei",sans-serif;max-width:860px;margin:2em auto;padding:0 1em;color:#222;line-height:1.6}
+.meta{color:#888;font-size:14px}
+.message{border-top:1px solid #eee;padding:1em 0}
+.message h2{font-size:15px;margin:0 0 .5em}
+.message.assistant h2{color:#389e0d}
+.message.user h2{color:#1677ff}
+.time{color:#999;font-weight:normal;font-size:13px}
+pre{background:#f6f8fa;padding:12px;border-radius:6px;overflow-x:auto}
+code{font-family:SFMono-Regular,Consolas,Menlo,monospace;font-size:13px}
+p code{background:#f6f8fa;padding:1px 4px;border-radius:3px}`
+
+// RenderHTML 将当前分支渲染为独立的 HTML 页面
+func RenderHTML(e *ChatExport) string {
+	var b strings.Builder
+	title := html.EscapeString(e.Chat.Title)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", title, exportHTMLStyle)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+	fmt.Fprintf(&b, "<p class=\"meta\">Model: %s · Created: %s · Exported: %s</p>\n",
+		html.EscapeString(e.Chat.Model), exportTime(e.Chat.CreatedAt), exportTime(e.ExportedAt))
+
+	for _, m := range ActivePath(e.Messages, e.Chat.ActiveLeafID) {
+		role := "user"
+		if m.Role == "assistant" {
+			role = "assistant"
+		}
+		fmt.Fprintf(&b, "<div class=\"message %s\">\n<h2>%s <span class=\"time\">%s", role, roleName(m.Role), exportTime(m.CreatedAt))
+		if m.Status == MessageStatusIncomplete {
+			b.WriteString(" · incomplete")
+		}
+		fmt.Fprintf(&b, "</span></h2>\n%s</div>\n", contentToHTML(m.Content))
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// RenderChatExport 按格式渲染导出内容
+func RenderChatExport(e *ChatExport, format string) ([]byte, error) {
+	switch format {
+	case ExportFormatMarkdown:
+		return []byte(RenderMarkdown(e)), nil
+	case ExportFormatHTML:
+		return []byte(RenderHTML(e)), nil
+	default:
+		return json.MarshalIndent(e, "", "  ")
+	}
+}
+
+// ExportFileName 导出文件名：标题中的文字和数字加上聊天 ID，ID 保证文件名不重复
+func ExportFileName(chat Chat, format string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range chat.Title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if runes := []rune(name); len(runes) > MaxChatTitleLength {
+		name = strings.TrimSuffix(string(runes[:MaxChatTitleLength]), "-")
+	}
+	if name == "" {
+		name = "chat"
+	}
+	return fmt.Sprintf("%s-%s.%s", name, chat.ID, format)
+}
+
+// ErrInvalidImport 导入的内容无法重建为聊天
+var ErrInvalidImport = errors.New("invalid chat import")
+
+func invalidImport(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidImport, fmt.Sprintf(format, args...))
+}
+
+// PrepareImport 检查 JSON 导出的内容，并为消息分配新的 ID（newID 生成 ID）。
+// 父消息按新 ID 重新连接，父消息必须出现在子消息之前；所有消息都没有 parent_id 时
+// 按顺序连成一条路径。缺少时间的消息使用 now 依次递增的时间。
+// 返回重建的消息和当前分支末端的新 ID。
+func PrepareImport(e *ChatExport, newID func() string, now time.Time) ([]Message, string, error) {
+	if e.Version > ChatExportVersion {
+		return nil, "", invalidImport("unsupported version %d", e.Version)
+	}
+	if len(e.Messages) == 0 {
+		return nil, "", invalidImport("no messages")
+	}
+
+	linear := true
+	for _, m := range e.Messages {
+		if m.ParentID != "" {
+			linear = false
+			break
+		}
+	}
+
+	ids := make(map[string]string, len(e.Messages))
+	messages := make([]Message, 0, len(e.Messages))
+	for i, m := range e.Messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return nil, "", invalidImport("message %d has invalid role %q", i+1, m.Role)
+		}
+		if strings.TrimSpace(m.Content) == "" && m.Status != MessageStatusIncomplete {
+			return nil, "", invalidImport("message %d is empty", i+1)
+		}
+
+		id := newID()
+		if m.ID != "" {
+			if _, dup := ids[m.ID]; dup {
+				return nil, "", invalidImport("duplicate message id %s", m.ID)
+			}
+			ids[m.ID] = id
+		}
+		if m.ParentID != "" {
+			parent, ok := ids[m.ParentID]
+			if !ok {
+				return nil, "", invalidImport("message %d references unknown parent %s", i+1, m.ParentID)
+			}
+			m.ParentID = parent
+		}
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = now.Add(time.Duration(i) * time.Millisecond)
+		}
+		m.ID = id
+		m.ChatID = ""
+		m.Siblings = nil
+		// 附件的文件不在导出内容中
+		m.Attachments = nil
+		messages = append(messages, m)
+	}
+
+	if linear {
+		chained, leafID := ChainMessages(messages)
+		return chained, leafID, nil
+	}
+	if leafID, ok := ids[e.Chat.ActiveLeafID]; ok {
+		return messages, leafID, nil
+	}
+	return messages, LatestLeaf(messages, ""), nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// 后台任务类型
+const (
+	JobTypeAccountDeletion = "account_deletion"
+)
+
+// 后台任务状态
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+// Job 持久化的后台任务，服务重启后未完成的任务会继续执行
+type Job struct {
+	ID          string           `json:"id" bson:"_id"`
+	Type        string           `json:"type" bson:"type"`
+	UserEmail   string           `json:"-" bson:"user_email"`
+	RequestedBy string           `json:"-" bson:"requested_by"`
+	Status      string           `json:"status" bson:"status"`
+	Attempts    int              `json:"attempts" bson:"attempts"`
+	Error       string           `json:"error,omitempty" bson:"error,omitempty"`
+	Result      map[string]int64 `json:"result,omitempty" bson:"result,omitempty"`
+	CreatedAt   time.Time        `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at" bson:"updated_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	// 结束的任务保留一段时间后由 MongoDB 自动清理
+	ExpiresAt *time.Time `json:"-" bson:"expires_at,omitempty"`
+}
+
+// Finished 任务是否已经结束（成功或最终失败）
+func (j *Job) Finished() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt 按账户或按 IP 统计的登录失败记录
+type LoginAttempt struct {
+	ID            string     `json:"id" bson:"_id"` // "email:<邮箱>" 或 "ip:<地址>"
+	Failures      int        `json:"failures" bson:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+	ExpiresAt     time.Time  `json:"expires_at" bson:"expires_at"`
+}
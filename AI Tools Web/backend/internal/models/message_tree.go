@@ -0,0 +1,89 @@
+package models
+
+import "sort"
+
+// 聊天消息通过 ParentID 组成一棵树，编辑或重新生成会在同一父消息下新增分支。
+// 以下函数都作用于一个聊天的全部消息。
+
+// childrenByParent 按父消息分组，每组按创建时间排序
+func childrenByParent(messages []Message) map[string][]Message {
+	children := make(map[string][]Message)
+	for _, m := range messages {
+		children[m.ParentID] = append(children[m.ParentID], m)
+	}
+	for _, group := range children {
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].CreatedAt.Before(group[j].CreatedAt)
+		})
+	}
+	return children
+}
+
+// ActivePath 返回从第一条消息到 leafID 的路径，每条消息的 Siblings 为同一父消息下的所有分支。
+// leafID 不存在时返回 nil。
+func ActivePath(messages []Message, leafID string) []Message {
+	byID := make(map[string]Message, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+
+	var path []Message
+	seen := make(map[string]bool)
+	for id := leafID; id != ""; {
+		m, ok := byID[id]
+		if !ok || seen[id] {
+			break
+		}
+		seen[id] = true
+		path = append(path, m)
+		id = m.ParentID
+	}
+
+	// 反转为从旧到新的顺序
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	children := childrenByParent(messages)
+	for i := range path {
+		group := children[path[i].ParentID]
+		if len(group) < 2 {
+			continue
+		}
+		path[i].Siblings = make([]string, len(group))
+		for j, sibling := range group {
+			path[i].Siblings[j] = sibling.ID
+		}
+	}
+	return path
+}
+
+// LatestLeaf 从 messageID 开始，每一层选择最新的分支，返回到达的最后一条消息。
+// 切换分支时用它恢复该分支上最近的对话。
+func LatestLeaf(messages []Message, messageID string) string {
+	children := childrenByParent(messages)
+	seen := make(map[string]bool)
+	leaf := messageID
+	for !seen[leaf] {
+		seen[leaf] = true
+		group := children[leaf]
+		if len(group) == 0 {
+			break
+		}
+		leaf = group[len(group)-1].ID
+	}
+	return leaf
+}
+
+// ChainMessages 将没有 ParentID 的旧消息按创建时间依次连接成一条路径，返回更新后的消息和最后一条消息的 ID。
+// messages 必须已按创建时间排序。
+func ChainMessages(messages []Message) ([]Message, string) {
+	chained := make([]Message, len(messages))
+	parent := ""
+	for i, m := range messages {
+		m.ParentID = parent
+		chained[i] = m
+		parent = m.ID
+	}
+	return chained, parent
+}
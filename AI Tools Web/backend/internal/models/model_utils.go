@@ -1,5 +1,7 @@
 package models
 
+import "strings"
+
 // GetAllValidModels 返回所有支持的模型列表，包括OpenAI和Anthropic模型
 func GetAllValidModels() []string {
 	var allModels []string
@@ -42,3 +44,53 @@ func GetModelUIName(modelName string) string {
 		return modelName // 如果没有映射，返回原始名称
 	}
 }
+
+// 各模型的上下文窗口（token 数）
+var modelContextWindows = map[string]int{
+	ModelGPT4:           8192,
+	ModelGPT4o:          128000,
+	ModelGPT4Turbo:      128000,
+	ModelGPT35Turbo:     16385,
+	ModelClaude35Sonnet: 200000,
+	ModelClaude3Opus:    200000,
+}
+
+// 未列出的模型使用保守的上下文窗口
+const (
+	defaultContextWindow       = 8192
+	defaultClaudeContextWindow = 200000
+)
+
+// ReplyTokenReserve 为回复预留的 token 数，与流式请求中的 max_tokens 一致
+const ReplyTokenReserve = 4000
+
+// 支持图片输入的 OpenAI 模型，Claude 3 系列都支持图片
+var openAIVisionModels = map[string]bool{
+	ModelGPT4o:     true,
+	ModelGPT4Turbo: true,
+}
+
+// SupportsVision 判断模型是否接受图片附件，支持模型别名
+func SupportsVision(model string) bool {
+	if actual, ok := ModelAliases[model]; ok {
+		model = actual
+	}
+	if IsAnthropicModel(model) {
+		return strings.HasPrefix(strings.ToLower(model), "claude-3")
+	}
+	return openAIVisionModels[model]
+}
+
+// ContextWindow 返回模型的上下文窗口（token 数），支持模型别名
+func ContextWindow(model string) int {
+	if actual, ok := ModelAliases[model]; ok {
+		model = actual
+	}
+	if window, ok := modelContextWindows[model]; ok {
+		return window
+	}
+	if IsAnthropicModel(model) {
+		return defaultClaudeContextWindow
+	}
+	return defaultContextWindow
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// OIDCState 单点登录授权请求的临时状态，回调时一次性取出
+type OIDCState struct {
+	ID           string    `bson:"_id"` // state 参数的哈希
+	Nonce        string    `bson:"nonce"`
+	CodeVerifier string    `bson:"code_verifier"`
+	CreatedAt    time.Time `bson:"created_at"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// PageQuery 游标分页参数。Before 和 After 是上一页返回的 ID，最多指定一个：
+// Before 取更早的一页，After 取更新的一页，都为空时取最新的一页。
+type PageQuery struct {
+	Before string
+	After  string
+	Limit  int
+}
+
+// MessagePreview 聊天列表中显示的最后一条消息
+type MessagePreview struct {
+	ID        string    `json:"id" bson:"_id"`
+	Role      string    `json:"role" bson:"role"`
+	Preview   string    `json:"preview" bson:"preview"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// ChatSummary 聊天列表中的一项，只包含列表需要的字段
+type ChatSummary struct {
+	ID           string          `json:"id" bson:"_id"`
+	Title        string          `json:"title" bson:"title"`
+	TitleSource  string          `json:"title_source,omitempty" bson:"title_source,omitempty"`
+	Model        string          `json:"model" bson:"model"`
+	CreatedAt    time.Time       `json:"created_at" bson:"created_at"`
+	MessageCount int64           `json:"message_count" bson:"-"`
+	LastMessage  *MessagePreview `json:"last_message,omitempty" bson:"-"`
+}
+
+// ChatPage 一页聊天列表，按创建时间从新到旧排列。NextCursor 为空表示没有更多
+type ChatPage struct {
+	Chats      []ChatSummary `json:"chats"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+// MessagePage 一页消息，按时间从旧到新排列。NextCursor 为空表示没有更多
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// PageBounds 在按时间排序的 ids 中确定一页的范围 [start, end)，
+// 并返回继续翻页的游标（沿同一方向，没有更多时为空）。游标不在 ids 中时 ok 为 false。
+func PageBounds(ids []string, q PageQuery) (start, end int, next string, ok bool) {
+	indexOf := func(id string) int {
+		for i, v := range ids {
+			if v == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	switch {
+	case q.After != "":
+		i := indexOf(q.After)
+		if i < 0 {
+			return 0, 0, "", false
+		}
+		start = i + 1
+		end = min(start+q.Limit, len(ids))
+		if end < len(ids) {
+			next = ids[end-1]
+		}
+	default:
+		end = len(ids)
+		if q.Before != "" {
+			if end = indexOf(q.Before); end < 0 {
+				return 0, 0, "", false
+			}
+		}
+		start = max(end-q.Limit, 0)
+		if start > 0 {
+			next = ids[start]
+		}
+	}
+	return start, end, next, true
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Persona 可复用的助手角色，例如“苏格拉底式导师”或“代码审查员”。
+// 用户创建的角色只有自己可见；管理员可以创建所有用户可见的全局角色。
+type Persona struct {
+	ID          string `json:"id" bson:"_id"`
+	OwnerEmail  string `json:"-" bson:"owner_email,omitempty"`
+	Global      bool   `json:"global" bson:"global"`
+	Name        string `json:"name" bson:"name"`
+	Description string `json:"description" bson:"description,omitempty"`
+	// Instructions 附加到系统提示中的角色指令
+	Instructions string `json:"instructions" bson:"instructions"`
+	// Model 从该角色创建的聊天默认使用的模型，为空时使用用户偏好
+	Model string `json:"model,omitempty" bson:"model,omitempty"`
+	// Temperature 为空时使用用户偏好
+	Temperature *float64 `json:"temperature,omitempty" bson:"temperature,omitempty"`
+	// StarterPrompts 新聊天中提供给用户的示例问题
+	StarterPrompts []string  `json:"starter_prompts" bson:"starter_prompts"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
+	// Editable 当前用户是否可以修改，只在响应中返回
+	Editable bool `json:"editable" bson:"-"`
+}
+
+// 角色的字段限制
+const (
+	MaxPersonaNameLength        = 80
+	MaxPersonaDescriptionLength = 500
+	MaxStarterPrompts           = 6
+	MaxStarterPromptLength      = 500
+)
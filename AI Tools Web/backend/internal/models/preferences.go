@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// 回复语言选项，auto 表示根据用户输入自动判断
+const (
+	LanguageEnglish = "english"
+	LanguageChinese = "chinese"
+	LanguageAuto    = "auto"
+)
+
+// 历史超出模型上下文时的处理方式：truncate 丢弃最早的几轮对话，summarize 用摘要代替较早的对话
+const (
+	ContextPolicyTruncate  = "truncate"
+	ContextPolicySummarize = "summarize"
+)
+
+// IsValidContextPolicy 检查上下文策略是否受支持
+func IsValidContextPolicy(policy string) bool {
+	return policy == ContextPolicyTruncate || policy == ContextPolicySummarize
+}
+
+// 未设置偏好时使用的默认值
+const (
+	DefaultChatModel = "gpt-3.5-turbo"
+	DefaultLanguage  = LanguageEnglish
+)
+
+// UserPreferences 用户的聊天偏好，请求中没有显式指定时使用
+type UserPreferences struct {
+	UserEmail     string    `json:"-" bson:"_id"`
+	DefaultModel  string    `json:"default_model" bson:"default_model,omitempty"`
+	Language      string    `json:"language" bson:"language,omitempty"`
+	Instructions  string    `json:"instructions" bson:"instructions,omitempty"`     // 附加到系统提示中的自定义指令
+	Temperature   *float64  `json:"temperature" bson:"temperature,omitempty"`       // 为空时使用模型默认值
+	ContextPolicy string    `json:"context_policy" bson:"context_policy,omitempty"` // 为空时使用服务器默认策略
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// IsValidLanguage 检查语言选项是否受支持
+func IsValidLanguage(language string) bool {
+	switch language {
+	case LanguageEnglish, LanguageChinese, LanguageAuto:
+		return true
+	}
+	return false
+}
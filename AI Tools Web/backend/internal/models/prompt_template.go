@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PromptTemplate 可复用的提示模板，内容中的 {{name}} 在发送时替换为变量的值。
+// 与角色一样，管理员可以创建所有用户可见的全局模板。
+type PromptTemplate struct {
+	ID          string `json:"id" bson:"_id"`
+	OwnerEmail  string `json:"-" bson:"owner_email,omitempty"`
+	Global      bool   `json:"global" bson:"global"`
+	Name        string `json:"name" bson:"name"`
+	Description string `json:"description" bson:"description,omitempty"`
+	Content     string `json:"content" bson:"content"`
+	// Variables 内容中的变量名，按第一次出现的顺序，保存时由 Content 生成
+	Variables []string  `json:"variables" bson:"variables"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	// Editable 当前用户是否可以修改，只在响应中返回
+	Editable bool `json:"editable" bson:"-"`
+}
+
+// 模板的字段限制
+const (
+	MaxTemplateNameLength    = 80
+	MaxTemplateContentLength = 8000
+)
+
+// templateVariable 匹配 {{name}}，变量名两边可以有空格
+var templateVariable = regexp.MustCompile(`\{\{\s*([\p{L}_][\p{L}\p{N}_]*)\s*\}\}`)
+
+// ErrMissingTemplateVariables 填充模板时缺少变量的值
+var ErrMissingTemplateVariables = errors.New("missing template variables")
+
+// TemplateVariables 返回模板中的变量名，去掉重复的
+func TemplateVariables(content string) []string {
+	variables := []string{}
+	seen := make(map[string]bool)
+	for _, match := range templateVariable.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			variables = append(variables, match[1])
+		}
+	}
+	return variables
+}
+
+// FillTemplate 用 values 替换模板中的变量。值原样插入，其中的 {{...}} 不会再被替换；
+// 任何变量没有值或值为空时返回 ErrMissingTemplateVariables，并列出缺少的变量。
+func FillTemplate(content string, values map[string]string) (string, error) {
+	var missing []string
+	for _, name := range TemplateVariables(content) {
+		if strings.TrimSpace(values[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrMissingTemplateVariables, strings.Join(missing, ", "))
+	}
+
+	return templateVariable.ReplaceAllStringFunc(content, func(match string) string {
+		return values[templateVariable.FindStringSubmatch(match)[1]]
+	}), nil
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 搜索模式：text 使用 MongoDB 全文索引，semantic 按向量相似度匹配意思相近的消息
+const (
+	SearchModeText     = "text"
+	SearchModeSemantic = "semantic"
+)
+
+// MessageEmbedding 消息内容的向量，用于语义搜索。UserID 冗余保存，查询时直接限定在用户范围内
+type MessageEmbedding struct {
+	MessageID string    `bson:"_id"`
+	ChatID    string    `bson:"chat_id"`
+	UserID    string    `bson:"user_id"`
+	Model     string    `bson:"model"`
+	Vector    []float32 `bson:"vector"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// SearchHit 一条匹配的消息
+type SearchHit struct {
+	Message Message
+	Score   float64
+}
+
+// SnippetPart 搜索结果片段的一部分，Match 为 true 的部分需要高亮。
+// 前端按顺序拼接，不需要把片段当作 HTML 渲染。
+type SnippetPart struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// SearchResult 返回给客户端的搜索结果
+type SearchResult struct {
+	ChatID    string        `json:"chat_id"`
+	ChatTitle string        `json:"chat_title"`
+	MessageID string        `json:"message_id"`
+	Role      string        `json:"role"`
+	CreatedAt time.Time     `json:"created_at"`
+	Score     float64       `json:"score"`
+	Snippet   []SnippetPart `json:"snippet"`
+}
+
+// SearchResponse 一页搜索结果
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Mode    string         `json:"mode"`
+	Results []SearchResult `json:"results"`
+	Page    int            `json:"page"`
+	Limit   int            `json:"limit"`
+	Total   int64          `json:"total"`
+	HasMore bool           `json:"has_more"`
+	// Pending 语义搜索时还没有建立向量、暂时搜不到的消息数
+	Pending int64 `json:"pending,omitempty"`
+}
+
+// SearchTerms 把查询拆成用于高亮的词：引号中的短语作为一个词，排除词 (-word) 被忽略
+func SearchTerms(query string) []string {
+	var terms []string
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			// 引号内的短语
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if strings.HasPrefix(word, "-") {
+				continue
+			}
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// BuildSnippet 截取 content 中第一个匹配附近最多 length 个字符，并标出片段中所有匹配的词（不区分大小写）。
+// 没有匹配时返回开头部分，被截掉的部分用省略号表示。
+func BuildSnippet(content string, terms []string, length int) []SnippetPart {
+	runes := []rune(content)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		// 换行和制表符替换为空格，片段显示在一行中
+		if r == '\n' || r == '\r' || r == '\t' {
+			r = ' '
+			runes[i] = r
+		}
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// 较长的词优先，避免短词截断长词的匹配
+	needles := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		if term = strings.TrimSpace(term); term != "" {
+			needles = append(needles, []rune(strings.ToLower(term)))
+		}
+	}
+	sort.Slice(needles, func(i, j int) bool { return len(needles[i]) > len(needles[j]) })
+
+	var matches [][2]int
+	for i := 0; i < len(lower); {
+		matched := 0
+		for _, needle := range needles {
+			if hasRunePrefix(lower[i:], needle) {
+				matched = len(needle)
+				break
+			}
+		}
+		if matched > 0 {
+			matches = append(matches, [2]int{i, i + matched})
+			i += matched
+		} else {
+			i++
+		}
+	}
+
+	// 第一个匹配前保留四分之一的上下文
+	start := 0
+	if len(matches) > 0 && matches[0][0] > length/4 {
+		start = matches[0][0] - length/4
+	}
+	end := start + length
+	if end > len(runes) {
+		end = len(runes)
+		if start = end - length; start < 0 {
+			start = 0
+		}
+	}
+
+	var parts []SnippetPart
+	add := func(text string, match bool) {
+		if text == "" {
+			return
+		}
+		if n := len(parts); n > 0 && parts[n-1].Match == match {
+			parts[n-1].Text += text
+			return
+		}
+		parts = append(parts, SnippetPart{Text: text, Match: match})
+	}
+
+	if start > 0 {
+		add("…", false)
+	}
+	pos := start
+	for _, m := range matches {
+		if m[1] <= start || m[0] >= end {
+			continue
+		}
+		from, to := max(m[0], start), min(m[1], end)
+		add(string(runes[pos:from]), false)
+		add(string(runes[from:to]), true)
+		pos = to
+	}
+	add(string(runes[pos:end]), false)
+	if end < len(runes) {
+		add("…", false)
+	}
+	return parts
+}
+
+func hasRunePrefix(s, prefix []rune) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CosineSimilarity 计算两个向量的余弦相似度，长度不同或为零向量时返回 0
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
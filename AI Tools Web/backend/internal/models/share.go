@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// ChatShare 聊天的公开只读分享。创建时保存当前分支的快照，之后的对话不会出现在分享中。
+// 只保存令牌的 SHA-256 哈希，链接只在创建时返回一次。
+type ChatShare struct {
+	ID           string          `json:"id" bson:"_id"`
+	UserEmail    string          `json:"-" bson:"user_email"`
+	ChatID       string          `json:"chat_id" bson:"chat_id"`
+	Title        string          `json:"title" bson:"title"`
+	Model        string          `json:"model" bson:"model"`
+	Prefix       string          `json:"prefix" bson:"prefix"` // 令牌开头几位，便于用户辨认
+	TokenHash    string          `json:"-" bson:"token_hash"`
+	MessageCount int             `json:"message_count" bson:"message_count"`
+	Messages     []SharedMessage `json:"-" bson:"messages,omitempty"`
+	CreatedAt    time.Time       `json:"created_at" bson:"created_at"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// SharedMessage 分享快照中的消息，只包含公开显示需要的字段
+type SharedMessage struct {
+	Role      string    `json:"role" bson:"role"`
+	Content   string    `json:"content" bson:"content"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	Status    string    `json:"status,omitempty" bson:"status,omitempty"`
+}
+
+// SharedChat 通过分享链接看到的聊天
+type SharedChat struct {
+	Title     string          `json:"title"`
+	Model     string          `json:"model"`
+	SharedAt  time.Time       `json:"shared_at"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Messages  []SharedMessage `json:"messages"`
+}
+
+// SnapshotMessages 将当前分支的消息转换为分享快照
+func SnapshotMessages(path []Message) []SharedMessage {
+	snapshot := make([]SharedMessage, len(path))
+	for i, m := range path {
+		snapshot[i] = SharedMessage{Role: m.Role, Content: m.Content, CreatedAt: m.CreatedAt, Status: m.Status}
+	}
+	return snapshot
+}
+
+// View 返回分享的公开内容，不包含所有者和令牌信息
+func (s *ChatShare) View() SharedChat {
+	messages := s.Messages
+	if messages == nil {
+		messages = []SharedMessage{}
+	}
+	return SharedChat{Title: s.Title, Model: s.Model, SharedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt, Messages: messages}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// RefreshToken 刷新令牌记录，ID 为令牌的 SHA-256 哈希，明文令牌不落库
+type RefreshToken struct {
+	ID         string     `json:"-" bson:"_id"`
+	UserEmail  string     `json:"user_email" bson:"user_email"`
+	Username   string     `json:"username" bson:"username"`
+	FamilyID   string     `json:"family_id" bson:"family_id"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	ReplacedBy string     `json:"-" bson:"replaced_by,omitempty"`
+}
+
+// RevokedToken 已撤销的访问令牌，按 jti 撤销单个令牌，或按用户撤销某时间点之前签发的全部令牌
+type RevokedToken struct {
+	ID            string    `bson:"_id"`
+	JTI           string    `bson:"jti,omitempty"`
+	UserEmail     string    `bson:"user_email,omitempty"`
+	RevokedBefore time.Time `bson:"revoked_before,omitempty"`
+	CreatedAt     time.Time `bson:"created_at"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
@@ -1,8 +1,81 @@
 package models
 
+import "time"
+
+// 用户角色
+const (
+	RoleUser     = "user"
+	RoleAdmin    = "admin"
+	RoleReadOnly = "readonly"
+)
+
 type User struct {
-	ID       string `json:"id,omitempty" bson:"_id,omitempty"`
-	Username string `json:"username" bson:"username"`
-	Email    string `json:"email" bson:"email"`
-	Password string `json:"password" bson:"password"`
+	ID        string    `json:"id,omitempty" bson:"_id,omitempty"`
+	Username  string    `json:"username" bson:"username"`
+	Email     string    `json:"email" bson:"email"`
+	Password  string    `json:"password" bson:"password"`
+	Role      string    `json:"role,omitempty" bson:"role,omitempty"`
+	Disabled  bool      `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	// AdminBootstrapped 已按 ADMIN_EMAILS 授予过管理员角色，不再重复授予
+	AdminBootstrapped bool `json:"-" bson:"admin_bootstrapped,omitempty"`
+
+	EmailVerified   bool       `json:"email_verified,omitempty" bson:"email_verified,omitempty"`
+	EmailVerifiedAt *time.Time `json:"-" bson:"email_verified_at,omitempty"`
+
+	// 两步验证 (TOTP)，不通过 JSON 读写
+	TOTPEnabled       bool     `json:"-" bson:"totp_enabled,omitempty"`
+	TOTPSecret        string   `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret string   `json:"-" bson:"totp_pending_secret,omitempty"`
+	TOTPLastStep      int64    `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes     []string `json:"-" bson:"recovery_codes,omitempty"` // 恢复码的哈希
+
+	// 通过单点登录关联的外部身份
+	OIDCIssuer  string `json:"-" bson:"oidc_issuer,omitempty"`
+	OIDCSubject string `json:"-" bson:"oidc_subject,omitempty"`
+}
+
+// UserProfile 对外返回的用户信息，不包含密码
+type UserProfile struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	EmailVerified    bool `json:"email_verified"`
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+}
+
+// EffectiveRole 返回用户角色，旧账户没有角色字段时视为普通用户
+func (u *User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// Profile 返回不含敏感字段的用户信息
+func (u *User) Profile() UserProfile {
+	return UserProfile{
+		ID:        u.ID,
+		Username:  u.Username,
+		Email:     u.Email,
+		Role:      u.EffectiveRole(),
+		Disabled:  u.Disabled,
+		CreatedAt: u.CreatedAt,
+
+		EmailVerified:    u.EmailVerified,
+		TwoFactorEnabled: u.TOTPEnabled,
+	}
+}
+
+// IsValidRole 检查角色名称是否有效
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleAdmin, RoleReadOnly:
+		return true
+	}
+	return false
 }
@@ -2,15 +2,21 @@ package rag
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"backend/internal/auth"
+	"backend/internal/db"
+	"backend/internal/models"
+
 	"github.com/gorilla/mux"
 )
 
@@ -94,6 +100,11 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	// 尝试解析响应并添加文件名
 	var responseData map[string]interface{}
 	if err := json.Unmarshal(respBody, &responseData); err == nil {
+		// 上传成功时记录文档属于哪个用户，用于导出和删除账户数据
+		if resp.StatusCode < 300 {
+			recordDocumentOwner(r, documentIDFromResponse(responseData), handler.Filename, handler.Size)
+		}
+
 		// 如果解析成功，添加文件名
 		responseData["filename"] = handler.Filename
 		// 重新编码响应
@@ -110,6 +121,56 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(respBody)
 }
 
+// documentIDFromResponse 从 RAG 服务的上传响应中取出文档 ID
+func documentIDFromResponse(data map[string]interface{}) string {
+	for _, key := range []string{"doc_id", "document_id", "id"} {
+		if id, ok := data[key].(string); ok && id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// recordDocumentOwner 保存文档和上传用户的对应关系
+func recordDocumentOwner(r *http.Request, docID, filename string, size int64) {
+	userClaims, ok := auth.UserFromContext(r.Context())
+	if !ok || docID == "" {
+		log.Printf("Uploaded document %q has no owner or ID, not recorded", filename)
+		return
+	}
+
+	doc := &models.Document{
+		ID:        docID,
+		UserEmail: userClaims.Email,
+		Filename:  filename,
+		Size:      size,
+	}
+	if err := db.NewDocumentRepository().SaveDocument(r.Context(), doc); err != nil {
+		log.Printf("Error recording document %s for %s: %v", docID, userClaims.Email, err)
+	}
+}
+
+// DeleteDocument 从 RAG 服务删除文档及其向量，文档已不存在时视为成功
+func DeleteDocument(ctx context.Context, docID string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/document/%s", ragServiceURL, docID), nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call RAG service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("RAG service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
 // ListDocumentsHandler 获取文档列表
 func ListDocumentsHandler(w http.ResponseWriter, r *http.Request) {
 	// 创建请求
@@ -258,6 +319,12 @@ func DeleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("删除请求响应状态码: %d\n", resp.StatusCode)
 	fmt.Printf("删除请求响应内容: %s\n", string(respBody))
 
+	if resp.StatusCode < 300 || resp.StatusCode == http.StatusNotFound {
+		if err := db.NewDocumentRepository().DeleteDocument(r.Context(), docID); err != nil {
+			log.Printf("Error deleting document record %s: %v", docID, err)
+		}
+	}
+
 	// 设置响应头
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(resp.StatusCode)
@@ -4,6 +4,7 @@ import (
 	"backend/internal/models"
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -31,19 +32,19 @@ func (s *AnthropicService) GetModelProvider() string {
 }
 
 // CallModel calls the Anthropic model with a single message
-func (s *AnthropicService) CallModel(message string, model string) (string, error) {
+func (s *AnthropicService) CallModel(ctx context.Context, message string, model string, opts CallOptions) (string, error) {
 	s.CurrentModel = model
-	return CallAnthropic(message, model)
+	return CallAnthropic(ctx, message, model, opts)
 }
 
 // CallModelStreamWithHistory calls the Anthropic model with streaming and message history
-func (s *AnthropicService) CallModelStreamWithHistory(w http.ResponseWriter, message string, model string, messages []models.Message) error {
+func (s *AnthropicService) CallModelStreamWithHistory(ctx context.Context, w http.ResponseWriter, message string, model string, messages []models.Message, opts CallOptions) (string, error) {
 	s.CurrentModel = model
-	return CallAnthropicStreamWithHistory(w, message, model, messages)
+	return CallAnthropicStreamWithHistory(ctx, w, message, model, messages, opts)
 }
 
 // CallAnthropic calls the Anthropic API to get a response
-func CallAnthropic(message string, model string) (string, error) {
+func CallAnthropic(ctx context.Context, message string, model string, opts CallOptions) (string, error) {
 	// 检查模型别名，如果存在映射关系则使用映射后的正式模型名称
 	if mappedModel, ok := models.ModelAliases[model]; ok {
 		log.Printf("Mapping model from %s to %s", model, mappedModel)
@@ -149,6 +150,10 @@ func CallAnthropic(message string, model string) (string, error) {
 
 	// Build request with model identity information added to the prompt
 	enhancedMessage := fmt.Sprintf("You are %s, an AI assistant. When asked about your identity or model name, explicitly identify yourself as %s.\n\nUser question: %s", model, model, message)
+	if opts.SystemPrompt != "" {
+		// 有自定义系统提示时通过 system 字段传入，用户消息保持原样
+		enhancedMessage = message
+	}
 
 	anthropicMessages := []map[string]string{
 		{
@@ -162,6 +167,10 @@ func CallAnthropic(message string, model string) (string, error) {
 		"messages":   anthropicMessages,
 		"max_tokens": 2000,
 	}
+	if opts.SystemPrompt != "" {
+		requestBody["system"] = opts.SystemPrompt
+	}
+	applyTemperature(requestBody, opts.Temperature, anthropicMaxTemperature)
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
@@ -175,7 +184,7 @@ func CallAnthropic(message string, model string) (string, error) {
 	// 记录完整请求体用于调试
 	log.Printf("Complete Anthropic API request body: %s", string(jsonData))
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("创建请求错误: %v", err)
 		return "", fmt.Errorf("创建请求错误: %v", err)
@@ -231,8 +240,9 @@ func CallAnthropic(message string, model string) (string, error) {
 	return fullContent, nil
 }
 
-// CallAnthropicStreamWithHistory uses streaming response to call Anthropic API with message history
-func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model string, messages []models.Message) error {
+// CallAnthropicStreamWithHistory uses streaming response to call Anthropic API with message history.
+// It returns the streamed text, or the part received before an error.
+func CallAnthropicStreamWithHistory(ctx context.Context, w http.ResponseWriter, message string, model string, messages []models.Message, opts CallOptions) (string, error) {
 	// 检查模型别名，如果存在映射关系则使用映射后的正式模型名称
 	if mappedModel, ok := models.ModelAliases[model]; ok {
 		log.Printf("Mapping model from %s to %s", model, mappedModel)
@@ -340,7 +350,7 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 
 	// 1. Process system prompt
 	var systemPrompt string
-	var anthropicMessages []map[string]string
+	var anthropicMessages []map[string]interface{}
 
 	// Log all messages for debugging
 	for i, msg := range messages {
@@ -366,11 +376,11 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 			continue
 		}
 
-		// Claude API supports user and assistant roles
+		// Claude API supports user and assistant roles; messages with images use content blocks
 		if msg.Role == "user" || msg.Role == "assistant" {
-			anthropicMessages = append(anthropicMessages, map[string]string{
+			anthropicMessages = append(anthropicMessages, map[string]interface{}{
 				"role":    msg.Role,
-				"content": msg.Content,
+				"content": anthropicContent(msg),
 			})
 		}
 	}
@@ -382,6 +392,8 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 		"max_tokens": 4000,
 	}
 
+	applyTemperature(requestData, opts.Temperature, anthropicMaxTemperature)
+
 	// Add messages
 	if len(anthropicMessages) > 0 {
 		requestData["messages"] = anthropicMessages
@@ -399,17 +411,17 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 	jsonData, err := json.Marshal(requestData)
 	if err != nil {
 		log.Printf("Error marshaling request: %v", err)
-		return err
+		return "", err
 	}
 
 	// Log request for debugging
 	log.Printf("Complete Anthropic API request body: %s", string(jsonData))
 
 	// 5. Create HTTP request
-	req, err := http.NewRequest("POST", baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/v1/messages", bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
-		return err
+		return "", err
 	}
 
 	// 6. Set request headers
@@ -426,11 +438,14 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Error sending request: %v", err)
-		fmt.Fprintf(w, "data: ERROR: Request failed: %v\n\n", err)
-		if f, ok := w.(http.Flusher); ok {
-			f.Flush()
+		// 请求被取消时不再向客户端报告错误
+		if ctx.Err() == nil {
+			fmt.Fprintf(w, "data: ERROR: Request failed: %v\n\n", err)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
 		}
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -443,7 +458,7 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 		if f, ok := w.(http.Flusher); ok {
 			f.Flush()
 		}
-		return errors.New(errorMsg)
+		return "", errors.New(errorMsg)
 	}
 
 	// Log response headers for debugging
@@ -471,11 +486,13 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 				break
 			}
 			log.Printf("Error reading stream: %v", err)
-			fmt.Fprintf(w, "data: ERROR: Failed to read stream: %v\n\n", err)
-			if f, ok := w.(http.Flusher); ok {
-				f.Flush()
+			if ctx.Err() == nil {
+				fmt.Fprintf(w, "data: ERROR: Failed to read stream: %v\n\n", err)
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
 			}
-			return err
+			return contentBuffer, err
 		}
 
 		now := time.Now()
@@ -614,7 +631,7 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 			f.Flush()
 		}
 
-		return errors.New(errorMsg)
+		return "", errors.New(errorMsg)
 	}
 
 	// 不再发送完整的最终响应，避免内容重复
@@ -626,7 +643,7 @@ func CallAnthropicStreamWithHistory(w http.ResponseWriter, message string, model
 		f.Flush()
 	}
 
-	return nil
+	return contentBuffer, nil
 }
 
 // Helper function to find minimum of two integers
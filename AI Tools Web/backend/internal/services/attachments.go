@@ -0,0 +1,54 @@
+package services
+
+import (
+	"encoding/base64"
+
+	"backend/internal/models"
+)
+
+// openAIContent 返回 OpenAI 消息的 content：没有图片时是字符串，
+// 有图片时是 text 和 image_url 内容片段组成的数组
+func openAIContent(msg models.Message) interface{} {
+	images := msg.Images()
+	if len(images) == 0 {
+		return msg.Content
+	}
+
+	parts := make([]map[string]interface{}, 0, len(images)+1)
+	if msg.Content != "" {
+		parts = append(parts, map[string]interface{}{"type": "text", "text": msg.Content})
+	}
+	for _, image := range images {
+		parts = append(parts, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]string{"url": image.DataURL()},
+		})
+	}
+	return parts
+}
+
+// anthropicContent 返回 Anthropic 消息的 content：没有图片时是字符串，
+// 有图片时是 image 块加上 text 块组成的数组（Claude 建议图片放在文字之前）
+func anthropicContent(msg models.Message) interface{} {
+	images := msg.Images()
+	if len(images) == 0 {
+		return msg.Content
+	}
+
+	blocks := make([]map[string]interface{}, 0, len(images)+1)
+	for _, image := range images {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "image",
+			"source": map[string]string{
+				"type":       "base64",
+				"media_type": image.MimeType,
+				"data":       base64.StdEncoding.EncodeToString(image.Data),
+			},
+		})
+	}
+	// Anthropic 不接受空的 text 块
+	if msg.Content != "" {
+		blocks = append(blocks, map[string]interface{}{"type": "text", "text": msg.Content})
+	}
+	return blocks
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 默认的向量模型，可通过 EMBEDDING_MODEL 配置
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// ErrEmbeddingsUnavailable 没有配置 OpenAI API key，语义搜索不可用
+var ErrEmbeddingsUnavailable = errors.New("embeddings are not configured")
+
+// EmbeddingModel 返回生成向量使用的模型，不同模型的向量不能互相比较
+func EmbeddingModel() string {
+	if model := os.Getenv("EMBEDDING_MODEL"); model != "" {
+		return model
+	}
+	return defaultEmbeddingModel
+}
+
+// EmbeddingsAvailable 检查是否可以生成向量
+func EmbeddingsAvailable() bool {
+	return os.Getenv("OPENAI_API_KEY") != ""
+}
+
+// openAIEmbeddingsURL 构建向量接口的 URL，避免 /v1 路径重复
+func openAIEmbeddingsURL() string {
+	baseURL := strings.TrimSuffix(os.Getenv("OPENAI_BASE_URL"), "/")
+	switch {
+	case baseURL == "":
+		return "https://api.openai.com/v1/embeddings"
+	case strings.HasSuffix(baseURL, "/v1"):
+		return baseURL + "/embeddings"
+	default:
+		return baseURL + "/v1/embeddings"
+	}
+}
+
+// CreateEmbeddings 使用 OpenAI 向量接口为每段文本生成向量，返回的顺序与输入相同
+func CreateEmbeddings(ctx context.Context, inputs []string) ([][]float32, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, ErrEmbeddingsUnavailable
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model": EmbeddingModel(),
+		"input": inputs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", openAIEmbeddingsURL(), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("OpenAI embeddings API error: %s", string(body))
+		return nil, fmt.Errorf("OpenAI embeddings API error: %s", resp.Status)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error parsing response: %v", err)
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(inputs) {
+			return nil, fmt.Errorf("unexpected embedding index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
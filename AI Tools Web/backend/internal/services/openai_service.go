@@ -4,6 +4,7 @@ import (
 	"backend/internal/models"
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -59,18 +60,18 @@ func (s *OpenAIService) GetModelProvider() string {
 }
 
 // CallModel calls the OpenAI model with a single message
-func (s *OpenAIService) CallModel(message string, model string) (string, error) {
+func (s *OpenAIService) CallModel(ctx context.Context, message string, model string, opts CallOptions) (string, error) {
 	s.CurrentModel = model
-	return CallOpenAI(message, model)
+	return CallOpenAI(ctx, message, model, opts)
 }
 
 // CallModelStreamWithHistory calls the OpenAI model with streaming and message history
-func (s *OpenAIService) CallModelStreamWithHistory(w http.ResponseWriter, message string, model string, messages []models.Message) error {
+func (s *OpenAIService) CallModelStreamWithHistory(ctx context.Context, w http.ResponseWriter, message string, model string, messages []models.Message, opts CallOptions) (string, error) {
 	s.CurrentModel = model
-	return CallOpenAIStreamWithHistory(w, message, model, messages)
+	return CallOpenAIStreamWithHistory(ctx, w, message, model, messages, opts)
 }
 
-func CallOpenAI(message string, model string) (string, error) {
+func CallOpenAI(ctx context.Context, message string, model string, opts CallOptions) (string, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
 
@@ -81,6 +82,9 @@ func CallOpenAI(message string, model string) (string, error) {
 
 	// 系统提示，包含模型身份
 	systemPrompt := fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s. Please use Markdown format in your responses to make them structured and readable.", model, model)
+	if opts.SystemPrompt != "" {
+		systemPrompt = opts.SystemPrompt
+	}
 
 	requestBody := map[string]interface{}{
 		"model": model,
@@ -97,6 +101,7 @@ func CallOpenAI(message string, model string) (string, error) {
 		"temperature": 0.7,
 		"max_tokens":  2000,
 	}
+	applyTemperature(requestBody, opts.Temperature, openAIMaxTemperature)
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
@@ -120,7 +125,7 @@ func CallOpenAI(message string, model string) (string, error) {
 
 	log.Printf("Making request to OpenAI API: %s", url)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
 		return "", fmt.Errorf("error creating request: %v", err)
@@ -167,7 +172,7 @@ func CallOpenAI(message string, model string) (string, error) {
 }
 
 // CallOpenAIStream 使用流式响应调用OpenAI API
-func CallOpenAIStream(w http.ResponseWriter, message string, model string) error {
+func CallOpenAIStream(ctx context.Context, w http.ResponseWriter, message string, model string) error {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
 
@@ -212,7 +217,7 @@ func CallOpenAIStream(w http.ResponseWriter, message string, model string) error
 
 	log.Printf("Making streaming request to OpenAI API: %s", url)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
 		return fmt.Errorf("error creating request: %v", err)
@@ -336,13 +341,14 @@ func CallOpenAIStream(w http.ResponseWriter, message string, model string) error
 }
 
 // 添加新的函数，支持传递消息历史
-func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model string, messages []models.Message) error {
+// 返回已发送给客户端的完整回复，出错时返回出错前收到的部分
+func CallOpenAIStreamWithHistory(ctx context.Context, w http.ResponseWriter, message string, model string, messages []models.Message, opts CallOptions) (string, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
 
 	if apiKey == "" {
 		log.Println("OpenAI API key not found")
-		return errors.New("OpenAI API key not found")
+		return "", errors.New("OpenAI API key not found")
 	}
 
 	// 记录完整的消息历史以便调试
@@ -356,7 +362,7 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 	}
 
 	// 转换消息格式
-	openaiMessages := make([]map[string]string, 0, len(messages))
+	openaiMessages := make([]map[string]interface{}, 0, len(messages))
 
 	// 如果没有系统提示，添加一个默认的系统提示
 	hasSystemPrompt := false
@@ -371,17 +377,17 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 		// 添加默认的系统提示
 		log.Printf("No system prompt found, adding default one with model identity: %s", model)
 		systemPrompt := fmt.Sprintf("You are %s, a helpful assistant. When asked about your identity or model name, explicitly identify yourself as %s.", model, model)
-		openaiMessages = append(openaiMessages, map[string]string{
+		openaiMessages = append(openaiMessages, map[string]interface{}{
 			"role":    "system",
 			"content": systemPrompt,
 		})
 	}
 
-	// 添加所有消息到请求中
+	// 添加所有消息到请求中，带图片的消息使用多模态格式
 	for _, msg := range messages {
-		openaiMessages = append(openaiMessages, map[string]string{
+		openaiMessages = append(openaiMessages, map[string]interface{}{
 			"role":    msg.Role,
-			"content": msg.Content,
+			"content": openAIContent(msg),
 		})
 	}
 
@@ -390,12 +396,13 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 		"messages": openaiMessages,
 		"stream":   true,
 	}
+	applyTemperature(requestBody, opts.Temperature, openAIMaxTemperature)
 
 	// 序列化请求体
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		log.Printf("Error marshaling request: %v", err)
-		return err
+		return "", err
 	}
 
 	// 记录请求正文用于调试
@@ -417,10 +424,10 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 		}
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		log.Printf("Error creating request: %v", err)
-		return err
+		return "", err
 	}
 
 	// 设置请求头
@@ -435,7 +442,7 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Error sending request: %v", err)
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -443,7 +450,7 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		log.Printf("OpenAI API error: %s, status code: %d", string(body), resp.StatusCode)
-		return fmt.Errorf("OpenAI API error: %s", string(body))
+		return "", fmt.Errorf("OpenAI API error: %s", string(body))
 	}
 
 	// 读取响应流
@@ -457,7 +464,7 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 				break
 			}
 			log.Printf("Error reading stream: %v", err)
-			return err
+			return fullContent, err
 		}
 
 		line = strings.TrimSpace(line)
@@ -517,5 +524,5 @@ func CallOpenAIStreamWithHistory(w http.ResponseWriter, message string, model st
 	}
 
 	log.Printf("Successfully streamed response from OpenAI API, total length: %d characters", len(fullContent))
-	return nil
+	return fullContent, nil
 }
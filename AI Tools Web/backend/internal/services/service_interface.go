@@ -2,9 +2,38 @@ package services
 
 import (
 	"backend/internal/models"
+	"context"
 	"net/http"
 )
 
+// CallOptions 调用模型时的可选参数，零值表示使用服务默认设置
+type CallOptions struct {
+	// SystemPrompt 替换 CallModel 的默认系统提示；流式调用的系统提示通过消息历史传入
+	SystemPrompt string
+	// Temperature 为空时使用模型默认值
+	Temperature *float64
+}
+
+// 各服务商接受的 temperature 上限
+const (
+	openAIMaxTemperature    = 2.0
+	anthropicMaxTemperature = 1.0
+)
+
+// applyTemperature 设置请求的 temperature，超出服务商范围时截断
+func applyTemperature(body map[string]interface{}, temperature *float64, max float64) {
+	if temperature == nil {
+		return
+	}
+	t := *temperature
+	if t < 0 {
+		t = 0
+	} else if t > max {
+		t = max
+	}
+	body["temperature"] = t
+}
+
 // LLMService defines the interface for language model services
 type LLMService interface {
 	// GetModelName returns the name of the model
@@ -14,10 +43,11 @@ type LLMService interface {
 	GetModelProvider() string
 
 	// CallModel calls the model with a single message and returns the response
-	CallModel(message string, model string) (string, error)
+	CallModel(ctx context.Context, message string, model string, opts CallOptions) (string, error)
 
-	// CallModelStreamWithHistory calls the model with a stream response and message history
-	CallModelStreamWithHistory(w http.ResponseWriter, message string, model string, messages []models.Message) error
+	// CallModelStreamWithHistory calls the model with a stream response and message history.
+	// It returns the text streamed to the client, which is partial when an error is returned.
+	CallModelStreamWithHistory(ctx context.Context, w http.ResponseWriter, message string, model string, messages []models.Message, opts CallOptions) (string, error)
 }
 
 // GetModelProvider returns the provider of the model
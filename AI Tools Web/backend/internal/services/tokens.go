@@ -0,0 +1,123 @@
+package services
+
+import (
+	"log"
+	"math"
+	"sync"
+	"unicode"
+
+	"backend/internal/models"
+
+	tiktoken "github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// 每条消息在角色和分隔符上额外消耗的 token，以及回复开头的固定开销（与 OpenAI 的计算方式一致）
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// imageTokens 每张图片按较大的尺寸估算的 token 数（Claude 约 1600，OpenAI 高清模式约 1100）
+const imageTokens = 1600
+
+var (
+	// 编码表随程序打包，不需要在运行时下载
+	loaderOnce sync.Once
+	encodings  sync.Map // model -> *tiktoken.Tiktoken
+)
+
+// encodingForModel 返回 OpenAI 模型的编码器，未知模型使用 cl100k_base
+func encodingForModel(model string) *tiktoken.Tiktoken {
+	if enc, ok := encodings.Load(model); ok {
+		return enc.(*tiktoken.Tiktoken)
+	}
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		if enc, err = tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE); err != nil {
+			log.Printf("Error loading tokenizer for %s: %v", model, err)
+			return nil
+		}
+	}
+	encodings.Store(model, enc)
+	return enc
+}
+
+// CountTokens 计算文本的 token 数。OpenAI 模型使用与 tiktoken 相同的编码，
+// Claude 没有公开的分词器，使用 estimateTokens 估算。
+func CountTokens(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	if GetModelProvider(model) == models.ProviderAnthropic {
+		return estimateTokens(text)
+	}
+	enc := encodingForModel(model)
+	if enc == nil {
+		return estimateTokens(text)
+	}
+	// 用户输入中可能出现 <|endoftext|> 之类的文本，按普通文本编码
+	return len(enc.EncodeOrdinary(text))
+}
+
+// CountMessageTokens 计算发送一组消息（包括系统提示）需要的 token 数
+func CountMessageTokens(model string, messages []models.Message) int {
+	total := tokensPerReply
+	for _, m := range messages {
+		total += messageTokens(model, m)
+	}
+	return total
+}
+
+// messageTokens 一条消息的 token 数，包括角色开销和图片
+func messageTokens(model string, m models.Message) int {
+	tokens := tokensPerMessage + CountTokens(model, m.Content)
+	for _, a := range m.Attachments {
+		if a.Kind == models.AttachmentKindImage {
+			tokens += imageTokens
+		}
+	}
+	return tokens
+}
+
+// FitHistory 返回 history 中需要保留的第一条消息的下标，使保留的消息不超过 budget 个 token。
+// 保留的部分从一条用户消息开始（Claude 要求第一条消息来自用户），最后一条消息总是保留。
+func FitHistory(model string, history []models.Message, budget int) int {
+	if len(history) == 0 {
+		return 0
+	}
+
+	used := tokensPerReply
+	start := len(history)
+	for start > 0 {
+		cost := messageTokens(model, history[start-1])
+		if used+cost > budget && start < len(history) {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	for start < len(history)-1 && history[start].Role != "user" {
+		start++
+	}
+	return start
+}
+
+// estimateTokens 估算 Claude 的 token 数：中日韩文字大约每个字一个 token，
+// 其他文字大约每 3.5 个字符一个 token。估算偏高一些，避免超出上下文。
+func estimateTokens(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(float64(cjk) + float64(other)/3.5))
+}
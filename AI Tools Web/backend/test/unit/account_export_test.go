@@ -0,0 +1,82 @@
+package auth_test
+
+import (
+	"archive/zip"
+	"backend/internal/account"
+	"backend/internal/models"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive 解压导出文件，返回文件名到内容的映射
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = content
+	}
+	return files
+}
+
+func TestWriteArchive(t *testing.T) {
+	user := &models.User{ID: "u1", Username: "alice", Email: "alice@example.com", Password: "secret-hash"}
+	export := &account.Export{
+		Profile:   user.Profile(),
+		APIKeys:   []models.APIKey{{ID: "k1", Name: "script", Prefix: "zat_abcd", KeyHash: "hash", Scopes: []string{"chat:read"}}},
+		Documents: []models.Document{{ID: "d1", Filename: "notes.pdf", Size: 42, UploadedAt: time.Now()}},
+		Chats: []models.ChatResponse{{
+			Chat:     models.Chat{ID: "c1", UserID: user.Email, Title: "Hello", Model: "gpt-4o"},
+			Messages: []models.Message{{ID: "m1", ChatID: "c1", Role: "user", Content: "hi"}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, account.WriteArchive(&buf, export))
+	files := readArchive(t, buf.Bytes())
+
+	assert.Contains(t, files, "profile.json")
+	assert.Contains(t, files, "api_keys.json")
+	assert.Contains(t, files, "documents.json")
+	assert.Contains(t, files, "chats/c1.json")
+	assert.NotContains(t, files, "preferences.json", "preferences are only exported when set")
+
+	// 不能泄露密码哈希和 API 密钥哈希
+	assert.NotContains(t, string(files["profile.json"]), "secret-hash")
+	assert.NotContains(t, string(files["api_keys.json"]), `"hash"`)
+
+	var chat models.ChatResponse
+	require.NoError(t, json.Unmarshal(files["chats/c1.json"], &chat))
+	assert.Equal(t, "Hello", chat.Chat.Title)
+	require.Len(t, chat.Messages, 1)
+	assert.Equal(t, "hi", chat.Messages[0].Content)
+}
+
+func TestWriteArchiveEmptyAccount(t *testing.T) {
+	user := &models.User{ID: "u2", Username: "bob", Email: "bob@example.com"}
+	temperature := 0.5
+	export := &account.Export{
+		Profile:     user.Profile(),
+		Preferences: &models.UserPreferences{UserEmail: user.Email, Temperature: &temperature},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, account.WriteArchive(&buf, export))
+	files := readArchive(t, buf.Bytes())
+
+	assert.Contains(t, files, "preferences.json")
+	assert.JSONEq(t, "[]", string(files["api_keys.json"]))
+	assert.JSONEq(t, "[]", string(files["documents.json"]))
+}
@@ -0,0 +1,83 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	token, hash, err := auth.NewAPIKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, auth.APIKeyPrefix))
+	assert.True(t, auth.IsAPIKey(token))
+	assert.NotContains(t, hash, token)
+
+	other, _, err := auth.NewAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	jwtToken, err := auth.GenerateToken("testuser", "test@example.com")
+	require.NoError(t, err)
+	assert.False(t, auth.IsAPIKey(jwtToken))
+}
+
+func TestValidateAPIKeyScopes(t *testing.T) {
+	scopes, err := auth.ValidateAPIKeyScopes([]string{auth.PermChatRead, auth.PermRAGQuery, auth.PermChatRead})
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.PermChatRead, auth.PermRAGQuery}, scopes)
+
+	_, err = auth.ValidateAPIKeyScopes(nil)
+	assert.Error(t, err)
+
+	// 账户管理和管理员权限不能授予访问令牌
+	for _, scope := range []string{auth.PermAccount, auth.PermManageUsers, auth.PermRAGAdmin, "unknown"} {
+		_, err = auth.ValidateAPIKeyScopes([]string{scope})
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestAPIKeyScopedPermissions(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		role       string
+		scopes     []string
+		permission string
+		wantStatus int
+	}{
+		{"Scope granted", models.RoleUser, []string{auth.PermChatRead}, auth.PermChatRead, http.StatusOK},
+		{"Scope not granted", models.RoleUser, []string{auth.PermChatRead}, auth.PermChatWrite, http.StatusForbidden},
+		{"Key cannot manage account", models.RoleUser, []string{auth.PermChatRead, auth.PermChatWrite}, auth.PermAccount, http.StatusForbidden},
+		{"Key of admin cannot use admin permissions", models.RoleAdmin, []string{auth.PermChatWrite}, auth.PermManageUsers, http.StatusForbidden},
+		{"Scope beyond role is denied", models.RoleReadOnly, []string{auth.PermChatWrite}, auth.PermChatWrite, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/test", nil)
+			claims := auth.UserClaims{
+				Username: "testuser",
+				Email:    "test@example.com",
+				Role:     tt.role,
+				APIKeyID: "key-1",
+				Scopes:   tt.scopes,
+			}
+			req = req.WithContext(context.WithValue(req.Context(), "user", claims))
+
+			rr := httptest.NewRecorder()
+			auth.RequirePermission(tt.permission)(okHandler).ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
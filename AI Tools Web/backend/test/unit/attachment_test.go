@@ -0,0 +1,74 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 最小的 PNG 文件头
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDetectAttachmentType(t *testing.T) {
+	mimeType, kind, ok := models.DetectAttachmentType("diagram.jpg", pngHeader)
+	assert.True(t, ok)
+	assert.Equal(t, "image/png", mimeType, "type comes from the content, not the file name")
+	assert.Equal(t, models.AttachmentKindImage, kind)
+
+	mimeType, kind, ok = models.DetectAttachmentType("style.css", []byte("body { color: #333; }\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "text/css", mimeType)
+	assert.Equal(t, models.AttachmentKindText, kind)
+
+	mimeType, kind, ok = models.DetectAttachmentType("Makefile", []byte("# 作业\nbuild:\n\tgo build\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "text/plain", mimeType)
+	assert.Equal(t, models.AttachmentKindText, kind)
+
+	_, _, ok = models.DetectAttachmentType("report.pdf", []byte("%PDF-1.7\n"))
+	assert.False(t, ok)
+
+	_, _, ok = models.DetectAttachmentType("data.txt", []byte("abc\xff\xfe"))
+	assert.False(t, ok, "text must be valid UTF-8")
+}
+
+func TestSupportsVision(t *testing.T) {
+	assert.True(t, models.SupportsVision(models.ModelGPT4o))
+	assert.True(t, models.SupportsVision("claude-3-5-sonnet-20241022"))
+	assert.False(t, models.SupportsVision(models.ModelGPT35Turbo))
+	assert.False(t, models.SupportsVision(models.ModelGPT4))
+}
+
+func TestWithTextAttachments(t *testing.T) {
+	attachments := []models.Attachment{
+		{ID: "a1", Filename: "main.go", Kind: models.AttachmentKindText, Data: []byte("package main\n")},
+		{ID: "a2", Filename: "photo.png", Kind: models.AttachmentKindImage, Data: pngHeader},
+	}
+	assert.Equal(t, "Why does this fail?\n\n<file name=\"main.go\">\npackage main\n</file>",
+		models.WithTextAttachments("Why does this fail?", attachments))
+	assert.Equal(t, "<file name=\"main.go\">\npackage main\n</file>", models.WithTextAttachments("", attachments))
+}
+
+func TestMessageImages(t *testing.T) {
+	m := models.Message{Role: "user", Content: "What is in this picture?", Attachments: []models.Attachment{
+		{ID: "a1", MimeType: "image/png", Kind: models.AttachmentKindImage},
+		{ID: "a2", Filename: "notes.txt", Kind: models.AttachmentKindText, Data: []byte("notes")},
+	}}
+	assert.True(t, models.HasImages([]models.Message{m}))
+	assert.Empty(t, m.Images(), "images without loaded data are not sent")
+
+	m.Attachments[0].Data = []byte("abc")
+	require.Len(t, m.Images(), 1)
+	assert.Equal(t, "data:image/png;base64,YWJj", m.Images()[0].DataURL())
+
+	assert.False(t, models.HasImages([]models.Message{{Role: "user", Content: "hi"}}))
+}
+
+func TestAttachmentDataNotSerialized(t *testing.T) {
+	data, err := json.Marshal(models.Attachment{ID: "a1", Filename: "a.png", Kind: models.AttachmentKindImage, Data: pngHeader})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "data")
+}
@@ -0,0 +1,140 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportFixture 一个有两个分支的聊天：m2 被重新生成为 m3，当前分支是 m1 -> m3
+func exportFixture() *models.ChatExport {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	chat := models.Chat{ID: "c1", UserID: "alice@example.com", Title: "Go <basics>", Model: "gpt-4o", CreatedAt: created, ActiveLeafID: "m3"}
+	messages := []models.Message{
+		{ID: "m1", ChatID: "c1", Role: "user", Content: "How do I print?", CreatedAt: created},
+		{ID: "m2", ChatID: "c1", Role: "assistant", Content: "old answer", ParentID: "m1", CreatedAt: created.Add(time.Minute)},
+		{ID: "m3", ChatID: "c1", Role: "assistant", Content: "Use `fmt`:\n\n```go\nfmt.Println(\"<hi>\")\n```", ParentID: "m1", CreatedAt: created.Add(2 * time.Minute)},
+	}
+	return models.NewChatExport(chat, messages, created.Add(time.Hour))
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	md := models.RenderMarkdown(exportFixture())
+
+	assert.Contains(t, md, "# Go <basics>")
+	assert.Contains(t, md, "- Model: gpt-4o")
+	assert.Contains(t, md, "**User** · 2024-03-01 09:30 UTC")
+	// 代码块原样保留，只导出当前分支
+	assert.Contains(t, md, "```go\nfmt.Println(\"<hi>\")\n```")
+	assert.NotContains(t, md, "old answer")
+}
+
+func TestRenderMarkdownClosesUnfinishedCodeBlock(t *testing.T) {
+	e := exportFixture()
+	e.Messages[2].Content = "```go\nfmt.Println("
+	e.Messages[2].Status = models.MessageStatusIncomplete
+
+	md := models.RenderMarkdown(e)
+	assert.True(t, strings.HasSuffix(md, "fmt.Println(\n```\n"))
+	assert.Contains(t, md, "*incomplete*")
+}
+
+func TestRenderHTML(t *testing.T) {
+	page := models.RenderHTML(exportFixture())
+
+	assert.Contains(t, page, "<title>Go &lt;basics&gt;</title>")
+	assert.Contains(t, page, `<pre><code class="language-go">fmt.Println(&#34;&lt;hi&gt;&#34;)</code></pre>`)
+	assert.Contains(t, page, "Use <code>fmt</code>:")
+	assert.NotContains(t, page, "old answer")
+}
+
+func TestNewChatExportOmitsOwner(t *testing.T) {
+	data, err := models.RenderChatExport(exportFixture(), models.ExportFormatJSON)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "alice@example.com")
+	// JSON 包含所有分支
+	assert.Contains(t, string(data), "old answer")
+}
+
+func TestExportFileName(t *testing.T) {
+	assert.Equal(t, "Go-basics-c1.md", models.ExportFileName(models.Chat{ID: "c1", Title: "Go <basics>"}, "md"))
+	assert.Equal(t, "学习-Go-c2.html", models.ExportFileName(models.Chat{ID: "c2", Title: "学习 Go!"}, "html"))
+	assert.Equal(t, "chat-c3.json", models.ExportFileName(models.Chat{ID: "c3", Title: "???"}, "json"))
+}
+
+// sequentialIDs 依次生成 n1, n2, ...
+func sequentialIDs() func() string {
+	n := 0
+	return func() string {
+		n++
+		return fmt.Sprintf("n%d", n)
+	}
+}
+
+func TestPrepareImportRoundTrip(t *testing.T) {
+	data, err := models.RenderChatExport(exportFixture(), models.ExportFormatJSON)
+	require.NoError(t, err)
+	var e models.ChatExport
+	require.NoError(t, json.Unmarshal(data, &e))
+
+	messages, leaf, err := models.PrepareImport(&e, sequentialIDs(), time.Now())
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+
+	// 分支结构按新 ID 重建，当前分支保持不变
+	assert.Equal(t, "n3", leaf)
+	assert.Equal(t, "", messages[0].ParentID)
+	assert.Equal(t, "n1", messages[1].ParentID)
+	assert.Equal(t, "n1", messages[2].ParentID)
+	assert.Equal(t, e.Messages[2].CreatedAt, messages[2].CreatedAt)
+}
+
+func TestPrepareImportLinksMessagesWithoutParents(t *testing.T) {
+	e := &models.ChatExport{Messages: []models.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "bye"},
+	}}
+	now := time.Now()
+
+	messages, leaf, err := models.PrepareImport(e, sequentialIDs(), now)
+	require.NoError(t, err)
+	assert.Equal(t, "n3", leaf)
+	assert.Equal(t, "n2", messages[2].ParentID)
+	assert.True(t, messages[1].CreatedAt.After(messages[0].CreatedAt))
+}
+
+func TestPrepareImportRejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		export models.ChatExport
+	}{
+		{"no messages", models.ChatExport{}},
+		{"newer version", models.ChatExport{Version: models.ChatExportVersion + 1, Messages: []models.Message{{Role: "user", Content: "hi"}}}},
+		{"invalid role", models.ChatExport{Messages: []models.Message{{Role: "system", Content: "hi"}}}},
+		{"empty message", models.ChatExport{Messages: []models.Message{{Role: "user", Content: "  "}}}},
+		{"unknown parent", models.ChatExport{Messages: []models.Message{{ID: "a", Role: "user", Content: "hi", ParentID: "x"}}}},
+		{"parent after child", models.ChatExport{Messages: []models.Message{
+			{ID: "a", Role: "assistant", Content: "hello", ParentID: "b"},
+			{ID: "b", Role: "user", Content: "hi"},
+		}}},
+		{"duplicate id", models.ChatExport{Messages: []models.Message{
+			{ID: "a", Role: "user", Content: "hi"},
+			{ID: "a", Role: "assistant", Content: "hello"},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := models.PrepareImport(&tt.export, sequentialIDs(), time.Now())
+			assert.True(t, errors.Is(err, models.ErrInvalidImport), "got %v", err)
+		})
+	}
+}
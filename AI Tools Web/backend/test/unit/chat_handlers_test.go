@@ -21,46 +21,46 @@ type MockChatRepository struct {
 	mock.Mock
 }
 
-func (m *MockChatRepository) CreateChat(ctx context.Context, chat *models.Chat) error {
-	args := m.Called(ctx, chat)
+func (m *MockChatRepository) CreateChat(ctx context.Context, userID string, chat *models.Chat) error {
+	args := m.Called(ctx, userID, chat)
 	return args.Error(0)
 }
 
-func (m *MockChatRepository) GetChatHistory(ctx context.Context) ([]models.Chat, error) {
-	args := m.Called(ctx)
+func (m *MockChatRepository) GetChatHistory(ctx context.Context, userID string) ([]models.Chat, error) {
+	args := m.Called(ctx, userID)
 	return args.Get(0).([]models.Chat), args.Error(1)
 }
 
-func (m *MockChatRepository) GetMessages(ctx context.Context, chatID string) ([]models.Message, error) {
-	args := m.Called(ctx, chatID)
+func (m *MockChatRepository) GetMessages(ctx context.Context, userID string, chatID string) ([]models.Message, error) {
+	args := m.Called(ctx, userID, chatID)
 	return args.Get(0).([]models.Message), args.Error(1)
 }
 
-func (m *MockChatRepository) SaveMessage(ctx context.Context, message *models.Message) error {
-	args := m.Called(ctx, message)
+func (m *MockChatRepository) SaveMessage(ctx context.Context, userID string, message *models.Message) error {
+	args := m.Called(ctx, userID, message)
 	return args.Error(0)
 }
 
-func (m *MockChatRepository) UpdateChatTitle(ctx context.Context, chatID string, title string) error {
-	args := m.Called(ctx, chatID, title)
+func (m *MockChatRepository) UpdateChatTitle(ctx context.Context, userID string, chatID string, title string, source string) error {
+	args := m.Called(ctx, userID, chatID, title, source)
 	return args.Error(0)
 }
 
-func (m *MockChatRepository) DeleteChat(ctx context.Context, chatID string) error {
-	args := m.Called(ctx, chatID)
+func (m *MockChatRepository) DeleteChat(ctx context.Context, userID string, chatID string) error {
+	args := m.Called(ctx, userID, chatID)
 	return args.Error(0)
 }
 
-func (m *MockChatRepository) GetChat(ctx context.Context, chatID string) (*models.Chat, error) {
-	args := m.Called(ctx, chatID)
+func (m *MockChatRepository) GetChat(ctx context.Context, userID string, chatID string) (*models.Chat, error) {
+	args := m.Called(ctx, userID, chatID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Chat), args.Error(1)
 }
 
-func (m *MockChatRepository) UpdateChatModel(ctx context.Context, chatID string, model string) error {
-	args := m.Called(ctx, chatID, model)
+func (m *MockChatRepository) UpdateChatModel(ctx context.Context, userID string, chatID string, model string) error {
+	args := m.Called(ctx, userID, chatID, model)
 	return args.Error(0)
 }
 
@@ -349,3 +349,29 @@ func TestGetAvailableModelsHandler(t *testing.T) {
 		assert.NotEmpty(t, resp)
 	}
 }
+
+// 测试未认证请求被拒绝，不会访问其他用户的数据
+func TestChatHandlersRequireUser(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"history":  chat.GetChatHistoryHandler,
+		"messages": chat.GetChatMessagesHandler,
+		"info":     chat.GetChatInfoHandler,
+		"delete":   chat.DeleteChatHandler,
+		"title":    chat.UpdateChatTitleHandler,
+		"model":    chat.UpdateChatModelHandler,
+		"send":     chat.SendMessageHandler,
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/chat/123", nil)
+			assert.NoError(t, err)
+			req = mux.SetURLVars(req, map[string]string{"id": "123"})
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		})
+	}
+}
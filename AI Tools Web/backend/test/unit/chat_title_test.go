@@ -0,0 +1,38 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanChatTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"plain title", "Go concurrency basics", "Go concurrency basics"},
+		{"quotes and trailing period", "\"Sorting a slice in Go.\"", "Sorting a slice in Go"},
+		{"title prefix", "Title: Deploying with Docker", "Deploying with Docker"},
+		{"chinese title", "“学习 Go 语言”。", "学习 Go 语言"},
+		{"chinese prefix", "标题：周末旅行计划", "周末旅行计划"},
+		{"only first line", "Database indexing\nThis conversation covers...", "Database indexing"},
+		{"collapses whitespace", "  Markdown   tables  ", "Markdown tables"},
+		{"markdown emphasis", "**Regex help**", "Regex help"},
+		{"empty", "  \"\"  ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, models.CleanChatTitle(tt.raw))
+		})
+	}
+}
+
+func TestCleanChatTitleTruncates(t *testing.T) {
+	title := models.CleanChatTitle(strings.Repeat("标题", models.MaxChatTitleLength))
+	assert.Equal(t, models.MaxChatTitleLength, len([]rune(title)))
+}
@@ -138,3 +138,30 @@ func TestValidateToken(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateTokenClaims(t *testing.T) {
+	os.Setenv("JWT_ACCESS_TTL", "5m")
+	defer os.Unsetenv("JWT_ACCESS_TTL")
+
+	first, err := auth.GenerateToken("testuser", "test@example.com")
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	second, _ := auth.GenerateToken("testuser", "test@example.com")
+
+	claims, err := auth.ValidateToken(first)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.Id == "" {
+		t.Error("access token should carry a jti")
+	}
+	if ttl := time.Until(time.Unix(claims.ExpiresAt, 0)); ttl > 5*time.Minute || ttl < 4*time.Minute {
+		t.Errorf("access token TTL = %v, want about 5m", ttl)
+	}
+
+	other, _ := auth.ValidateToken(second)
+	if claims.Id == other.Id {
+		t.Error("each access token should get a unique jti")
+	}
+}
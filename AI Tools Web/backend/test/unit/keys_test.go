@@ -0,0 +1,147 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pemEncode 将密钥编码为 PKCS#8 / PKIX PEM
+func pemEncode(t *testing.T, key interface{}, private bool) []byte {
+	if private {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"email": "test@example.com", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestKeySetEdDSA(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ks, err := auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgEdDSA, PrivateKey: pemEncode(t, private, true), KeyID: "ed-1"})
+	require.NoError(t, err)
+
+	signed, err := ks.Sign(testClaims())
+	require.NoError(t, err)
+
+	token, err := ks.Parse(signed)
+	require.NoError(t, err)
+	assert.True(t, token.Valid)
+	assert.Equal(t, "ed-1", token.Header["kid"])
+	assert.Equal(t, "EdDSA", token.Header["alg"])
+
+	// 其他服务只拿到 JWKS 中的公钥也能验证
+	data, err := json.Marshal(ks.JWKS())
+	require.NoError(t, err)
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(data, &jwks))
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "OKP", jwks.Keys[0]["kty"])
+	assert.Equal(t, "Ed25519", jwks.Keys[0]["crv"])
+	assert.Equal(t, "ed-1", jwks.Keys[0]["kid"])
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(public), jwks.Keys[0]["x"])
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	oldSet, err := auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgRS256, PrivateKey: pemEncode(t, oldKey, true)})
+	require.NoError(t, err)
+	oldToken, err := oldSet.Sign(testClaims())
+	require.NoError(t, err)
+
+	// 切换到新密钥，旧公钥作为验证密钥保留，kid 默认使用公钥指纹
+	newSet, err := auth.NewKeySet(auth.KeyConfig{
+		Algorithm:        auth.AlgRS256,
+		PrivateKey:       pemEncode(t, newKey, true),
+		VerificationKeys: []auth.PublicKeyPEM{{PEM: pemEncode(t, &oldKey.PublicKey, false)}},
+	})
+	require.NoError(t, err)
+
+	_, err = newSet.Parse(oldToken)
+	assert.NoError(t, err, "tokens signed before rotation must stay valid")
+
+	newToken, err := newSet.Sign(testClaims())
+	require.NoError(t, err)
+	_, err = newSet.Parse(newToken)
+	assert.NoError(t, err)
+
+	// 没有新公钥的服务无法验证新令牌
+	_, err = oldSet.Parse(newToken)
+	assert.Error(t, err)
+
+	jwks := newSet.JWKS()["keys"]
+	require.Len(t, jwks, 2)
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicPEM := pemEncode(t, &key.PublicKey, false)
+
+	ks, err := auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgRS256, PrivateKey: pemEncode(t, key, true)})
+	require.NoError(t, err)
+
+	// 用公开的公钥作为 HMAC 密钥伪造的令牌必须被拒绝
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString(publicPEM)
+	require.NoError(t, err)
+	_, err = ks.Parse(forged)
+	assert.Error(t, err)
+
+	// 未知 kid
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+	unknown.Header["kid"] = "unknown"
+	signed, err := unknown.SignedString(other)
+	require.NoError(t, err)
+	_, err = ks.Parse(signed)
+	assert.Error(t, err)
+}
+
+func TestKeySetConfigValidation(t *testing.T) {
+	_, err := auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgHS256})
+	assert.Error(t, err, "HS256 without a secret")
+
+	_, err = auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgHS256, Secret: "your_secret_key"})
+	assert.Error(t, err, "default secret")
+
+	_, err = auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgRS256})
+	assert.Error(t, err, "RS256 without a private key")
+
+	_, err = auth.NewKeySet(auth.KeyConfig{Algorithm: "none", Secret: "a-real-secret"})
+	assert.Error(t, err, "unsupported algorithm")
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgRS256, PrivateKey: pemEncode(t, weak, true)})
+	assert.Error(t, err, "RSA key shorter than 2048 bits")
+
+	ks, err := auth.NewKeySet(auth.KeyConfig{Algorithm: auth.AlgHS256, Secret: "a-real-secret"})
+	require.NoError(t, err)
+	assert.Empty(t, ks.JWKS()["keys"], "HS256 secrets are never published")
+}
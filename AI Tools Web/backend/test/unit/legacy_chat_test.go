@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"backend/internal/db"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// 引入分支之前的聊天：消息没有 parent_id，聊天没有 active_leaf_id。
+// 编辑其中的消息前必须先把消息连成路径，否则编辑后的消息会成为新的根消息，之前的对话全部丢失。
+func TestGetMessageLinksLegacyChat(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("legacy chat", func(mt *mtest.T) {
+		previous := db.DB
+		db.DB = mt.Client.Database("test")
+		mt.Cleanup(func() { db.DB = previous })
+
+		base := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+		legacy := func(id, role string, minute int) bson.D {
+			return bson.D{
+				{Key: "_id", Value: id},
+				{Key: "chat_id", Value: "chat-1"},
+				{Key: "role", Value: role},
+				{Key: "content", Value: id},
+				{Key: "created_at", Value: base.Add(time.Duration(minute) * time.Minute)},
+			}
+		}
+
+		mt.AddMockResponses(
+			// 聊天
+			mtest.CreateCursorResponse(0, "test.chats", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "chat-1"},
+				{Key: "user_id", Value: "student@campus.edu"},
+				{Key: "title", Value: "Old chat"},
+			}),
+			// 聊天的全部消息
+			mtest.CreateCursorResponse(0, "test.messages", mtest.FirstBatch,
+				legacy("u1", "user", 0), legacy("a1", "assistant", 1), legacy("u2", "user", 2), legacy("a2", "assistant", 3)),
+			// 补全 parent_id
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}, bson.E{Key: "nModified", Value: 3}),
+			// 设置分支末端
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			// 要编辑的消息
+			mtest.CreateCursorResponse(0, "test.messages", mtest.FirstBatch,
+				append(legacy("u2", "user", 2), bson.E{Key: "parent_id", Value: "a1"})),
+		)
+
+		message, err := db.NewChatRepository().GetMessage(context.Background(), "student@campus.edu", "chat-1", "u2")
+		require.NoError(mt, err)
+		assert.Equal(mt, "a1", message.ParentID)
+
+		var parents map[string]string
+		var leaf string
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "update" {
+				continue
+			}
+			updates := event.Command.Lookup("updates").Array()
+			values, err := updates.Values()
+			require.NoError(mt, err)
+			for _, v := range values {
+				doc := v.Document()
+				set := doc.Lookup("u", "$set")
+				switch event.Command.Lookup("update").StringValue() {
+				case "messages":
+					if parents == nil {
+						parents = make(map[string]string)
+					}
+					parents[doc.Lookup("q", "_id").StringValue()] = set.Document().Lookup("parent_id").StringValue()
+				case "chats":
+					leaf = set.Document().Lookup("active_leaf_id").StringValue()
+				}
+			}
+		}
+		assert.Equal(mt, map[string]string{"a1": "u1", "u2": "a1", "a2": "u2"}, parents, "messages are linked in creation order before the edit")
+		assert.Equal(mt, "a2", leaf, "the last message becomes the active leaf")
+	})
+}
@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLockoutPolicy() auth.LockoutPolicy {
+	return auth.LockoutPolicy{
+		MaxFailures:     5,
+		IPMaxFailures:   20,
+		DelayAfter:      3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		FailureWindow:   15 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+func TestLockoutDelay(t *testing.T) {
+	policy := testLockoutPolicy()
+
+	assert.Equal(t, time.Duration(0), policy.Delay(0))
+	assert.Equal(t, time.Duration(0), policy.Delay(2))
+	assert.Equal(t, time.Second, policy.Delay(3))
+	assert.Equal(t, 2*time.Second, policy.Delay(4))
+	assert.Equal(t, 4*time.Second, policy.Delay(5))
+	assert.Equal(t, time.Minute, policy.Delay(20))
+	assert.Equal(t, time.Minute, policy.Delay(1000))
+}
+
+func TestCheckLoginAttempt(t *testing.T) {
+	policy := testLockoutPolicy()
+	now := time.Now()
+	lockedUntil := now.Add(10 * time.Minute)
+	expiredLock := now.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		attempt    *models.LoginAttempt
+		wantBlock  bool
+		wantLocked bool
+		wantRetry  time.Duration
+	}{
+		{"No record", nil, false, false, 0},
+		{"Few failures", &models.LoginAttempt{Failures: 2, LastFailureAt: now}, false, false, 0},
+		{"Progressive delay", &models.LoginAttempt{Failures: 4, LastFailureAt: now.Add(-500 * time.Millisecond)}, true, false, 1500 * time.Millisecond},
+		{"Delay elapsed", &models.LoginAttempt{Failures: 4, LastFailureAt: now.Add(-3 * time.Second)}, false, false, 0},
+		{"Locked account", &models.LoginAttempt{Failures: 5, LastFailureAt: now, LockedUntil: &lockedUntil}, true, true, 10 * time.Minute},
+		{"Lock expired", &models.LoginAttempt{Failures: 5, LastFailureAt: now.Add(-16 * time.Minute), LockedUntil: &expiredLock}, false, false, 0},
+		{"Old failures outside window", &models.LoginAttempt{Failures: 4, LastFailureAt: now.Add(-time.Hour)}, false, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := policy.CheckLoginAttempt(tt.attempt, policy.MaxFailures, now)
+			if !tt.wantBlock {
+				assert.Nil(t, block)
+				return
+			}
+			require.NotNil(t, block)
+			assert.Equal(t, tt.wantLocked, block.Locked)
+			assert.Equal(t, tt.wantRetry, block.RetryAfter)
+		})
+	}
+
+	t.Run("IP limit without lock", func(t *testing.T) {
+		attempt := &models.LoginAttempt{Failures: 20, LastFailureAt: now.Add(-time.Minute)}
+		block := policy.CheckLoginAttempt(attempt, policy.IPMaxFailures, now)
+		require.NotNil(t, block)
+		assert.False(t, block.Locked)
+		assert.Equal(t, 14*time.Minute, block.RetryAfter)
+	})
+}
@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// branchedChat 构造一个有分支的对话：
+//
+//	u1 ─ a1 ─ u2 ─ a2
+//	          └ u2e ─ a2e      (编辑 u2)
+//	     └ a1r                 (重新生成 a1)
+func branchedChat() []models.Message {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	msg := func(id, parent, role string, minute int) models.Message {
+		return models.Message{ID: id, ParentID: parent, Role: role, Content: id, CreatedAt: base.Add(time.Duration(minute) * time.Minute)}
+	}
+	return []models.Message{
+		msg("u1", "", "user", 0),
+		msg("a1", "u1", "assistant", 1),
+		msg("u2", "a1", "user", 2),
+		msg("a2", "u2", "assistant", 3),
+		msg("u2e", "a1", "user", 4),
+		msg("a2e", "u2e", "assistant", 5),
+		msg("a1r", "u1", "assistant", 6),
+	}
+}
+
+func ids(messages []models.Message) []string {
+	result := make([]string, len(messages))
+	for i, m := range messages {
+		result[i] = m.ID
+	}
+	return result
+}
+
+func TestActivePath(t *testing.T) {
+	messages := branchedChat()
+
+	path := models.ActivePath(messages, "a2")
+	assert.Equal(t, []string{"u1", "a1", "u2", "a2"}, ids(path))
+	assert.Nil(t, path[0].Siblings)
+	assert.Equal(t, []string{"a1", "a1r"}, path[1].Siblings)
+	assert.Equal(t, []string{"u2", "u2e"}, path[2].Siblings)
+	assert.Nil(t, path[3].Siblings)
+
+	assert.Equal(t, []string{"u1", "a1", "u2e", "a2e"}, ids(models.ActivePath(messages, "a2e")))
+	assert.Equal(t, []string{"u1", "a1r"}, ids(models.ActivePath(messages, "a1r")))
+	assert.Empty(t, models.ActivePath(messages, ""))
+	assert.Empty(t, models.ActivePath(messages, "missing"))
+}
+
+func TestLatestLeaf(t *testing.T) {
+	messages := branchedChat()
+
+	assert.Equal(t, "a2e", models.LatestLeaf(messages, "a1"))
+	assert.Equal(t, "a2", models.LatestLeaf(messages, "u2"))
+	assert.Equal(t, "a1r", models.LatestLeaf(messages, "a1r"))
+	// 从第一条消息开始时每层都选最新的分支
+	assert.Equal(t, "a1r", models.LatestLeaf(messages, "u1"))
+}
+
+func TestChainMessages(t *testing.T) {
+	legacy := []models.Message{{ID: "m1"}, {ID: "m2"}, {ID: "m3"}}
+
+	chained, leaf := models.ChainMessages(legacy)
+	assert.Equal(t, "m3", leaf)
+	assert.Equal(t, "", chained[0].ParentID)
+	assert.Equal(t, "m1", chained[1].ParentID)
+	assert.Equal(t, "m2", chained[2].ParentID)
+	assert.Equal(t, []string{"m1", "m2", "m3"}, ids(models.ActivePath(chained, leaf)))
+
+	_, leaf = models.ChainMessages(nil)
+	assert.Equal(t, "", leaf)
+}
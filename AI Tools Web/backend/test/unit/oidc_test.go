@@ -0,0 +1,264 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDCServer 本地模拟的身份提供方
+type mockOIDCServer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	clientID string
+
+	// 最近一次授权码请求中的 PKCE 参数和 nonce
+	challenge string
+	nonce     string
+	// 返回的 ID 令牌声明，测试可修改
+	claims jwt.MapClaims
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockOIDCServer{key: key, kid: "test-key", clientID: "test-client"}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": m.kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || auth.PKCEChallenge(r.Form.Get("code_verifier")) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "provider-access-token",
+			"token_type":   "Bearer",
+			"id_token":     m.signIDToken(t, m.claims),
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	m.claims = jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            m.clientID,
+		"sub":            "student-42",
+		"email":          "student@campus.edu",
+		"email_verified": true,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+	return m
+}
+
+func (m *mockOIDCServer) signIDToken(t *testing.T, claims jwt.MapClaims) string {
+	if _, ok := claims["nonce"]; !ok {
+		claims["nonce"] = m.nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (m *mockOIDCServer) provider() *auth.OIDCProvider {
+	return auth.NewOIDCProvider(auth.OIDCConfig{
+		IssuerURL:   m.server.URL,
+		ClientID:    m.clientID,
+		RedirectURL: "http://localhost:8080/api/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	})
+}
+
+// authorize 模拟浏览器访问授权地址，记录 PKCE challenge 和 nonce
+func (m *mockOIDCServer) authorize(t *testing.T, authURL string) url.Values {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	params := u.Query()
+	m.challenge = params.Get("code_challenge")
+	m.nonce = params.Get("nonce")
+	return params
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	m := newMockOIDCServer(t)
+	provider := m.provider()
+
+	verifier, err := auth.NewPKCEVerifier()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+	assert.Contains(t, authURL, m.server.URL+"/authorize?")
+
+	params := m.authorize(t, authURL)
+	assert.Equal(t, "code", params.Get("response_type"))
+	assert.Equal(t, m.clientID, params.Get("client_id"))
+	assert.Equal(t, "state-1", params.Get("state"))
+	assert.Equal(t, "nonce-1", params.Get("nonce"))
+	assert.Equal(t, "S256", params.Get("code_challenge_method"))
+	assert.Equal(t, auth.PKCEChallenge(verifier), params.Get("code_challenge"))
+	assert.Equal(t, "openid email profile", params.Get("scope"))
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockOIDCServer(t)
+	provider := m.provider()
+	ctx := context.Background()
+
+	verifier, err := auth.NewPKCEVerifier()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, "state", "expected-nonce", verifier)
+	require.NoError(t, err)
+	m.authorize(t, authURL)
+
+	t.Run("Valid code returns identity", func(t *testing.T) {
+		identity, err := provider.Exchange(ctx, "good-code", verifier, "expected-nonce")
+		require.NoError(t, err)
+		assert.Equal(t, m.server.URL, identity.Issuer)
+		assert.Equal(t, "student-42", identity.Subject)
+		assert.Equal(t, "student@campus.edu", identity.Email)
+		assert.True(t, identity.EmailVerified)
+	})
+
+	t.Run("Wrong PKCE verifier is rejected", func(t *testing.T) {
+		_, err := provider.Exchange(ctx, "good-code", "wrong-verifier", "expected-nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("Nonce mismatch is rejected", func(t *testing.T) {
+		_, err := provider.Exchange(ctx, "good-code", verifier, "other-nonce")
+		assert.Error(t, err)
+	})
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	m := newMockOIDCServer(t)
+	provider := m.provider()
+	ctx := context.Background()
+	m.nonce = "n"
+
+	baseClaims := func() jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		claims["nonce"] = "n"
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(jwt.MapClaims)
+		wantErr bool
+	}{
+		{"Valid token", func(c jwt.MapClaims) {}, false},
+		{"Wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }, true},
+		{"Wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, true},
+		{"Expired token", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, true},
+		{"Missing subject", func(c jwt.MapClaims) { delete(c, "sub") }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := baseClaims()
+			tt.modify(claims)
+			_, err := provider.VerifyIDToken(ctx, m.signIDToken(t, claims), "n")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("Token signed by unknown key is rejected", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, baseClaims())
+		token.Header["kid"] = m.kid
+		signed, err := token.SignedString(otherKey)
+		require.NoError(t, err)
+
+		_, err = provider.VerifyIDToken(ctx, signed, "n")
+		assert.Error(t, err)
+	})
+
+	t.Run("HMAC token is rejected", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, baseClaims())
+		signed, err := token.SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		_, err = provider.VerifyIDToken(ctx, signed, "n")
+		assert.Error(t, err)
+	})
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	// 提供方只读取一次配置，这里不会访问提供方
+	t.Setenv("OIDC_ISSUER_URL", "http://idp.invalid")
+	t.Setenv("OIDC_CLIENT_ID", "test-client")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/api/oidc/callback")
+	t.Setenv("OIDC_FRONTEND_REDIRECT_URL", "http://localhost:3000/login")
+
+	callback := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=good-code&state=attacker-state", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		auth.OIDCCallbackHandler(rr, req)
+		return rr
+	}
+
+	for name, cookie := range map[string]*http.Cookie{
+		"No cookie":               nil,
+		"Cookie of another state": {Name: "oidc_state", Value: "victim-state-hash"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := callback(cookie)
+			assert.Equal(t, http.StatusFound, rr.Code)
+			assert.Equal(t, "http://localhost:3000/login#error=sso_expired", rr.Header().Get("Location"))
+		})
+	}
+}
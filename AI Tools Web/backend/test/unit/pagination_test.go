@@ -0,0 +1,48 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageBounds(t *testing.T) {
+	ids := []string{"m1", "m2", "m3", "m4", "m5"}
+
+	tests := []struct {
+		name      string
+		query     models.PageQuery
+		wantStart int
+		wantEnd   int
+		wantNext  string
+	}{
+		{"latest page", models.PageQuery{Limit: 2}, 3, 5, "m4"},
+		{"everything fits", models.PageQuery{Limit: 10}, 0, 5, ""},
+		{"before cursor", models.PageQuery{Before: "m4", Limit: 2}, 1, 3, "m2"},
+		{"before reaches the start", models.PageQuery{Before: "m3", Limit: 2}, 0, 2, ""},
+		{"before first message", models.PageQuery{Before: "m1", Limit: 2}, 0, 0, ""},
+		{"after cursor", models.PageQuery{After: "m1", Limit: 2}, 1, 3, "m3"},
+		{"after reaches the end", models.PageQuery{After: "m3", Limit: 2}, 3, 5, ""},
+		{"after last message", models.PageQuery{After: "m5", Limit: 2}, 5, 5, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, next, ok := models.PageBounds(ids, tt.query)
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantStart, start)
+			assert.Equal(t, tt.wantEnd, end)
+			assert.Equal(t, tt.wantNext, next)
+		})
+	}
+}
+
+func TestPageBoundsUnknownCursor(t *testing.T) {
+	ids := []string{"m1", "m2"}
+
+	_, _, _, ok := models.PageBounds(ids, models.PageQuery{Before: "other", Limit: 10})
+	assert.False(t, ok)
+	_, _, _, ok = models.PageBounds(ids, models.PageQuery{After: "other", Limit: 10})
+	assert.False(t, ok)
+}
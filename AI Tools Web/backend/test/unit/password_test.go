@@ -0,0 +1,80 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := auth.HashPassword("s3cret-password")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "s3cret-password", hash)
+	assert.True(t, auth.IsPasswordHash(hash))
+
+	_, err = auth.HashPassword("")
+	assert.ErrorIs(t, err, auth.ErrEmptyPassword)
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := auth.HashPassword("s3cret-password")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		stored     string
+		password   string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{
+			name:     "Correct password against hash",
+			stored:   hash,
+			password: "s3cret-password",
+			wantOK:   true,
+		},
+		{
+			name:     "Wrong password against hash",
+			stored:   hash,
+			password: "wrong-password",
+		},
+		{
+			name:       "Legacy plaintext password",
+			stored:     "plain-password",
+			password:   "plain-password",
+			wantOK:     true,
+			wantRehash: true,
+		},
+		{
+			name:     "Wrong legacy plaintext password",
+			stored:   "plain-password",
+			password: "other-password",
+		},
+		{
+			name:     "Empty password",
+			stored:   "",
+			password: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := auth.CheckPassword(tt.stored, tt.password)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantRehash, rehash)
+		})
+	}
+}
+
+func TestCheckPasswordCostChange(t *testing.T) {
+	os.Setenv("BCRYPT_COST", "4")
+	hash, err := auth.HashPassword("s3cret-password")
+	os.Unsetenv("BCRYPT_COST")
+	assert.NoError(t, err)
+
+	ok, rehash := auth.CheckPassword(hash, "s3cret-password")
+	assert.True(t, ok)
+	assert.True(t, rehash, "hash with a different cost should be upgraded")
+}
@@ -0,0 +1,52 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateVariables(t *testing.T) {
+	assert.Equal(t, []string{"topic", "level"},
+		models.TemplateVariables("Explain {{topic}} to a {{ level }} student. Keep {{topic}} simple."))
+	assert.Equal(t, []string{"主题"}, models.TemplateVariables("用三句话解释{{主题}}"))
+	assert.Equal(t, []string{}, models.TemplateVariables("No variables, {{ }} or {{1st}} here"))
+}
+
+func TestFillTemplate(t *testing.T) {
+	content, err := models.FillTemplate("Explain {{topic}} to a {{ level }} student.", map[string]string{
+		"topic": "recursion",
+		"level": "{{topic}}",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Explain recursion to a {{topic}} student.", content, "values are not substituted again")
+
+	content, err = models.FillTemplate("Plain prompt", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Plain prompt", content)
+
+	_, err = models.FillTemplate("Compare {{a}} and {{b}} in {{lang}}", map[string]string{"a": "maps", "b": "  "})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, models.ErrMissingTemplateVariables))
+	assert.Contains(t, err.Error(), "b, lang")
+}
+
+func TestPersonaJSON(t *testing.T) {
+	temperature := 0.3
+	data, err := json.Marshal(models.Persona{
+		ID:           "p1",
+		OwnerEmail:   "owner@example.com",
+		Name:         "Code reviewer",
+		Instructions: "Review code for bugs first.",
+		Temperature:  &temperature,
+		Editable:     true,
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "owner@example.com", "the owner is not returned to other users")
+	assert.Contains(t, string(data), `"editable":true`)
+	assert.Contains(t, string(data), `"temperature":0.3`)
+}
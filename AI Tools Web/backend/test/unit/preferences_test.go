@@ -0,0 +1,81 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOpenAIServer 记录收到的请求体并返回固定回复
+func mockOpenAIServer(t *testing.T, received *map[string]interface{}) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(received))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCallOptionsApplied(t *testing.T) {
+	var body map[string]interface{}
+	server := mockOpenAIServer(t, &body)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	temperature := 0.2
+	reply, err := services.CallOpenAI(context.Background(), "hello", "gpt-4o", services.CallOptions{
+		SystemPrompt: "Answer like a pirate.",
+		Temperature:  &temperature,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", reply)
+
+	assert.Equal(t, 0.2, body["temperature"])
+	messages := body["messages"].([]interface{})
+	system := messages[0].(map[string]interface{})
+	assert.Equal(t, "system", system["role"])
+	assert.Equal(t, "Answer like a pirate.", system["content"])
+}
+
+func TestCallOptionsDefaults(t *testing.T) {
+	var body map[string]interface{}
+	server := mockOpenAIServer(t, &body)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	_, err := services.CallOpenAI(context.Background(), "hello", "gpt-4o", services.CallOptions{})
+	require.NoError(t, err)
+
+	// 未指定时保留服务默认的 temperature 和系统提示
+	assert.Equal(t, 0.7, body["temperature"])
+	system := body["messages"].([]interface{})[0].(map[string]interface{})
+	assert.Contains(t, system["content"], "You are gpt-4o")
+}
+
+func TestCallOptionsTemperatureClamped(t *testing.T) {
+	var body map[string]interface{}
+	server := mockOpenAIServer(t, &body)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	temperature := 5.0
+	_, err := services.CallOpenAI(context.Background(), "hello", "gpt-4o", services.CallOptions{Temperature: &temperature})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, body["temperature"])
+}
+
+func TestIsValidLanguage(t *testing.T) {
+	assert.True(t, models.IsValidLanguage(models.LanguageEnglish))
+	assert.True(t, models.IsValidLanguage(models.LanguageChinese))
+	assert.True(t, models.IsValidLanguage(models.LanguageAuto))
+	assert.False(t, models.IsValidLanguage("klingon"))
+	assert.False(t, models.IsValidLanguage(""))
+}
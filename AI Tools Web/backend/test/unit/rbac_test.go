@@ -0,0 +1,61 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirePermission(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		role       string
+		anonymous  bool
+		permission string
+		wantStatus int
+	}{
+		{"User can write chats", models.RoleUser, false, auth.PermChatWrite, http.StatusOK},
+		{"Legacy token without role is a user", "", false, auth.PermChatWrite, http.StatusOK},
+		{"Read-only user cannot write chats", models.RoleReadOnly, false, auth.PermChatWrite, http.StatusForbidden},
+		{"Read-only user can read chats", models.RoleReadOnly, false, auth.PermChatRead, http.StatusOK},
+		{"User cannot clear vectors", models.RoleUser, false, auth.PermRAGAdmin, http.StatusForbidden},
+		{"Admin can clear vectors", models.RoleAdmin, false, auth.PermRAGAdmin, http.StatusOK},
+		{"User cannot manage users", models.RoleUser, false, auth.PermManageUsers, http.StatusForbidden},
+		{"Unauthenticated request", "", true, auth.PermChatRead, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/api/test", nil)
+			assert.NoError(t, err)
+			if !tt.anonymous {
+				claims := auth.UserClaims{Username: "testuser", Email: "test@example.com", Role: tt.role}
+				req = req.WithContext(context.WithValue(req.Context(), "user", claims))
+			}
+
+			rr := httptest.NewRecorder()
+			auth.RequirePermission(tt.permission)(okHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestGenerateTokenWithRole(t *testing.T) {
+	token, err := auth.GenerateTokenWithRole("admin", "admin@example.com", models.RoleAdmin)
+	assert.NoError(t, err)
+
+	claims, err := auth.ValidateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, claims.Role)
+	assert.True(t, claims.HasPermission(auth.PermManageUsers))
+}
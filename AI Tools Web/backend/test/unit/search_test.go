@@ -0,0 +1,64 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// snippetText 拼接片段，匹配部分用 [] 标出
+func snippetText(parts []models.SnippetPart) string {
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Match {
+			b.WriteString("[" + p.Text + "]")
+		} else {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+func TestSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"binary", "search"}, models.SearchTerms("binary search"))
+	assert.Equal(t, []string{"merge sort", "python"}, models.SearchTerms(`"merge sort" python -java`))
+	assert.Equal(t, []string{"快速排序"}, models.SearchTerms("  快速排序  "))
+	assert.Empty(t, models.SearchTerms(`-only ""`))
+}
+
+func TestBuildSnippetHighlightsMatches(t *testing.T) {
+	parts := models.BuildSnippet("Binary search runs in O(log n).\nUse binary search on sorted data.", []string{"binary", "search"}, 200)
+	assert.Equal(t, "[Binary] [search] runs in O(log n). Use [binary] [search] on sorted data.", snippetText(parts))
+}
+
+func TestBuildSnippetCentersOnFirstMatch(t *testing.T) {
+	content := strings.Repeat("a", 100) + " needle " + strings.Repeat("b", 100)
+	parts := models.BuildSnippet(content, []string{"NEEDLE"}, 40)
+
+	text := snippetText(parts)
+	assert.True(t, strings.HasPrefix(text, "…"))
+	assert.True(t, strings.HasSuffix(text, "…"))
+	assert.Contains(t, text, "[needle]")
+	// 省略号之外的内容不超过片段长度
+	assert.Equal(t, 40, len([]rune(strings.NewReplacer("…", "", "[", "", "]", "").Replace(text))))
+}
+
+func TestBuildSnippetWithoutMatch(t *testing.T) {
+	parts := models.BuildSnippet("学习 Go 语言的并发模型", []string{"python"}, 6)
+	assert.Equal(t, "学习 Go …", snippetText(parts))
+}
+
+func TestBuildSnippetChinese(t *testing.T) {
+	parts := models.BuildSnippet("快速排序的平均复杂度是 O(n log n)", []string{"快速排序"}, 100)
+	assert.Equal(t, "[快速排序]的平均复杂度是 O(n log n)", snippetText(parts))
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, models.CosineSimilarity([]float32{1, 2, 3}, []float32{2, 4, 6}), 1e-9)
+	assert.InDelta(t, 0.0, models.CosineSimilarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.InDelta(t, -1.0, models.CosineSimilarity([]float32{1, 1}, []float32{-1, -1}), 1e-9)
+	assert.Equal(t, 0.0, models.CosineSimilarity([]float32{1, 2}, []float32{1, 2, 3}))
+	assert.Equal(t, 0.0, models.CosineSimilarity([]float32{0, 0}, []float32{1, 1}))
+}
@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewShareToken(t *testing.T) {
+	token, hash, err := auth.NewShareToken()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token, auth.ShareTokenPrefix))
+	assert.Equal(t, hash, auth.HashShareToken(token))
+	assert.NotContains(t, hash, token)
+
+	other, _, err := auth.NewShareToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestShareURL(t *testing.T) {
+	t.Setenv("APP_BASE_URL", "https://tutor.example.com/")
+	assert.Equal(t, "https://tutor.example.com/share/zsh_abc", auth.ShareURL("zsh_abc"))
+}
+
+func TestSharedChatView(t *testing.T) {
+	created := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	path := []models.Message{
+		{ID: "m1", ChatID: "c1", Role: "user", Content: "What is a closure?", CreatedAt: created},
+		{ID: "m2", ChatID: "c1", Role: "assistant", Content: "A function value...", ParentID: "m1", CreatedAt: created.Add(time.Minute),
+			Context: &models.ContextInfo{Policy: models.ContextPolicyTruncate}},
+	}
+	share := &models.ChatShare{
+		ID:        "s1",
+		UserEmail: "alice@example.com",
+		ChatID:    "c1",
+		Title:     "Closures",
+		Model:     "gpt-4o",
+		TokenHash: "secret-hash",
+		Messages:  models.SnapshotMessages(path),
+		CreatedAt: created.Add(time.Hour),
+	}
+
+	data, err := json.Marshal(share.View())
+	require.NoError(t, err)
+	body := string(data)
+
+	// 公开内容只包含标题、模型和消息
+	assert.Contains(t, body, "What is a closure?")
+	assert.Contains(t, body, `"title":"Closures"`)
+	assert.NotContains(t, body, "alice@example.com")
+	assert.NotContains(t, body, "secret-hash")
+	assert.NotContains(t, body, "m1")
+	assert.NotContains(t, body, "c1")
+
+	// 所有者看到的分享列表不包含令牌哈希和快照
+	data, err = json.Marshal(share)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-hash")
+	assert.NotContains(t, string(data), "What is a closure?")
+}
@@ -0,0 +1,97 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOpenAIStream 以 SSE 返回 chunks，complete 为 false 时在发送完后直接断开连接
+func mockOpenAIStream(t *testing.T, chunks []string, complete bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", chunk)
+			w.(http.Flusher).Flush()
+		}
+		if complete {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		// 模拟上游连接中断
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIStreamReturnsReply(t *testing.T) {
+	server := mockOpenAIStream(t, []string{"Hello", ", ", "world"}, true)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	w := httptest.NewRecorder()
+	history := []models.Message{{Role: "user", Content: "hi"}}
+	reply, err := services.CallOpenAIStreamWithHistory(context.Background(), w, "hi", "gpt-4o", history, services.CallOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello, world", reply)
+	assert.Contains(t, w.Body.String(), `data: "Hello"`)
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+}
+
+func TestOpenAIStreamReturnsPartialReply(t *testing.T) {
+	server := mockOpenAIStream(t, []string{"Hello", ", "}, false)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	w := httptest.NewRecorder()
+	history := []models.Message{{Role: "user", Content: "hi"}}
+	reply, err := services.CallOpenAIStreamWithHistory(context.Background(), w, "hi", "gpt-4o", history, services.CallOptions{})
+	require.Error(t, err)
+
+	// 中断前收到的内容仍然返回，由调用方保存为 incomplete
+	assert.Equal(t, "Hello, ", reply)
+	assert.NotContains(t, w.Body.String(), "[DONE]")
+}
+
+func TestOpenAIStreamCanceled(t *testing.T) {
+	upstreamClosed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		// 一直等到调用方取消请求
+		<-r.Context().Done()
+		close(upstreamClosed)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	w := httptest.NewRecorder()
+	history := []models.Message{{Role: "user", Content: "hi"}}
+	reply, err := services.CallOpenAIStreamWithHistory(ctx, w, "hi", "gpt-4o", history, services.CallOptions{})
+	require.Error(t, err)
+	assert.Equal(t, "Hello", reply)
+
+	// 取消后到模型服务的请求也被关闭
+	select {
+	case <-upstreamClosed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request was not canceled")
+	}
+}
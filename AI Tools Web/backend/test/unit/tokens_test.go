@@ -0,0 +1,52 @@
+package auth_test
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountTokens(t *testing.T) {
+	// OpenAI 模型使用 tiktoken 编码
+	assert.Equal(t, 2, services.CountTokens("gpt-4o", "hello world"))
+	assert.Equal(t, 0, services.CountTokens("gpt-4o", ""))
+	// 特殊 token 的文本按普通文本计算，不会出错
+	assert.Greater(t, services.CountTokens("gpt-3.5-turbo", "<|endoftext|>"), 1)
+
+	// Claude 使用估算：中文每个字一个 token，其他文字每 3.5 个字符一个
+	assert.Equal(t, 4, services.CountTokens("claude-3-5-sonnet-20241022", "你好世界"))
+	assert.Equal(t, 2, services.CountTokens("claude-3-5-sonnet-20241022", "abcdefg"))
+}
+
+func TestFitHistory(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	history := []models.Message{
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: "short question"},
+	}
+
+	// 预算足够时保留全部历史
+	assert.Equal(t, 0, services.FitHistory("gpt-4o", history, 100000))
+
+	// 只够保留后两条消息时，从用户消息开始，因此只保留最后一条
+	assert.Equal(t, 4, services.FitHistory("gpt-4o", history, 150))
+
+	// 够保留后三条消息时从第三条（用户消息）开始
+	assert.Equal(t, 2, services.FitHistory("gpt-4o", history, 250))
+
+	// 最后一条消息总是保留
+	assert.Equal(t, 4, services.FitHistory("gpt-4o", history, 1))
+}
+
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, 128000, models.ContextWindow("gpt-4o"))
+	assert.Equal(t, 200000, models.ContextWindow("claude-3-5-sonnet-20241022"))
+	// 未知模型使用保守的默认值
+	assert.Greater(t, models.ContextWindow("unknown-model"), 0)
+}
@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 4226 附录 D 和 RFC 6238 附录 B 使用的密钥
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHOTPRFC4226Vectors(t *testing.T) {
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, want := range expected {
+		assert.Equal(t, want, auth.HOTP(rfcSecret, uint64(counter), 6), "counter %d", counter)
+	}
+}
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// SHA1 测试向量，8 位数字，30 秒步长
+	vectors := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		assert.Equal(t, v.want, auth.HOTP(rfcSecret, uint64(v.unix/30), 8), "time %d", v.unix)
+	}
+
+	// 6 位验证码是 8 位结果的后 6 位
+	secret := base32.StdEncoding.EncodeToString(rfcSecret)
+	code, err := auth.TOTPCode(secret, time.Unix(1234567890, 0))
+	require.NoError(t, err)
+	assert.Equal(t, "005924", code)
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	code, err := auth.TOTPCode(secret, now)
+	require.NoError(t, err)
+
+	step, ok := auth.ValidateTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30, step)
+
+	t.Run("Clock skew of one step is accepted", func(t *testing.T) {
+		_, ok := auth.ValidateTOTP(secret, code, now.Add(30*time.Second), 0)
+		assert.True(t, ok)
+		_, ok = auth.ValidateTOTP(secret, code, now.Add(-30*time.Second), 0)
+		assert.True(t, ok)
+	})
+
+	t.Run("Old code is rejected", func(t *testing.T) {
+		_, ok := auth.ValidateTOTP(secret, code, now.Add(2*time.Minute), 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("Replayed code is rejected", func(t *testing.T) {
+		_, ok := auth.ValidateTOTP(secret, code, now, step)
+		assert.False(t, ok)
+	})
+
+	t.Run("Wrong code is rejected", func(t *testing.T) {
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+		_, ok := auth.ValidateTOTP(secret, wrong, now, 0)
+		assert.False(t, ok)
+		_, ok = auth.ValidateTOTP(secret, "12345", now, 0)
+		assert.False(t, ok)
+	})
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := auth.TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "AI Tools Web", "student@example.com")
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/AI Tools Web:student@example.com", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "AI Tools Web", u.Query().Get("issuer"))
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := auth.GenerateRecoveryCodes(10)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Len(t, hashes, 10)
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		assert.Len(t, code, 9)
+		assert.Equal(t, "-", code[4:5])
+		assert.False(t, seen[code])
+		seen[code] = true
+		assert.NotContains(t, hashes[i], strings.ReplaceAll(code, "-", ""))
+	}
+}
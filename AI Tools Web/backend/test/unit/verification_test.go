@@ -0,0 +1,135 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"backend/internal/mail"
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionToken(t *testing.T) {
+	token, err := auth.GenerateActionToken("test@example.com", auth.PurposeResetPassword, "fingerprint", time.Hour)
+	require.NoError(t, err)
+
+	t.Run("Valid token", func(t *testing.T) {
+		parsed, err := auth.ParseActionToken(token, auth.PurposeResetPassword)
+		require.NoError(t, err)
+		assert.Equal(t, "test@example.com", parsed.Email)
+		assert.Equal(t, "fingerprint", parsed.Binding)
+		assert.NotEmpty(t, parsed.ID)
+	})
+
+	t.Run("Wrong purpose is rejected", func(t *testing.T) {
+		_, err := auth.ParseActionToken(token, auth.PurposeVerifyEmail)
+		assert.ErrorIs(t, err, auth.ErrInvalidActionToken)
+	})
+
+	t.Run("Expired token is rejected", func(t *testing.T) {
+		expired, err := auth.GenerateActionToken("test@example.com", auth.PurposeVerifyEmail, "", -time.Minute)
+		require.NoError(t, err)
+		_, err = auth.ParseActionToken(expired, auth.PurposeVerifyEmail)
+		assert.ErrorIs(t, err, auth.ErrInvalidActionToken)
+	})
+
+	t.Run("Tampered token is rejected", func(t *testing.T) {
+		_, err := auth.ParseActionToken(token+"x", auth.PurposeResetPassword)
+		assert.ErrorIs(t, err, auth.ErrInvalidActionToken)
+	})
+
+	t.Run("Action token is not an access token", func(t *testing.T) {
+		_, err := auth.ValidateToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("Access token is not an action token", func(t *testing.T) {
+		access, err := auth.GenerateToken("testuser", "test@example.com")
+		require.NoError(t, err)
+		_, err = auth.ParseActionToken(access, auth.PurposeResetPassword)
+		assert.ErrorIs(t, err, auth.ErrInvalidActionToken)
+	})
+}
+
+// startFakeSMTPServer 极简的 SMTP 服务器，记录收到的邮件内容
+func startFakeSMTPServer(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := startFakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	mailer := &mail.SMTPMailer{Host: host, Port: port, From: "no-reply@example.com"}
+	err = mailer.Send(context.Background(), mail.Message{
+		To:      "student@example.com",
+		Subject: "Reset your password\r\nBcc: attacker@example.com",
+		Body:    "Open this link:\nhttp://localhost:3000/reset-password?token=abc",
+	})
+	require.NoError(t, err)
+
+	select {
+	case data := <-received:
+		assert.Contains(t, data, "To: student@example.com\r\n")
+		assert.Contains(t, data, "reset-password?token=abc")
+		// 主题中的换行被去除，不能注入额外的邮件头
+		assert.NotContains(t, data, "\r\nBcc:")
+	case <-time.After(5 * time.Second):
+		t.Fatal("mail was not delivered")
+	}
+}
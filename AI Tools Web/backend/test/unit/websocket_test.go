@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"backend/internal/auth"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocketToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		upgrade   string
+		protocol  string
+		wantToken string
+		wantOK    bool
+	}{
+		{"bearer subprotocol", "websocket", "bearer, abc.def.ghi", "abc.def.ghi", true},
+		{"upgrade header is case insensitive", "WebSocket", "bearer,abc.def.ghi", "abc.def.ghi", true},
+		{"not a websocket request", "", "bearer, abc.def.ghi", "", false},
+		{"missing token", "websocket", "bearer", "", false},
+		{"empty token", "websocket", "bearer, ", "", false},
+		{"other subprotocol", "websocket", "graphql-ws, abc", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/chat/ws", nil)
+			if tt.upgrade != "" {
+				r.Header.Set("Upgrade", tt.upgrade)
+			}
+			r.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+
+			token, ok := auth.WebSocketToken(r)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantToken, token)
+		})
+	}
+}
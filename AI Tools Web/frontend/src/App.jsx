@@ -8,6 +8,10 @@ import HomePage from './pages/HomePage';
 import SupportPage from './pages/SupportPage';
 import SettingsPage from './pages/SettingsPage.jsx';
 import RAGPage from './pages/RAGPage';
+import ForgotPasswordPage from './pages/ForgotPasswordPage';
+import ResetPasswordPage from './pages/ResetPasswordPage';
+import VerifyEmailPage from './pages/VerifyEmailPage';
+import SharedChatPage from './pages/SharedChatPage';
 import { App as AntdApp } from 'antd';
 
 // Protected Route Component
@@ -54,6 +58,10 @@ function App() {
             {/* Public Routes */}
             <Route path="/login" element={<PublicRoute><LoginPage /></PublicRoute>} />
             <Route path="/signup" element={<PublicRoute><SignUpPage /></PublicRoute>} />
+            <Route path="/forgot-password" element={<PublicRoute><ForgotPasswordPage /></PublicRoute>} />
+            <Route path="/reset-password" element={<ResetPasswordPage />} />
+            <Route path="/verify-email" element={<VerifyEmailPage />} />
+            <Route path="/share/:token" element={<SharedChatPage />} />
 
             {/* Protected Routes */}
             <Route path="/" element={<ProtectedRoute><HomePage /></ProtectedRoute>}>
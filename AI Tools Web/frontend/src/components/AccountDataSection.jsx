@@ -0,0 +1,126 @@
+import React, { useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import {
+  Typography,
+  Paper,
+  Button,
+  Divider,
+  Alert,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogContentText,
+  DialogTitle,
+  TextField
+} from '@mui/material';
+import DownloadIcon from '@mui/icons-material/Download';
+import DeleteForeverIcon from '@mui/icons-material/DeleteForever';
+import request from '../utils/request';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+// 账户数据：导出全部数据、删除账户
+const AccountDataSection = () => {
+  const navigate = useNavigate();
+  const [error, setError] = useState(null);
+  const [exporting, setExporting] = useState(false);
+  const [openDialog, setOpenDialog] = useState(false);
+  const [password, setPassword] = useState('');
+  const [code, setCode] = useState('');
+
+  const handleExport = async () => {
+    setError(null);
+    setExporting(true);
+    try {
+      const response = await fetch(`${API_BASE_URL}/api/user/export`, {
+        headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+      });
+      if (!response.ok) {
+        throw new Error((await response.text()).trim() || response.statusText);
+      }
+      const blob = await response.blob();
+      const url = URL.createObjectURL(blob);
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = `account-export-${new Date().toISOString().slice(0, 10)}.zip`;
+      link.click();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      setError('Failed to export data: ' + err.message);
+    } finally {
+      setExporting(false);
+    }
+  };
+
+  const handleDelete = async () => {
+    setError(null);
+    const isRecoveryCode = code.includes('-') || code.length > 6;
+    try {
+      await request(`${API_BASE_URL}/api/user/delete`, {
+        method: 'POST',
+        body: JSON.stringify(isRecoveryCode ? { password, recovery_code: code } : { password, code })
+      });
+      localStorage.removeItem('username');
+      localStorage.removeItem('token');
+      localStorage.removeItem('refreshToken');
+      navigate('/login', { replace: true });
+    } catch (err) {
+      setOpenDialog(false);
+      setError('Failed to delete account: ' + err.message);
+    }
+  };
+
+  return (
+    <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
+      <Typography variant="h6" gutterBottom>
+        Your Data
+      </Typography>
+      <Divider sx={{ mb: 2 }} />
+
+      {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+      <Typography variant="body1" paragraph>
+        Download a copy of your profile, chats and uploaded document list, or permanently delete your account.
+      </Typography>
+
+      <Button variant="outlined" startIcon={<DownloadIcon />} onClick={handleExport} disabled={exporting} sx={{ mr: 2 }}>
+        {exporting ? 'Preparing...' : 'Export My Data'}
+      </Button>
+      <Button variant="contained" color="error" startIcon={<DeleteForeverIcon />} onClick={() => setOpenDialog(true)}>
+        Delete Account
+      </Button>
+
+      <Dialog open={openDialog} onClose={() => setOpenDialog(false)} maxWidth="sm" fullWidth>
+        <DialogTitle>Delete Account</DialogTitle>
+        <DialogContent>
+          <DialogContentText sx={{ mb: 2 }}>
+            This permanently deletes your account, all chats and your documents in the knowledge base. This cannot be undone.
+          </DialogContentText>
+          <TextField
+            margin="dense"
+            label="Password"
+            type="password"
+            fullWidth
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+          />
+          <TextField
+            margin="dense"
+            label="Two-factor code (if enabled)"
+            fullWidth
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setOpenDialog(false)}>Cancel</Button>
+          <Button variant="contained" color="error" onClick={handleDelete}>
+            Delete Permanently
+          </Button>
+        </DialogActions>
+      </Dialog>
+    </Paper>
+  );
+};
+
+export default AccountDataSection;
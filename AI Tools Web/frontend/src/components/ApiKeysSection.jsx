@@ -0,0 +1,187 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Box,
+  Typography,
+  Paper,
+  Button,
+  Divider,
+  Alert,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogTitle,
+  TextField,
+  FormGroup,
+  FormControlLabel,
+  Checkbox,
+  IconButton,
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableRow
+} from '@mui/material';
+import DeleteIcon from '@mui/icons-material/Delete';
+import KeyIcon from '@mui/icons-material/Key';
+import request from '../utils/request';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const SCOPES = [
+  { value: 'chat:read', label: 'Read chats' },
+  { value: 'chat:write', label: 'Send messages' },
+  { value: 'rag:query', label: 'Query knowledge base' },
+  { value: 'rag:upload', label: 'Upload documents' },
+];
+
+const formatDate = (value) => (value ? new Date(value).toLocaleString() : '—');
+
+// 个人访问令牌管理，用于脚本调用 chat 和 RAG 接口
+const ApiKeysSection = () => {
+  const [keys, setKeys] = useState([]);
+  const [error, setError] = useState(null);
+  const [openDialog, setOpenDialog] = useState(false);
+  const [name, setName] = useState('');
+  const [scopes, setScopes] = useState(['chat:read']);
+  const [expiresInDays, setExpiresInDays] = useState(90);
+  const [createdToken, setCreatedToken] = useState(null);
+
+  const loadKeys = async () => {
+    try {
+      const data = await request(`${API_BASE_URL}/api/user/api-keys`);
+      setKeys(data || []);
+    } catch (err) {
+      setError('Failed to load API keys: ' + err.message);
+    }
+  };
+
+  useEffect(() => {
+    loadKeys();
+  }, []);
+
+  const toggleScope = (scope) => {
+    setScopes(scopes.includes(scope) ? scopes.filter(s => s !== scope) : [...scopes, scope]);
+  };
+
+  const handleCreate = async () => {
+    setError(null);
+    try {
+      const data = await request(`${API_BASE_URL}/api/user/api-keys`, {
+        method: 'POST',
+        body: JSON.stringify({ name, scopes, expires_in_days: Number(expiresInDays) || 0 })
+      });
+      setCreatedToken(data.token);
+      setOpenDialog(false);
+      setName('');
+      loadKeys();
+    } catch (err) {
+      setError('Failed to create API key: ' + err.message);
+    }
+  };
+
+  const handleDelete = async (id) => {
+    try {
+      await request(`${API_BASE_URL}/api/user/api-keys/${id}`, { method: 'DELETE' });
+      setKeys(keys.filter(k => k.id !== id));
+    } catch (err) {
+      setError('Failed to delete API key: ' + err.message);
+    }
+  };
+
+  return (
+    <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
+      <Typography variant="h6" gutterBottom>
+        API Keys
+      </Typography>
+      <Divider sx={{ mb: 2 }} />
+
+      <Typography variant="body1" paragraph>
+        Personal API keys let scripts call the chat and knowledge base APIs with
+        an <code>Authorization: Bearer</code> header.
+      </Typography>
+
+      {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+      {createdToken && (
+        <Alert severity="success" sx={{ mb: 2 }} onClose={() => setCreatedToken(null)}>
+          Copy your new API key now, it will not be shown again:
+          <Box component="code" sx={{ display: 'block', mt: 1, wordBreak: 'break-all' }}>{createdToken}</Box>
+        </Alert>
+      )}
+
+      {keys.length > 0 && (
+        <Table size="small" sx={{ mb: 2 }}>
+          <TableHead>
+            <TableRow>
+              <TableCell>Name</TableCell>
+              <TableCell>Key</TableCell>
+              <TableCell>Scopes</TableCell>
+              <TableCell>Expires</TableCell>
+              <TableCell>Last used</TableCell>
+              <TableCell />
+            </TableRow>
+          </TableHead>
+          <TableBody>
+            {keys.map(key => (
+              <TableRow key={key.id}>
+                <TableCell>{key.name}</TableCell>
+                <TableCell><code>{key.prefix}…</code></TableCell>
+                <TableCell>{key.scopes.join(', ')}</TableCell>
+                <TableCell>{key.expires_at ? formatDate(key.expires_at) : 'Never'}</TableCell>
+                <TableCell>{formatDate(key.last_used_at)}</TableCell>
+                <TableCell>
+                  <IconButton aria-label="delete api key" onClick={() => handleDelete(key.id)}>
+                    <DeleteIcon />
+                  </IconButton>
+                </TableCell>
+              </TableRow>
+            ))}
+          </TableBody>
+        </Table>
+      )}
+
+      <Button variant="contained" startIcon={<KeyIcon />} onClick={() => setOpenDialog(true)}>
+        Create API Key
+      </Button>
+
+      <Dialog open={openDialog} onClose={() => setOpenDialog(false)} maxWidth="sm" fullWidth>
+        <DialogTitle>Create API Key</DialogTitle>
+        <DialogContent>
+          <TextField
+            margin="dense"
+            label="Name"
+            fullWidth
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+            sx={{ mb: 2 }}
+          />
+          <FormGroup sx={{ mb: 2 }}>
+            {SCOPES.map(scope => (
+              <FormControlLabel
+                key={scope.value}
+                control={<Checkbox checked={scopes.includes(scope.value)} onChange={() => toggleScope(scope.value)} />}
+                label={`${scope.label} (${scope.value})`}
+              />
+            ))}
+          </FormGroup>
+          <TextField
+            margin="dense"
+            label="Expires in days (0 = never)"
+            type="number"
+            fullWidth
+            value={expiresInDays}
+            onChange={(e) => setExpiresInDays(e.target.value)}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setOpenDialog(false)}>Cancel</Button>
+          <Button variant="contained" onClick={handleCreate} disabled={!name.trim() || scopes.length === 0}>
+            Create
+          </Button>
+        </DialogActions>
+      </Dialog>
+    </Paper>
+  );
+};
+
+export default ApiKeysSection;
@@ -0,0 +1,213 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Typography,
+  Paper,
+  Button,
+  Divider,
+  Alert,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogTitle,
+  TextField,
+  FormControlLabel,
+  Checkbox,
+  IconButton,
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableRow
+} from '@mui/material';
+import DeleteIcon from '@mui/icons-material/Delete';
+import EditIcon from '@mui/icons-material/Edit';
+import AddIcon from '@mui/icons-material/Add';
+import request from '../utils/request';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const emptyForm = {
+  name: '',
+  description: '',
+  instructions: '',
+  model: '',
+  temperature: '',
+  starter_prompts: '',
+  global: false
+};
+
+// 助手角色管理：角色的指令、默认模型和示例问题用于从该角色创建的聊天
+const PersonasSection = () => {
+  const [personas, setPersonas] = useState([]);
+  const [error, setError] = useState(null);
+  const [editing, setEditing] = useState(null); // null 表示对话框关闭，'' 表示新建
+  const [form, setForm] = useState(emptyForm);
+
+  const loadPersonas = async () => {
+    try {
+      const data = await request(`${API_BASE_URL}/api/chat/personas`);
+      setPersonas(data || []);
+    } catch (err) {
+      setError('Failed to load personas: ' + err.message);
+    }
+  };
+
+  useEffect(() => {
+    loadPersonas();
+  }, []);
+
+  const openDialog = (persona) => {
+    setForm(persona ? {
+      name: persona.name,
+      description: persona.description || '',
+      instructions: persona.instructions,
+      model: persona.model || '',
+      temperature: persona.temperature ?? '',
+      starter_prompts: persona.starter_prompts.join('\n'),
+      global: persona.global
+    } : emptyForm);
+    setEditing(persona ? persona.id : '');
+  };
+
+  const setField = (field) => (e) => setForm({ ...form, [field]: e.target.type === 'checkbox' ? e.target.checked : e.target.value });
+
+  const handleSave = async () => {
+    setError(null);
+    const body = {
+      ...form,
+      temperature: form.temperature === '' ? null : Number(form.temperature),
+      starter_prompts: form.starter_prompts.split('\n').map(p => p.trim()).filter(Boolean)
+    };
+    try {
+      await request(editing ? `${API_BASE_URL}/api/chat/personas/${editing}` : `${API_BASE_URL}/api/chat/personas`, {
+        method: editing ? 'PUT' : 'POST',
+        body: JSON.stringify(body)
+      });
+      setEditing(null);
+      loadPersonas();
+    } catch (err) {
+      setError('Failed to save persona: ' + err.message);
+    }
+  };
+
+  const handleDelete = async (id) => {
+    try {
+      await request(`${API_BASE_URL}/api/chat/personas/${id}`, { method: 'DELETE' });
+      setPersonas(personas.filter(p => p.id !== id));
+    } catch (err) {
+      setError('Failed to delete persona: ' + err.message);
+    }
+  };
+
+  return (
+    <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
+      <Typography variant="h6" gutterBottom>
+        Personas
+      </Typography>
+      <Divider sx={{ mb: 2 }} />
+
+      <Typography variant="body1" paragraph>
+        A persona gives new chats a role, such as a Socratic tutor or a code reviewer, with its own
+        instructions, default model and starter prompts. Choose a persona before creating a chat.
+      </Typography>
+
+      {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+      {personas.length > 0 && (
+        <Table size="small" sx={{ mb: 2 }}>
+          <TableHead>
+            <TableRow>
+              <TableCell>Name</TableCell>
+              <TableCell>Description</TableCell>
+              <TableCell>Model</TableCell>
+              <TableCell>Shared</TableCell>
+              <TableCell />
+            </TableRow>
+          </TableHead>
+          <TableBody>
+            {personas.map(persona => (
+              <TableRow key={persona.id}>
+                <TableCell>{persona.name}</TableCell>
+                <TableCell>{persona.description}</TableCell>
+                <TableCell>{persona.model || 'Default'}</TableCell>
+                <TableCell>{persona.global ? 'All users' : 'Only me'}</TableCell>
+                <TableCell>
+                  {persona.editable && (
+                    <>
+                      <IconButton aria-label="edit persona" onClick={() => openDialog(persona)}>
+                        <EditIcon />
+                      </IconButton>
+                      <IconButton aria-label="delete persona" onClick={() => handleDelete(persona.id)}>
+                        <DeleteIcon />
+                      </IconButton>
+                    </>
+                  )}
+                </TableCell>
+              </TableRow>
+            ))}
+          </TableBody>
+        </Table>
+      )}
+
+      <Button variant="contained" startIcon={<AddIcon />} onClick={() => openDialog(null)}>
+        Create Persona
+      </Button>
+
+      <Dialog open={editing !== null} onClose={() => setEditing(null)} maxWidth="sm" fullWidth>
+        <DialogTitle>{editing ? 'Edit Persona' : 'Create Persona'}</DialogTitle>
+        <DialogContent>
+          <TextField margin="dense" label="Name" fullWidth value={form.name} onChange={setField('name')} />
+          <TextField margin="dense" label="Description" fullWidth value={form.description} onChange={setField('description')} />
+          <TextField
+            margin="dense"
+            label="Instructions"
+            fullWidth
+            multiline
+            minRows={4}
+            value={form.instructions}
+            onChange={setField('instructions')}
+            helperText="Added to the system prompt of every reply in chats using this persona"
+          />
+          <TextField
+            margin="dense"
+            label="Default model (optional)"
+            fullWidth
+            value={form.model}
+            onChange={setField('model')}
+            placeholder="gpt-4o"
+          />
+          <TextField
+            margin="dense"
+            label="Temperature (optional, 0-2)"
+            type="number"
+            inputProps={{ min: 0, max: 2, step: 0.1 }}
+            fullWidth
+            value={form.temperature}
+            onChange={setField('temperature')}
+          />
+          <TextField
+            margin="dense"
+            label="Starter prompts (one per line)"
+            fullWidth
+            multiline
+            minRows={3}
+            value={form.starter_prompts}
+            onChange={setField('starter_prompts')}
+          />
+          <FormControlLabel
+            control={<Checkbox checked={form.global} onChange={setField('global')} />}
+            label="Share with all users (administrators only)"
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setEditing(null)}>Cancel</Button>
+          <Button variant="contained" onClick={handleSave} disabled={!form.name.trim() || !form.instructions.trim()}>
+            Save
+          </Button>
+        </DialogActions>
+      </Dialog>
+    </Paper>
+  );
+};
+
+export default PersonasSection;
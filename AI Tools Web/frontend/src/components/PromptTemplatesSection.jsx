@@ -0,0 +1,169 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Typography,
+  Paper,
+  Button,
+  Divider,
+  Alert,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogTitle,
+  TextField,
+  FormControlLabel,
+  Checkbox,
+  IconButton,
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableRow
+} from '@mui/material';
+import DeleteIcon from '@mui/icons-material/Delete';
+import EditIcon from '@mui/icons-material/Edit';
+import AddIcon from '@mui/icons-material/Add';
+import request from '../utils/request';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const emptyForm = { name: '', description: '', content: '', global: false };
+
+// 提示模板管理，模板中的 {{变量}} 在聊天中发送时填写
+const PromptTemplatesSection = () => {
+  const [templates, setTemplates] = useState([]);
+  const [error, setError] = useState(null);
+  const [editing, setEditing] = useState(null); // null 表示对话框关闭，'' 表示新建
+  const [form, setForm] = useState(emptyForm);
+
+  const loadTemplates = async () => {
+    try {
+      const data = await request(`${API_BASE_URL}/api/chat/templates`);
+      setTemplates(data || []);
+    } catch (err) {
+      setError('Failed to load prompt templates: ' + err.message);
+    }
+  };
+
+  useEffect(() => {
+    loadTemplates();
+  }, []);
+
+  const openDialog = (template) => {
+    setForm(template ? {
+      name: template.name,
+      description: template.description || '',
+      content: template.content,
+      global: template.global
+    } : emptyForm);
+    setEditing(template ? template.id : '');
+  };
+
+  const setField = (field) => (e) => setForm({ ...form, [field]: e.target.type === 'checkbox' ? e.target.checked : e.target.value });
+
+  const handleSave = async () => {
+    setError(null);
+    try {
+      await request(editing ? `${API_BASE_URL}/api/chat/templates/${editing}` : `${API_BASE_URL}/api/chat/templates`, {
+        method: editing ? 'PUT' : 'POST',
+        body: JSON.stringify(form)
+      });
+      setEditing(null);
+      loadTemplates();
+    } catch (err) {
+      setError('Failed to save prompt template: ' + err.message);
+    }
+  };
+
+  const handleDelete = async (id) => {
+    try {
+      await request(`${API_BASE_URL}/api/chat/templates/${id}`, { method: 'DELETE' });
+      setTemplates(templates.filter(t => t.id !== id));
+    } catch (err) {
+      setError('Failed to delete prompt template: ' + err.message);
+    }
+  };
+
+  return (
+    <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
+      <Typography variant="h6" gutterBottom>
+        Prompt Templates
+      </Typography>
+      <Divider sx={{ mb: 2 }} />
+
+      <Typography variant="body1" paragraph>
+        Reusable prompts with variables written as <code>{'{{topic}}'}</code>. Pick a template under the chat
+        input and fill in the variables before sending.
+      </Typography>
+
+      {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+      {templates.length > 0 && (
+        <Table size="small" sx={{ mb: 2 }}>
+          <TableHead>
+            <TableRow>
+              <TableCell>Name</TableCell>
+              <TableCell>Variables</TableCell>
+              <TableCell>Shared</TableCell>
+              <TableCell />
+            </TableRow>
+          </TableHead>
+          <TableBody>
+            {templates.map(template => (
+              <TableRow key={template.id}>
+                <TableCell>{template.name}</TableCell>
+                <TableCell>{template.variables.join(', ') || '—'}</TableCell>
+                <TableCell>{template.global ? 'All users' : 'Only me'}</TableCell>
+                <TableCell>
+                  {template.editable && (
+                    <>
+                      <IconButton aria-label="edit prompt template" onClick={() => openDialog(template)}>
+                        <EditIcon />
+                      </IconButton>
+                      <IconButton aria-label="delete prompt template" onClick={() => handleDelete(template.id)}>
+                        <DeleteIcon />
+                      </IconButton>
+                    </>
+                  )}
+                </TableCell>
+              </TableRow>
+            ))}
+          </TableBody>
+        </Table>
+      )}
+
+      <Button variant="contained" startIcon={<AddIcon />} onClick={() => openDialog(null)}>
+        Create Template
+      </Button>
+
+      <Dialog open={editing !== null} onClose={() => setEditing(null)} maxWidth="sm" fullWidth>
+        <DialogTitle>{editing ? 'Edit Prompt Template' : 'Create Prompt Template'}</DialogTitle>
+        <DialogContent>
+          <TextField margin="dense" label="Name" fullWidth value={form.name} onChange={setField('name')} />
+          <TextField margin="dense" label="Description" fullWidth value={form.description} onChange={setField('description')} />
+          <TextField
+            margin="dense"
+            label="Content"
+            fullWidth
+            multiline
+            minRows={5}
+            value={form.content}
+            onChange={setField('content')}
+            placeholder={'Explain {{topic}} to a {{level}} student with one worked example.'}
+          />
+          <FormControlLabel
+            control={<Checkbox checked={form.global} onChange={setField('global')} />}
+            label="Share with all users (administrators only)"
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setEditing(null)}>Cancel</Button>
+          <Button variant="contained" onClick={handleSave} disabled={!form.name.trim() || !form.content.trim()}>
+            Save
+          </Button>
+        </DialogActions>
+      </Dialog>
+    </Paper>
+  );
+};
+
+export default PromptTemplatesSection;
@@ -0,0 +1,90 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Typography,
+  Paper,
+  Divider,
+  Alert,
+  IconButton,
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableRow
+} from '@mui/material';
+import DeleteIcon from '@mui/icons-material/Delete';
+import request from '../utils/request';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const formatDate = (value) => (value ? new Date(value).toLocaleString() : '—');
+
+// 聊天分享链接管理，撤销后链接立即失效
+const SharesSection = () => {
+  const [shares, setShares] = useState([]);
+  const [error, setError] = useState(null);
+
+  useEffect(() => {
+    request(`${API_BASE_URL}/api/chat/shares`)
+      .then(data => setShares(data || []))
+      .catch(err => setError('Failed to load share links: ' + err.message));
+  }, []);
+
+  const handleRevoke = async (id) => {
+    try {
+      await request(`${API_BASE_URL}/api/chat/shares/${id}`, { method: 'DELETE' });
+      setShares(shares.filter(s => s.id !== id));
+    } catch (err) {
+      setError('Failed to revoke share link: ' + err.message);
+    }
+  };
+
+  return (
+    <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
+      <Typography variant="h6" gutterBottom>
+        Shared Chats
+      </Typography>
+      <Divider sx={{ mb: 2 }} />
+
+      <Typography variant="body1" paragraph>
+        Anyone with a share link can read the snapshot of the chat taken when the link was created.
+      </Typography>
+
+      {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+      {shares.length > 0 ? (
+        <Table size="small">
+          <TableHead>
+            <TableRow>
+              <TableCell>Chat</TableCell>
+              <TableCell>Link</TableCell>
+              <TableCell>Messages</TableCell>
+              <TableCell>Created</TableCell>
+              <TableCell>Expires</TableCell>
+              <TableCell />
+            </TableRow>
+          </TableHead>
+          <TableBody>
+            {shares.map(share => (
+              <TableRow key={share.id}>
+                <TableCell>{share.title}</TableCell>
+                <TableCell><code>{share.prefix}…</code></TableCell>
+                <TableCell>{share.message_count}</TableCell>
+                <TableCell>{formatDate(share.created_at)}</TableCell>
+                <TableCell>{share.expires_at ? formatDate(share.expires_at) : 'Never'}</TableCell>
+                <TableCell>
+                  <IconButton aria-label="revoke share link" onClick={() => handleRevoke(share.id)}>
+                    <DeleteIcon />
+                  </IconButton>
+                </TableCell>
+              </TableRow>
+            ))}
+          </TableBody>
+        </Table>
+      ) : (
+        <Typography variant="body2" color="text.secondary">You have not shared any chats.</Typography>
+      )}
+    </Paper>
+  );
+};
+
+export default SharesSection;
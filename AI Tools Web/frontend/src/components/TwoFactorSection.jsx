@@ -0,0 +1,156 @@
+import React, { useEffect, useState } from 'react';
+import {
+  Box,
+  Typography,
+  Paper,
+  Button,
+  Divider,
+  Alert,
+  TextField
+} from '@mui/material';
+import { QRCode } from 'antd';
+import SecurityIcon from '@mui/icons-material/Security';
+import request from '../utils/request';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+// 两步验证设置：扫码绑定认证器、确认验证码、保存恢复码、关闭
+const TwoFactorSection = () => {
+  const [status, setStatus] = useState(null);
+  const [setup, setSetup] = useState(null);
+  const [code, setCode] = useState('');
+  const [password, setPassword] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState(null);
+  const [error, setError] = useState(null);
+
+  const loadStatus = async () => {
+    try {
+      setStatus(await request(`${API_BASE_URL}/api/user/2fa`));
+    } catch (err) {
+      setError('Failed to load two-factor status: ' + err.message);
+    }
+  };
+
+  useEffect(() => {
+    loadStatus();
+  }, []);
+
+  const call = async (path, body) => {
+    setError(null);
+    try {
+      return await request(`${API_BASE_URL}/api/user/2fa${path}`, {
+        method: 'POST',
+        body: JSON.stringify(body || {})
+      });
+    } catch (err) {
+      setError(err.message);
+      return null;
+    }
+  };
+
+  const handleStart = async () => {
+    const data = await call('/setup');
+    if (data) {
+      setSetup(data);
+      setCode('');
+    }
+  };
+
+  const handleEnable = async () => {
+    const data = await call('/enable', { code });
+    if (data) {
+      setSetup(null);
+      setCode('');
+      setRecoveryCodes(data.recovery_codes);
+      loadStatus();
+    }
+  };
+
+  const handleDisable = async () => {
+    const isRecoveryCode = code.includes('-') || code.length > 6;
+    const data = await call('/disable', isRecoveryCode ? { password, recovery_code: code } : { password, code });
+    if (data) {
+      setCode('');
+      setPassword('');
+      setRecoveryCodes(null);
+      loadStatus();
+    }
+  };
+
+  const handleRegenerate = async () => {
+    const data = await call('/recovery-codes', { code });
+    if (data) {
+      setCode('');
+      setRecoveryCodes(data.recovery_codes);
+      loadStatus();
+    }
+  };
+
+  return (
+    <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
+      <Typography variant="h6" gutterBottom>
+        Two-Factor Authentication
+      </Typography>
+      <Divider sx={{ mb: 2 }} />
+
+      {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+      {recoveryCodes && (
+        <Alert severity="warning" sx={{ mb: 2 }} onClose={() => setRecoveryCodes(null)}>
+          Save these recovery codes somewhere safe. Each code can be used once if you lose access to your authenticator app:
+          <Box component="pre" sx={{ mt: 1, mb: 0 }}>{recoveryCodes.join('\n')}</Box>
+        </Alert>
+      )}
+
+      {status && !status.enabled && !setup && (
+        <>
+          <Typography variant="body1" paragraph>
+            Protect your account with a code from an authenticator app such as Google Authenticator or Microsoft Authenticator.
+          </Typography>
+          <Button variant="contained" startIcon={<SecurityIcon />} onClick={handleStart}>
+            Enable Two-Factor Authentication
+          </Button>
+        </>
+      )}
+
+      {setup && (
+        <Box>
+          <Typography variant="body1" paragraph>
+            Scan the QR code with your authenticator app, then enter the 6-digit code it shows.
+          </Typography>
+          <QRCode value={setup.provisioning_uri} style={{ marginBottom: 16 }} />
+          <Typography variant="body2" sx={{ mb: 2 }}>
+            Or enter this key manually: <code>{setup.secret}</code>
+          </Typography>
+          <TextField label="Verification code" value={code} onChange={(e) => setCode(e.target.value)} size="small" sx={{ mr: 2 }} />
+          <Button variant="contained" onClick={handleEnable} disabled={code.length < 6}>
+            Confirm
+          </Button>
+          <Button onClick={() => setSetup(null)} sx={{ ml: 1 }}>
+            Cancel
+          </Button>
+        </Box>
+      )}
+
+      {status && status.enabled && (
+        <Box>
+          <Typography variant="body1" paragraph>
+            Two-factor authentication is enabled. Recovery codes remaining: {status.recovery_codes_remaining}.
+          </Typography>
+          <Box sx={{ display: 'flex', gap: 2, flexWrap: 'wrap', mb: 2 }}>
+            <TextField label="Code or recovery code" value={code} onChange={(e) => setCode(e.target.value)} size="small" />
+            <TextField label="Password" type="password" value={password} onChange={(e) => setPassword(e.target.value)} size="small" />
+          </Box>
+          <Button variant="outlined" onClick={handleRegenerate} disabled={!code} sx={{ mr: 2 }}>
+            New Recovery Codes
+          </Button>
+          <Button variant="contained" color="error" onClick={handleDisable} disabled={!code}>
+            Disable
+          </Button>
+        </Box>
+      )}
+    </Paper>
+  );
+};
+
+export default TwoFactorSection;
@@ -1,6 +1,6 @@
 import React, { useState, useEffect, useRef } from 'react';
-import { Layout, Input, Button, Select, List, Avatar, message, Spin, Typography, Modal } from 'antd';
-import { SendOutlined, PlusOutlined, EditOutlined, DeleteOutlined, UserOutlined, RobotOutlined } from '@ant-design/icons';
+import { Layout, Input, Button, Select, List, Avatar, message, Spin, Typography, Modal, Dropdown } from 'antd';
+import { SendOutlined, PlusOutlined, EditOutlined, DeleteOutlined, UserOutlined, RobotOutlined, StopOutlined, DownloadOutlined, UploadOutlined, ShareAltOutlined, PaperClipOutlined, FileTextOutlined, CloseOutlined } from '@ant-design/icons';
 import request from '../utils/request';
 import dayjs from 'dayjs';
 import ReactMarkdown from 'react-markdown';
@@ -12,6 +12,8 @@ const { TextArea } = Input;
 const { Title, Text } = Typography;
 
 const API_BASE_URL = 'http://localhost:8080';
+// 打开聊天时加载的消息数
+const MESSAGE_PAGE_SIZE = 50;
 
 // Add inline styles
 const typingIndicatorStyle = `
@@ -150,6 +152,53 @@ const typingIndicatorStyle = `
 }
 `;
 
+// 在界面上预览填充后的提示模板，实际内容由服务器填充
+const fillTemplate = (content, values) =>
+    content.replace(/\{\{\s*([\p{L}_][\p{L}\p{N}_]*)\s*\}\}/gu, (match, name) => values[name] ?? match);
+
+// 附件的图片需要带上令牌读取，转换为 object URL 显示
+const AttachmentImage = ({ attachment }) => {
+    const [src, setSrc] = useState('');
+
+    useEffect(() => {
+        let url = '';
+        fetch(`${API_BASE_URL}/api/chat/attachments/${attachment.id}`, {
+            headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+        })
+            .then(response => (response.ok ? response.blob() : Promise.reject(new Error(response.statusText))))
+            .then(blob => {
+                url = URL.createObjectURL(blob);
+                setSrc(url);
+            })
+            .catch(err => console.error('Error loading attachment:', err));
+        return () => url && URL.revokeObjectURL(url);
+    }, [attachment.id]);
+
+    if (!src) {
+        return <Spin size="small" />;
+    }
+    return (
+        <a href={src} target="_blank" rel="noreferrer">
+            <img src={src} alt={attachment.filename} style={{ maxWidth: '240px', maxHeight: '240px', borderRadius: '4px' }} />
+        </a>
+    );
+};
+
+// 消息中的附件：图片显示缩略图，文本文件显示文件名
+const MessageAttachments = ({ attachments }) => (
+    <div style={{ display: 'flex', flexWrap: 'wrap', gap: '8px', marginBottom: '6px' }}>
+        {attachments.map(attachment => (
+            attachment.kind === 'image'
+                ? <AttachmentImage key={attachment.id} attachment={attachment} />
+                : (
+                    <span key={attachment.id} style={{ color: '#666', fontSize: '12px' }}>
+                        <FileTextOutlined /> {attachment.filename}
+                    </span>
+                )
+        ))}
+    </div>
+);
+
 const ChatPage = () => {
     const navigate = useNavigate();
     const [selectedModel, setSelectedModel] = useState('gpt-4o');
@@ -174,8 +223,31 @@ const ChatPage = () => {
     });
     // 添加新的状态
     const [availableModels, setAvailableModels] = useState([]);
+    // 当前聊天更早一页消息的游标，为空表示已经加载了全部消息
+    const [olderCursor, setOlderCursor] = useState('');
+    const [loadingOlder, setLoadingOlder] = useState(false);
+    // 在顶部插入更早的消息时不滚动到底部
+    const skipScrollRef = useRef(false);
+    // 聊天记录搜索，searchResults 为 null 时显示聊天列表
+    const [searchQuery, setSearchQuery] = useState('');
+    const [searchResults, setSearchResults] = useState(null);
+    const [searchLoading, setSearchLoading] = useState(false);
     // 只保留聊天历史列表的ref
     const chatHistoryListRef = useRef(null);
+    // 导入聊天的文件选择框
+    const importInputRef = useRef(null);
+    // 已上传、将随下一条消息发送的附件
+    const [pendingAttachments, setPendingAttachments] = useState([]);
+    const [uploadingAttachment, setUploadingAttachment] = useState(false);
+    const attachmentInputRef = useRef(null);
+    // 助手角色：新聊天使用 selectedPersonaId，currentPersonaId 是当前聊天的角色
+    const [personas, setPersonas] = useState([]);
+    const [selectedPersonaId, setSelectedPersonaId] = useState(null);
+    const [currentPersonaId, setCurrentPersonaId] = useState(null);
+    // 提示模板及其变量的值，随下一条消息发送
+    const [templates, setTemplates] = useState([]);
+    const [selectedTemplateId, setSelectedTemplateId] = useState(null);
+    const [templateValues, setTemplateValues] = useState({});
 
     // Listen for language preference changes, save to localStorage
     useEffect(() => {
@@ -191,6 +263,10 @@ const ChatPage = () => {
     };
 
     useEffect(() => {
+        if (skipScrollRef.current) {
+            skipScrollRef.current = false;
+            return;
+        }
         scrollToBottom();
     }, [currentChat]);
 
@@ -220,6 +296,34 @@ const ChatPage = () => {
         init();
     }, []);
 
+    // 搜索所有聊天中的消息，page 大于 1 时追加到已有结果后面
+    const handleSearch = async (query, page = 1) => {
+        const q = query.trim();
+        if (!q) {
+            setSearchResults(null);
+            return;
+        }
+        setSearchLoading(true);
+        try {
+            const params = new URLSearchParams({ q, page: String(page) });
+            const data = await request(`${API_BASE_URL}/api/chat/search?${params.toString()}`);
+            setSearchResults(prev => ({
+                ...data,
+                results: page > 1 && prev ? [...prev.results, ...data.results] : data.results
+            }));
+        } catch (err) {
+            console.error('Error searching chats:', err);
+            message.error('Search failed');
+        } finally {
+            setSearchLoading(false);
+        }
+    };
+
+    const clearSearch = () => {
+        setSearchQuery('');
+        setSearchResults(null);
+    };
+
     const fetchChatHistory = async () => {
         try {
             const history = await request(`${API_BASE_URL}/api/chat/history`);
@@ -253,6 +357,24 @@ const ChatPage = () => {
         }
     };
     
+    // 加载当前聊天更早的一页消息，插入到列表顶部
+    const loadEarlierMessages = async () => {
+        if (!currentChatId || !olderCursor) return;
+        setLoadingOlder(true);
+        try {
+            const params = new URLSearchParams({ limit: String(MESSAGE_PAGE_SIZE), before: olderCursor });
+            const page = await request(`${API_BASE_URL}/api/chat/${currentChatId}/messages?${params.toString()}`);
+            skipScrollRef.current = true;
+            setCurrentChat(prev => [...(page.messages || []), ...prev]);
+            setOlderCursor(page.next_cursor || '');
+        } catch (err) {
+            console.error('Error loading earlier messages:', err);
+            message.error('Failed to load earlier messages');
+        } finally {
+            setLoadingOlder(false);
+        }
+    };
+
     // 修改fetchChatMessages函数，增加错误处理和日志记录
     const fetchChatMessages = async (chatId) => {
         if (!chatId) {
@@ -262,9 +384,11 @@ const ChatPage = () => {
         
         try {
             setLoading(true);
+            setOlderCursor('');
             console.log(`Fetching messages for chat ID: ${chatId}`);
             
-            const response = await request(`${API_BASE_URL}/api/chat/${chatId}/messages`);
+            // 只加载最近的一页，更早的消息通过 olderCursor 按需加载
+            const response = await request(`${API_BASE_URL}/api/chat/${chatId}/messages?limit=${MESSAGE_PAGE_SIZE}`);
             
             // 检查响应是否为null，如果是则视为空数组
             if (response === null) {
@@ -278,20 +402,25 @@ const ChatPage = () => {
                 return;
             }
             
+            // 分页接口返回 { messages, next_cursor }
+            const messages = response.messages;
+            
             // 确保messages是数组，即使是空数组
-            if (Array.isArray(response)) {
-                console.log(`Received ${response.length} messages for chat ID: ${chatId}`);
-                setCurrentChat(response);
+            if (Array.isArray(messages)) {
+                console.log(`Received ${messages.length} messages for chat ID: ${chatId}`);
+                setCurrentChat(messages);
+                setOlderCursor(response.next_cursor || '');
                 setCurrentChatId(chatId);
                 localStorage.setItem('currentChatId', chatId);
                 
                 // 检查是否有消息，如果有，则锁定模型
-                if (response.length > 0) {
+                if (messages.length > 0) {
                     setModelLocked(true);
                     
                     // 获取聊天信息以检索使用的模型
                     try {
                         const chatInfo = await request(`${API_BASE_URL}/api/chat/${chatId}/info`);
+                        setCurrentPersonaId(chatInfo?.persona_id || null);
                         if (chatInfo && chatInfo.model) {
                             setSelectedModel(chatInfo.model);
                             setCurrentChatModel(chatInfo.model);
@@ -307,6 +436,10 @@ const ChatPage = () => {
                     setModelLocked(false);
                     // 对于空聊天，允许用户选择模型
                     setCurrentChatModel('');
+                    // 空聊天显示角色的示例问题
+                    request(`${API_BASE_URL}/api/chat/${chatId}/info`)
+                        .then(chatInfo => setCurrentPersonaId(chatInfo?.persona_id || null))
+                        .catch(err => console.error('Error fetching chat info:', err));
                 }
             } else {
                 console.error('Received non-array response for messages:', response);
@@ -370,7 +503,9 @@ const ChatPage = () => {
                 throw new Error('创建聊天超时');
             }, 10000); // 10秒超时
             
-            const response = await request.post(`${API_BASE_URL}/api/chat/new`);
+            // 从选择的角色创建聊天，角色设置了模型时使用角色的模型
+            const persona = personas.find(p => p.id === selectedPersonaId);
+            const response = await request.post(`${API_BASE_URL}/api/chat/new`, persona ? { persona_id: persona.id } : {});
             
             // 清除超时计时器
             clearTimeout(timeoutId);
@@ -386,11 +521,16 @@ const ChatPage = () => {
                 setCurrentChatId(newChatId);
                 localStorage.setItem('currentChatId', newChatId);
                 setCurrentChat([]);
+                setOlderCursor('');
                 setInputMessage('');
                 
                 // 创建新聊天时解锁模型选择
                 setModelLocked(false);
                 setCurrentChatModel('');
+                setCurrentPersonaId(response.persona_id || null);
+                if (response.persona_id && response.model) {
+                    setSelectedModel(response.model);
+                }
                 
                 await fetchChatHistory();
                 return newChatId; // 返回新创建的聊天ID
@@ -432,11 +572,59 @@ const ChatPage = () => {
         }
     };
 
+    // 停止当前聊天正在生成的回复，已生成的部分由后端保存
+    const handleStop = async () => {
+        if (!currentChatId) return;
+        try {
+            await request.post(`${API_BASE_URL}/api/chat/${currentChatId}/stop`);
+        } catch (err) {
+            console.error('Error stopping generation:', err);
+        }
+    };
+
+    // 上传附件，发送消息时通过 attachments 参数引用
+    const handleAttachmentSelect = async (event) => {
+        const files = Array.from(event.target.files);
+        event.target.value = '';
+        setUploadingAttachment(true);
+        for (const file of files) {
+            try {
+                const form = new FormData();
+                form.append('file', file);
+                const response = await fetch(`${API_BASE_URL}/api/chat/attachments`, {
+                    method: 'POST',
+                    headers: { Authorization: `Bearer ${localStorage.getItem('token')}` },
+                    body: form
+                });
+                if (!response.ok) {
+                    throw new Error((await response.text()).trim() || response.statusText);
+                }
+                const attachment = await response.json();
+                setPendingAttachments(prev => [...prev, attachment]);
+            } catch (err) {
+                console.error('Error uploading attachment:', err);
+                message.error(`Failed to upload ${file.name}: ${err.message}`);
+            }
+        }
+        setUploadingAttachment(false);
+    };
+
+    const selectedTemplate = templates.find(t => t.id === selectedTemplateId);
+    const currentPersona = personas.find(p => p.id === currentPersonaId);
+
     const handleSend = async () => {
-        if (!inputMessage.trim()) return;
+        if (!inputMessage.trim() && pendingAttachments.length === 0 && !selectedTemplate) return;
+        if (selectedTemplate) {
+            const missing = selectedTemplate.variables.filter(name => !(templateValues[name] || '').trim());
+            if (missing.length > 0) {
+                message.warning(`Please fill in: ${missing.join(', ')}`);
+                return;
+            }
+        }
         
-        // 存储原始消息，以便在出错时恢复
+        // 存储原始消息和附件，以便在出错时恢复
         const originalMessage = inputMessage;
+        const attachments = pendingAttachments;
         
         // 检查是否已经在加载中，防止重复发送
         if (loading) {
@@ -471,15 +659,7 @@ const ChatPage = () => {
             
             setCurrentChat(prev => [...prev, systemResponse]);
             
-            // Save messages to database
-            if (currentChatId) {
-                try {
-                    await request.post(`${API_BASE_URL}/api/chat/${currentChatId}/messages`, { content: inputMessage });
-                    await saveAIMessage(currentChatId, systemResponse.content);
-                } catch (err) {
-                    console.error('Error saving language preference messages:', err);
-                }
-            }
+            // 语言切换的确认只在界面上显示，不保存到聊天记录
             
             // Scroll to bottom
             setTimeout(scrollToBottom, 100);
@@ -509,15 +689,7 @@ const ChatPage = () => {
             
             setCurrentChat(prev => [...prev, systemResponse]);
             
-            // Save messages to database
-            if (currentChatId) {
-                try {
-                    await request.post(`${API_BASE_URL}/api/chat/${currentChatId}/messages`, { content: inputMessage });
-                    await saveAIMessage(currentChatId, systemResponse.content);
-                } catch (err) {
-                    console.error('Error saving language preference messages:', err);
-                }
-            }
+            // 语言切换的确认只在界面上显示，不保存到聊天记录
             
             // Scroll to bottom
             setTimeout(scrollToBottom, 100);
@@ -559,15 +731,28 @@ const ChatPage = () => {
             }
         }
 
-        // Add user message to UI
+        // Add user message to UI，使用模板时显示填充后的内容
+        const template = selectedTemplate;
+        const variables = templateValues;
+        let displayContent = inputMessage;
+        if (template) {
+            displayContent = fillTemplate(template.content, variables);
+            if (inputMessage.trim()) {
+                displayContent += '\n\n' + inputMessage.trim();
+            }
+        }
         const userMessage = {
             role: 'user',
-            content: inputMessage,
+            content: displayContent,
+            attachments,
             timestamp: new Date().toISOString()
         };
         
         setCurrentChat(prev => [...prev, userMessage]);
         setInputMessage('');
+        setPendingAttachments([]);
+        setSelectedTemplateId(null);
+        setTemplateValues({});
         
         // Add an empty AI message for streaming updates
         const aiMessageId = Date.now().toString();
@@ -605,6 +790,14 @@ const ChatPage = () => {
             params.append('model', selectedModel);
             // Add language preference parameter
             params.append('language', languagePreference);
+            if (attachments.length > 0) {
+                params.append('attachments', attachments.map(a => a.id).join(','));
+            }
+            // 模板由服务器填充，变量以 var.<name> 传递
+            if (template) {
+                params.append('template_id', template.id);
+                template.variables.forEach(name => params.append(`var.${name}`, variables[name]));
+            }
             
             // Create EventSource connection
             const eventSourceUrl = `${API_BASE_URL}/api/chat/${chatId}/messages/stream?${params.toString()}`;
@@ -628,18 +821,59 @@ const ChatPage = () => {
                 clearTimeout(loadingTimeoutId);
                 
                 if (!response.ok) {
+                    // 附件无效或模型不支持图片时返回 400 和原因
+                    const reason = (await response.text()).trim();
+                    if (response.status === 400 && reason) {
+                        throw Object.assign(new Error(reason), { rejected: true });
+                    }
                     throw new Error(`HTTP error! status: ${response.status}`);
                 }
                 
-                const reader = response.body.getReader();
+                let reader = response.body.getReader();
                 const decoder = new TextDecoder();
                 let buffer = '';
                 let fullResponse = '';
+                // 最后收到的事件 ID，连接中断时用它继续接收同一个回复
+                let lastEventId = '';
+                let reconnects = 0;
+                
+                // 连接中断后带上 last_event_id 重新连接，返回 false 表示回复已经无法继续接收
+                const reconnect = async () => {
+                    if (!lastEventId || reconnects >= 3) return false;
+                    reconnects++;
+                    await new Promise(resolve => setTimeout(resolve, 1000 * reconnects));
+                    const resumeResponse = await fetch(
+                        `${API_BASE_URL}/api/chat/${chatId}/messages/stream?last_event_id=${encodeURIComponent(lastEventId)}`,
+                        {
+                            headers: {
+                                'Accept': 'text/event-stream',
+                                'Authorization': `Bearer ${localStorage.getItem('token')}`
+                            }
+                        }
+                    );
+                    if (resumeResponse.status === 204) {
+                        // 回复已经生成完并保存，直接重新加载消息
+                        await fetchChatMessages(chatId);
+                        setLoading(false);
+                        return false;
+                    }
+                    if (!resumeResponse.ok) return false;
+                    reader = resumeResponse.body.getReader();
+                    buffer = '';
+                    return true;
+                };
                 
                 // Process streaming response
                 const processStream = async () => {
                     while (true) {
-                        const { value, done } = await reader.read();
+                        let value, done;
+                        try {
+                            ({ value, done } = await reader.read());
+                        } catch (readError) {
+                            console.warn('Stream interrupted, reconnecting:', readError);
+                            if (await reconnect()) continue;
+                            throw readError;
+                        }
                         
                         if (done) {
                             console.log('Stream complete');
@@ -658,12 +892,49 @@ const ChatPage = () => {
                         for (const line of lines) {
                             if (line.trim() === '') continue;
                             
-                            // Extract data portion
-                            const dataLine = line.replace(/^data: /, '').trim();
+                            // Extract event ID, event type and data portion
+                            let dataLine = '';
+                            let eventType = '';
+                            for (const field of line.split('\n')) {
+                                if (field.startsWith('id: ')) {
+                                    lastEventId = field.substring(4).trim();
+                                } else if (field.startsWith('event: ')) {
+                                    eventType = field.substring(7).trim();
+                                } else {
+                                    dataLine += field.replace(/^data: ?/, '');
+                                }
+                            }
+                            dataLine = dataLine.trim();
+                            
+                            if (eventType === 'title') {
+                                // 第一轮问答后后端自动生成的标题
+                                try {
+                                    const { title } = JSON.parse(dataLine);
+                                    setChatHistory(prev =>
+                                        prev.map(chat => chat.id === chatId ? { ...chat, title } : chat)
+                                    );
+                                } catch (e) {
+                                    console.warn('Invalid title event:', dataLine);
+                                }
+                                continue;
+                            }
+                            
+                            if (eventType === 'context') {
+                                // 较早的历史被摘要或省略，记录在这条回复上
+                                try {
+                                    const context = JSON.parse(dataLine);
+                                    setCurrentChat(prev =>
+                                        prev.map(msg => msg.id === aiMessageId ? { ...msg, context } : msg)
+                                    );
+                                } catch (e) {
+                                    console.warn('Invalid context event:', dataLine);
+                                }
+                                continue;
+                            }
                             
                             if (dataLine === '[DONE]') {
                                 // Stream ended
-                                console.log('Stream complete, saving response');
+                                console.log('Stream complete');
                                 
                                 // Update message state, remove isStreaming flag
                                 setCurrentChat(prev => 
@@ -674,20 +945,9 @@ const ChatPage = () => {
                                     )
                                 );
                                 
-                                // Save complete AI response to database
-                                if (fullResponse.trim()) {
-                                    console.log('Saving AI response:', fullResponse.substring(0, 100) + '...');
-                                    // 延迟50ms保存消息，确保Claude的完整响应能被处理
-                                    setTimeout(() => {
-                                        saveAIMessage(chatId, fullResponse);
-                                        console.log('AI response saved after delay for Claude model');
-                                    }, 50);
-                                } else {
-                                    console.warn('Empty response, not saving');
-                                }
-                                
+                                // 回复由后端在流结束时保存；继续读取到流关闭，之后可能还有标题事件
                                 setLoading(false);
-                                return;
+                                continue;
                             }
                             
                             if (dataLine.startsWith('ERROR:')) {
@@ -804,11 +1064,23 @@ const ChatPage = () => {
                 
             } catch (error) {
                 console.error('Error processing response stream:', error);
-                message.error('处理响应流时出错');
                 
                 // 在错误时清除超时计时器
                 clearTimeout(loadingTimeoutId);
                 
+                if (error.rejected) {
+                    // 请求被拒绝：恢复输入和附件，移除未发送的消息
+                    message.error(error.message);
+                    setInputMessage(originalMessage);
+                    setPendingAttachments(attachments);
+                    setSelectedTemplateId(template ? template.id : null);
+                    setTemplateValues(variables);
+                    setCurrentChat(prev => prev.filter(msg => msg !== userMessage && msg.id !== aiMessageId));
+                    setLoading(false);
+                    return;
+                }
+                message.error('处理响应流时出错');
+                
                 // 在出错时更新消息显示
                 setCurrentChat(prev => 
                     prev.map(msg => 
@@ -827,8 +1099,11 @@ const ChatPage = () => {
             // 在错误时清除超时计时器
             clearTimeout(loadingTimeoutId);
             
-            // 恢复输入框的消息，以便用户可以重试
+            // 恢复输入框的消息、附件和模板，以便用户可以重试
             setInputMessage(originalMessage);
+            setPendingAttachments(attachments);
+            setSelectedTemplateId(template ? template.id : null);
+            setTemplateValues(variables);
             
             // 移除失败的消息
             setCurrentChat(prev => prev.filter(msg => msg.id !== aiMessageId));
@@ -836,67 +1111,6 @@ const ChatPage = () => {
             setLoading(false); // 确保在出错时重置加载状态
         }
     };
-    
-    // Save AI response to database
-    const saveAIMessage = async (chatId, content) => {
-        if (!chatId || !content) {
-            console.error('Invalid chat ID or content');
-            return;
-        }
-        
-        try {
-            console.log('Saving AI message to chat ID:', chatId);
-            // Ensure using full URL
-            const url = `${API_BASE_URL}/api/chat/${chatId}/messages/ai`;
-            console.log('Request URL:', url);
-            
-            // 添加重试机制
-            let retryCount = 0;
-            const maxRetries = 3;
-            
-            const saveWithRetry = async () => {
-                try {
-                    // Use native fetch instead of request tool function
-                    const token = localStorage.getItem('token');
-                    const response = await fetch(url, {
-                        method: 'POST',
-                        headers: {
-                            'Content-Type': 'application/json',
-                            'Authorization': token ? `Bearer ${token}` : '',
-                        },
-                        body: JSON.stringify({ content })
-                    });
-                    
-                    if (!response.ok) {
-                        const errorText = await response.text();
-                        throw new Error(errorText || response.statusText);
-                    }
-                    
-                    console.log('AI message saved successfully');
-                } catch (err) {
-                    console.error(`Error saving AI response (attempt ${retryCount + 1}/${maxRetries}):`, err);
-                    
-                    if (retryCount < maxRetries - 1) {
-                        retryCount++;
-                        console.log(`Retrying save... (${retryCount}/${maxRetries})`);
-                        
-                        // 增加延迟时间，避免立即重试
-                        const delay = 500 * Math.pow(2, retryCount);
-                        await new Promise(resolve => setTimeout(resolve, delay));
-                        return await saveWithRetry();
-                    } else {
-                        message.error('保存AI回复失败，但不影响当前对话');
-                        throw err;
-                    }
-                }
-            };
-            
-            await saveWithRetry();
-        } catch (err) {
-            console.error('最终错误: 保存AI响应失败:', err);
-            message.error('无法保存AI回复，但不影响当前对话');
-        }
-    };
 
     const handleTitleEdit = async (chatId, newTitle) => {
         try {
@@ -921,6 +1135,90 @@ const ChatPage = () => {
         }
     };
 
+    // 下载导出文件，聊天 ID 为空时导出全部聊天的压缩包
+    const handleExport = async (chatId, format, filename) => {
+        try {
+            const url = chatId
+                ? `${API_BASE_URL}/api/chat/${chatId}/export?format=${format}`
+                : `${API_BASE_URL}/api/chat/export?format=${format}`;
+            const response = await fetch(url, {
+                headers: { Authorization: `Bearer ${localStorage.getItem('token')}` }
+            });
+            if (!response.ok) {
+                throw new Error((await response.text()).trim() || response.statusText);
+            }
+            const blob = await response.blob();
+            const link = document.createElement('a');
+            link.href = URL.createObjectURL(blob);
+            link.download = filename;
+            link.click();
+            URL.revokeObjectURL(link.href);
+        } catch (err) {
+            console.error('Error exporting chat:', err);
+            message.error('Failed to export: ' + err.message);
+        }
+    };
+
+    // 从 JSON 导出文件导入聊天
+    const handleImport = async (event) => {
+        const file = event.target.files[0];
+        event.target.value = '';
+        if (!file) return;
+        try {
+            const data = JSON.parse(await file.text());
+            const chat = await request.post(`${API_BASE_URL}/api/chat/import`, data);
+            await fetchChatHistory();
+            await fetchChatMessages(chat.id);
+            message.success('Chat imported successfully');
+        } catch (err) {
+            console.error('Error importing chat:', err);
+            message.error('Failed to import chat: ' + err.message);
+        }
+    };
+
+    // 创建分享链接并复制到剪贴板，链接只在创建时返回一次
+    const handleShareChat = (chatId) => {
+        let expiresInDays = 0;
+        Modal.confirm({
+            title: 'Share this chat',
+            content: (
+                <div>
+                    <p>Anyone with the link can view the conversation as it is now. Later messages are not shared.</p>
+                    <Select
+                        defaultValue={0}
+                        style={{ width: '100%' }}
+                        onChange={value => { expiresInDays = value; }}
+                        options={[
+                            { value: 0, label: 'Never expires' },
+                            { value: 1, label: 'Expires in 1 day' },
+                            { value: 7, label: 'Expires in 7 days' },
+                            { value: 30, label: 'Expires in 30 days' }
+                        ]}
+                    />
+                </div>
+            ),
+            okText: 'Create link',
+            onOk: async () => {
+                try {
+                    const data = await request.post(`${API_BASE_URL}/api/chat/${chatId}/shares`, { expires_in_days: expiresInDays });
+                    navigator.clipboard?.writeText(data.url).catch(() => {});
+                    Modal.info({
+                        title: 'Share link created',
+                        content: (
+                            <div>
+                                <p>Copy the link now, it will not be shown again. You can revoke it in Settings.</p>
+                                <Input value={data.url} readOnly onFocus={e => e.target.select()} />
+                            </div>
+                        )
+                    });
+                } catch (err) {
+                    console.error('Error sharing chat:', err);
+                    message.error('Failed to share chat: ' + err.message);
+                }
+            }
+        });
+    };
+
     // Add delete chat function
     const handleDeleteChat = async (chatId) => {
         try {
@@ -931,6 +1229,7 @@ const ChatPage = () => {
                 setCurrentChatId(null);
                 localStorage.removeItem('currentChatId');
                 setCurrentChat([]);
+                setOlderCursor('');
             }
             
             await fetchChatHistory();
@@ -952,6 +1251,17 @@ const ChatPage = () => {
     };
 
     // Render message content
+    // 回复生成时较早的历史被摘要或省略的提示
+    const contextNotice = (context) => {
+        if (context.summarized_messages > 0) {
+            return `Earlier ${context.summarized_messages} messages were summarized to fit the model's context window`;
+        }
+        if (context.omitted_messages > 0) {
+            return `Earlier ${context.omitted_messages} messages were omitted to fit the model's context window`;
+        }
+        return "This message may exceed the model's context window";
+    };
+
     const renderMessageContent = (message) => {
         if (message.role === 'assistant') {
             // If it's an AI message with empty content, show loading indicator
@@ -1083,9 +1393,24 @@ const ChatPage = () => {
         }
     };
 
-    // 在组件加载时获取可用模型
+    // 获取可用的角色和提示模板
+    const fetchPersonasAndTemplates = async () => {
+        try {
+            const [personaList, templateList] = await Promise.all([
+                request.get(`${API_BASE_URL}/api/chat/personas`),
+                request.get(`${API_BASE_URL}/api/chat/templates`)
+            ]);
+            setPersonas(personaList || []);
+            setTemplates(templateList || []);
+        } catch (error) {
+            console.error('Error fetching personas and templates:', error);
+        }
+    };
+
+    // 在组件加载时获取可用模型、角色和模板
     useEffect(() => {
         fetchAvailableModels();
+        fetchPersonasAndTemplates();
     }, []);
 
     // 添加函数让当前选中的聊天记录保持可见
@@ -1149,6 +1474,16 @@ const ChatPage = () => {
                         ]}
                     />
                     
+                    {/* 新聊天使用的助手角色 */}
+                    <Select
+                        value={selectedPersonaId}
+                        onChange={setSelectedPersonaId}
+                        placeholder="No persona"
+                        allowClear
+                        style={{ width: '100%', marginBottom: '10px' }}
+                        options={personas.map(p => ({ value: p.id, label: p.global ? `${p.name} (shared)` : p.name }))}
+                    />
+                    
                     <Button 
                         type="primary" 
                         icon={<PlusOutlined />} 
@@ -1158,6 +1493,43 @@ const ChatPage = () => {
                     >
                         New Chat
                     </Button>
+                    
+                    <Input.Search
+                        placeholder="Search chats"
+                        value={searchQuery}
+                        onChange={e => {
+                            setSearchQuery(e.target.value);
+                            if (!e.target.value) setSearchResults(null);
+                        }}
+                        onSearch={value => handleSearch(value)}
+                        loading={searchLoading}
+                        allowClear
+                        style={{ marginTop: '10px' }}
+                    />
+                    
+                    <div style={{ display: 'flex', gap: '8px', marginTop: '10px' }}>
+                        <Button
+                            icon={<DownloadOutlined />}
+                            style={{ flex: 1 }}
+                            onClick={() => handleExport(null, 'json', `chats-${dayjs().format('YYYYMMDD')}.zip`)}
+                        >
+                            Export all
+                        </Button>
+                        <Button
+                            icon={<UploadOutlined />}
+                            style={{ flex: 1 }}
+                            onClick={() => importInputRef.current?.click()}
+                        >
+                            Import
+                        </Button>
+                        <input
+                            type="file"
+                            accept="application/json,.json"
+                            ref={importInputRef}
+                            style={{ display: 'none' }}
+                            onChange={handleImport}
+                        />
+                    </div>
                 </div>
                 
                 {/* 可滚动的聊天列表区域 */}
@@ -1172,7 +1544,47 @@ const ChatPage = () => {
                         position: 'relative'
                     }}
                 >
-                    {chatHistory.length > 0 ? (
+                    {searchResults ? (
+                        <List
+                            dataSource={searchResults.results}
+                            locale={{ emptyText: '没有找到匹配的消息' }}
+                            renderItem={result => (
+                                <List.Item
+                                    key={result.message_id}
+                                    onClick={() => {
+                                        clearSearch();
+                                        fetchChatMessages(result.chat_id);
+                                    }}
+                                    style={{ cursor: 'pointer', padding: '10px 20px', display: 'block' }}
+                                >
+                                    <div style={{ display: 'flex', justifyContent: 'space-between', fontWeight: 500 }}>
+                                        <span style={{ overflow: 'hidden', textOverflow: 'ellipsis', whiteSpace: 'nowrap' }}>
+                                            {result.chat_title || 'New Chat'}
+                                        </span>
+                                        <span style={{ color: '#999', fontSize: '12px', fontWeight: 'normal', marginLeft: '10px' }}>
+                                            {dayjs(result.created_at).format('MM-DD HH:mm')}
+                                        </span>
+                                    </div>
+                                    <div style={{ color: '#666', fontSize: '12px', marginTop: '4px' }}>
+                                        {result.snippet.map((part, i) =>
+                                            part.match ? <mark key={i}>{part.text}</mark> : <span key={i}>{part.text}</span>
+                                        )}
+                                    </div>
+                                </List.Item>
+                            )}
+                            loadMore={searchResults.has_more ? (
+                                <div style={{ textAlign: 'center', margin: '10px 0' }}>
+                                    <Button
+                                        size="small"
+                                        loading={searchLoading}
+                                        onClick={() => handleSearch(searchQuery, searchResults.page + 1)}
+                                    >
+                                        Load more
+                                    </Button>
+                                </div>
+                            ) : null}
+                        />
+                    ) : chatHistory.length > 0 ? (
                         <List
                             dataSource={chatHistory}
                             renderItem={chat => (
@@ -1230,6 +1642,36 @@ const ChatPage = () => {
                                                     setNewTitle(chat.title || 'New Chat');
                                                 }}
                                             />
+                                            <Button 
+                                                type="text" 
+                                                icon={<ShareAltOutlined />} 
+                                                size="small"
+                                                onClick={(e) => {
+                                                    e.stopPropagation();
+                                                    handleShareChat(chat.id);
+                                                }}
+                                            />
+                                            <Dropdown
+                                                trigger={['click']}
+                                                menu={{
+                                                    items: [
+                                                        { key: 'md', label: 'Markdown' },
+                                                        { key: 'html', label: 'HTML' },
+                                                        { key: 'json', label: 'JSON' }
+                                                    ],
+                                                    onClick: ({ key, domEvent }) => {
+                                                        domEvent.stopPropagation();
+                                                        handleExport(chat.id, key, `${chat.title || 'chat'}.${key}`);
+                                                    }
+                                                }}
+                                            >
+                                                <Button 
+                                                    type="text" 
+                                                    icon={<DownloadOutlined />} 
+                                                    size="small"
+                                                    onClick={(e) => e.stopPropagation()}
+                                                />
+                                            </Dropdown>
                                             <Button 
                                                 type="text" 
                                                 icon={<DeleteOutlined />} 
@@ -1283,6 +1725,13 @@ const ChatPage = () => {
                             maxWidth: '100%'
                         }}
                     >
+                        {olderCursor && (
+                            <div style={{ textAlign: 'center', marginBottom: '10px' }}>
+                                <Button size="small" loading={loadingOlder} onClick={loadEarlierMessages}>
+                                    Load earlier messages
+                                </Button>
+                            </div>
+                        )}
                         {currentChat && currentChat.length > 0 ? (
                             <List
                                 itemLayout="horizontal"
@@ -1326,6 +1775,14 @@ const ChatPage = () => {
                                                     wordWrap: 'break-word',
                                                     marginTop: '0'
                                                 }}>
+                                                    {msg.context && (
+                                                        <div style={{ color: '#999', fontSize: '12px', marginBottom: '4px' }}>
+                                                            {contextNotice(msg.context)}
+                                                        </div>
+                                                    )}
+                                                    {msg.attachments?.length > 0 && (
+                                                        <MessageAttachments attachments={msg.attachments} />
+                                                    )}
                                                     {renderMessageContent(msg)}
                                                 </div>
                                             }
@@ -1336,24 +1793,101 @@ const ChatPage = () => {
                         ) : (
                             <div style={{ 
                                 display: 'flex', 
+                                flexDirection: 'column',
                                 justifyContent: 'center', 
                                 alignItems: 'center', 
                                 height: '100%',
                                 color: '#999'
                             }}>
-                                Select or create a chat to start
+                                {currentPersona ? (
+                                    <>
+                                        <Title level={4} style={{ marginBottom: '4px' }}>{currentPersona.name}</Title>
+                                        {currentPersona.description && <Text type="secondary">{currentPersona.description}</Text>}
+                                        <div style={{ display: 'flex', flexWrap: 'wrap', justifyContent: 'center', gap: '8px', marginTop: '16px', maxWidth: '600px' }}>
+                                            {currentPersona.starter_prompts.map(prompt => (
+                                                <Button key={prompt} onClick={() => setInputMessage(prompt)}>
+                                                    {prompt}
+                                                </Button>
+                                            ))}
+                                        </div>
+                                    </>
+                                ) : (
+                                    'Select or create a chat to start'
+                                )}
                             </div>
                         )}
                         {/* Add a reference point for scrolling to the bottom */}
                         <div ref={messagesEndRef} />
                     </div>
                     
+                    {/* 提示模板和变量，发送时由服务器填充 */}
+                    <div style={{ display: 'flex', flexWrap: 'wrap', gap: '8px', paddingTop: '8px', alignItems: 'center' }}>
+                        <Select
+                            value={selectedTemplateId}
+                            onChange={id => {
+                                setSelectedTemplateId(id);
+                                setTemplateValues({});
+                            }}
+                            placeholder="Prompt template"
+                            allowClear
+                            size="small"
+                            style={{ width: '200px' }}
+                            options={templates.map(t => ({ value: t.id, label: t.name }))}
+                        />
+                        {selectedTemplate?.variables.map(name => (
+                            <Input
+                                key={name}
+                                size="small"
+                                placeholder={name}
+                                value={templateValues[name] || ''}
+                                onChange={e => setTemplateValues(prev => ({ ...prev, [name]: e.target.value }))}
+                                style={{ width: '160px' }}
+                            />
+                        ))}
+                    </div>
+                    {selectedTemplate && (
+                        <div style={{ color: '#999', fontSize: '12px', whiteSpace: 'pre-wrap', paddingTop: '4px', maxHeight: '80px', overflow: 'auto' }}>
+                            {fillTemplate(selectedTemplate.content, templateValues)}
+                        </div>
+                    )}
+                    {pendingAttachments.length > 0 && (
+                        <div style={{ display: 'flex', flexWrap: 'wrap', gap: '8px', paddingTop: '8px' }}>
+                            {pendingAttachments.map(attachment => (
+                                <span
+                                    key={attachment.id}
+                                    style={{ background: '#f5f5f5', borderRadius: '4px', padding: '2px 8px', fontSize: '12px' }}
+                                >
+                                    {attachment.kind === 'image' ? <PaperClipOutlined /> : <FileTextOutlined />} {attachment.filename}
+                                    <CloseOutlined
+                                        style={{ marginLeft: '6px', cursor: 'pointer' }}
+                                        onClick={() => setPendingAttachments(prev => prev.filter(a => a.id !== attachment.id))}
+                                    />
+                                </span>
+                            ))}
+                        </div>
+                    )}
                     <div style={{ 
                         display: 'flex',
                         padding: '10px 0',
                         borderTop: '1px solid #f0f0f0',
                         backgroundColor: '#fff'
                     }}>
+                        <Button
+                            icon={<PaperClipOutlined />}
+                            loading={uploadingAttachment}
+                            disabled={loading || pendingAttachments.length >= 5}
+                            onClick={() => attachmentInputRef.current?.click()}
+                            title="Attach images or text files"
+                            style={{ height: '40px', marginRight: '10px' }}
+                        />
+                        <input
+                            type="file"
+                            multiple
+                            accept="image/png,image/jpeg,image/gif,image/webp,text/*,.md,.csv,.json,.py,.go,.js,.jsx,.ts,.java,.c,.cpp,.h,.yaml,.yml"
+                            ref={attachmentInputRef}
+                            style={{ display: 'none' }}
+                            onChange={handleAttachmentSelect}
+                        />
                         <TextArea
                             value={inputMessage}
                             onChange={e => setInputMessage(e.target.value)}
@@ -1371,15 +1905,25 @@ const ChatPage = () => {
                                 borderRadius: '4px'
                             }}
                         />
-                        <Button 
-                            type="primary" 
-                            icon={<SendOutlined />} 
-                            onClick={handleSend}
-                            loading={loading}
-                            style={{
-                                height: '40px'
-                            }}
-                        />
+                        {loading ? (
+                            <Button 
+                                danger
+                                icon={<StopOutlined />} 
+                                onClick={handleStop}
+                                style={{
+                                    height: '40px'
+                                }}
+                            />
+                        ) : (
+                            <Button 
+                                type="primary" 
+                                icon={<SendOutlined />} 
+                                onClick={handleSend}
+                                style={{
+                                    height: '40px'
+                                }}
+                            />
+                        )}
                     </div>
                 </Content>
             </Layout>
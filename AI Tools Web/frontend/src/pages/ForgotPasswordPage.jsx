@@ -0,0 +1,68 @@
+import React, { useState } from 'react';
+import { Form, Input, Button, message } from 'antd';
+import { Link } from 'react-router-dom';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const ForgotPasswordPage = () => {
+  const [loading, setLoading] = useState(false);
+  const [sent, setSent] = useState(false);
+
+  const onFinish = async (values) => {
+    try {
+      setLoading(true);
+      const response = await fetch(`${API_BASE_URL}/api/password/forgot`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email: values.email })
+      });
+      if (!response.ok) {
+        throw new Error(await response.text());
+      }
+      setSent(true);
+    } catch (error) {
+      message.error('Request failed: ' + error.message);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div style={{ display: 'flex', minHeight: '100vh', justifyContent: 'center', alignItems: 'center' }}>
+      <div style={{ width: '100%', maxWidth: '400px' }}>
+        <h1 style={{ fontSize: '28px', marginBottom: '8px', fontWeight: '600' }}>Forgot password</h1>
+        {sent ? (
+          <p style={{ color: '#666' }}>
+            If the email address is registered, we have sent a link to reset your password. Please check your inbox.
+          </p>
+        ) : (
+          <>
+            <p style={{ marginBottom: '32px', color: '#666', fontSize: '14px' }}>
+              Enter your email and we will send you a link to reset your password
+            </p>
+            <Form layout="vertical" onFinish={onFinish}>
+              <Form.Item
+                label="Email address"
+                name="email"
+                rules={[
+                  { required: true, message: 'Please input your email!' },
+                  { type: 'email', message: 'Please enter a valid email!' }
+                ]}
+              >
+                <Input placeholder="Enter your email" size="large" />
+              </Form.Item>
+              <Button type="primary" htmlType="submit" loading={loading} block size="large">
+                Send reset link
+              </Button>
+            </Form>
+          </>
+        )}
+        <div style={{ textAlign: 'center', marginTop: '24px' }}>
+          <Link to="/login" style={{ color: '#1677ff' }}>Back to sign in</Link>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ForgotPasswordPage;
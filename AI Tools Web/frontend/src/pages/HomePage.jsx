@@ -7,22 +7,33 @@ import {
   FileSearchOutlined
 } from '@ant-design/icons';
 import { useNavigate, useLocation, Outlet } from 'react-router-dom';
+import request, { refreshAccessToken } from '../utils/request';
 const { Header, Content } = Layout;
 
 const HomePage = () => {
   const navigate = useNavigate();
   const location = useLocation();
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    // 通知服务端结束当前会话
+    try {
+      await request.post('http://localhost:8080/api/logout', {
+        refresh_token: localStorage.getItem('refreshToken') || '',
+      });
+    } catch (error) {
+      console.error('Logout request failed:', error);
+    }
+
     // Clear all authentication information
     localStorage.removeItem('username');
     localStorage.removeItem('token');
+    localStorage.removeItem('refreshToken');
     navigate('/login');
   };
 
   // Check authentication status
   React.useEffect(() => {
-    const checkAuth = () => {
+    const checkAuth = async () => {
       const token = localStorage.getItem('token');
       if (!token) {
         navigate('/login', { replace: true });
@@ -38,8 +49,8 @@ const HomePage = () => {
         }).join(''));
 
         const { exp } = JSON.parse(jsonPayload);
-        if (exp * 1000 <= Date.now()) {
-          // Token expired, clear local storage and redirect to login page
+        if (exp * 1000 <= Date.now() && !(await refreshAccessToken())) {
+          // Token expired and could not be refreshed, clear local storage and redirect to login page
           localStorage.removeItem('token');
           localStorage.removeItem('username');
           navigate('/login', { replace: true });
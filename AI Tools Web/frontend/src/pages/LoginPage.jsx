@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { Form, Input, Button, Checkbox, message } from 'antd';
-import { GoogleOutlined } from '@ant-design/icons';
+import { BankOutlined } from '@ant-design/icons';
 import { Link, useNavigate } from 'react-router-dom';
 import request from '../utils/request';
 
@@ -8,6 +8,9 @@ const API_BASE_URL = 'http://localhost:8080';
 
 const LoginPage = () => {
     const [loading, setLoading] = useState(false);
+    const [sso, setSso] = useState(null);
+    // 开启两步验证时，密码验证通过后返回的挑战令牌
+    const [challenge, setChallenge] = useState(null);
     const navigate = useNavigate();
 
     // Check if token is expired
@@ -38,10 +41,99 @@ const LoginPage = () => {
         }
     };
 
+    // 单点登录回调通过 URL 片段返回令牌或错误
+    const handleSsoRedirect = () => {
+        if (!window.location.hash) return false;
+        const params = new URLSearchParams(window.location.hash.slice(1));
+        window.history.replaceState(null, '', window.location.pathname);
+
+        if (params.get('error')) {
+            const messages = {
+                account_disabled: 'Your account has been disabled',
+                email_unverified: 'Your email is not verified by the identity provider',
+                sso_expired: 'Sign-in session expired, please try again',
+                verification_pending: 'Please verify your email address before signing in',
+            };
+            message.error(messages[params.get('error')] || 'Single sign-on failed');
+            return false;
+        }
+        // 开启两步验证的账户继续在本页输入验证码
+        if (params.get('two_factor_required')) {
+            setChallenge(params.get('challenge_token'));
+            return true;
+        }
+        if (params.get('token')) {
+            localStorage.setItem('token', params.get('token'));
+            localStorage.setItem('refreshToken', params.get('refresh_token') || '');
+            localStorage.setItem('username', params.get('username') || '');
+            navigate('/chat', { replace: true });
+            return true;
+        }
+        return false;
+    };
+
     useEffect(() => {
-        checkTokenExpiration();
+        if (!handleSsoRedirect()) {
+            checkTokenExpiration();
+        }
     }, [navigate]);
 
+    // 仅在后端启用单点登录时显示按钮
+    useEffect(() => {
+        fetch(`${API_BASE_URL}/api/oidc/config`)
+            .then(res => (res.ok ? res.json() : null))
+            .then(config => setSso(config && config.enabled ? config : null))
+            .catch(() => setSso(null));
+    }, []);
+
+    const completeLogin = async (response, fallbackUsername) => {
+        await Promise.all([
+            localStorage.setItem('token', response.token),
+            localStorage.setItem('refreshToken', response.refresh_token || ''),
+            localStorage.setItem('username', response.username || fallbackUsername)
+        ]);
+        
+        // Create a new conversation and get its ID after successful login
+        try {
+            const chatResponse = await request(`${API_BASE_URL}/api/chat/new`, {
+                method: 'POST',
+            });
+            if (chatResponse && chatResponse.id) {
+                localStorage.setItem('currentChatId', chatResponse.id);
+            }
+        } catch (error) {
+            console.error('Failed to create initial chat:', error);
+        }
+        
+        navigate('/chat', { replace: true });
+    };
+
+    // 提交认证器验证码或恢复码（格式为 xxxx-xxxx）
+    const onVerifyTwoFactor = async (values) => {
+        const code = values.code.trim();
+        const isRecoveryCode = code.includes('-') || code.length > 6;
+        try {
+            setLoading(true);
+            const response = await request(`${API_BASE_URL}/api/login/2fa`, {
+                method: 'POST',
+                body: JSON.stringify({
+                    challenge_token: challenge,
+                    ...(isRecoveryCode ? { recovery_code: code } : { code })
+                })
+            });
+            if (response.token) {
+                await completeLogin(response, '');
+            }
+        } catch (error) {
+            if (error.message.includes('sign in again')) {
+                setChallenge(null);
+            }
+            message.error('Verification failed: ' + error.message);
+        } finally {
+            setLoading(false);
+        }
+    };
+
     const onFinish = async (values) => {
         try {
             setLoading(true);
@@ -53,25 +145,12 @@ const LoginPage = () => {
                 })
             });
 
+            if (response.two_factor_required) {
+                setChallenge(response.challenge_token);
+                return;
+            }
             if (response.token) {
-                await Promise.all([
-                    localStorage.setItem('token', response.token),
-                    localStorage.setItem('username', response.username || values.email)
-                ]);
-                
-                // Create a new conversation and get its ID after successful login
-                try {
-                    const chatResponse = await request(`${API_BASE_URL}/api/chat/new`, {
-                        method: 'POST',
-                    });
-                    if (chatResponse && chatResponse.id) {
-                        localStorage.setItem('currentChatId', chatResponse.id);
-                    }
-                } catch (error) {
-                    console.error('Failed to create initial chat:', error);
-                }
-                
-                navigate('/chat', { replace: true });
+                await completeLogin(response, values.email);
             }
         } catch (error) {
             message.error('Login failed: ' + error.message);
@@ -96,118 +175,158 @@ const LoginPage = () => {
                 padding: '0 100px'
             }}>
                 <div style={{ width: '100%', maxWidth: '400px' }}>
-                    <h1 style={{ 
-                        fontSize: "28px", 
-                        marginBottom: "8px",
-                        fontWeight: "600"
-                    }}>Welcome back!</h1>
-                    <p style={{ 
-                        marginBottom: "32px", 
-                        color: "#666",
-                        fontSize: "14px"
-                    }}>
-                        Enter your Credentials to access your account
-                    </p>
-
-                    <Form layout="vertical" onFinish={onFinish}>
-                        <Form.Item
-                            label={<>Email address <span style={{ color: '#ff4d4f' }}>*</span></>}
-                            name="email"
-                            validateTrigger="onBlur"
-                            rules={[
-                                { required: true, message: "Please input your email!" },
-                                { type: "email", message: "Please enter a valid email!" }
-                            ]}
-                        >
-                            <Input 
-                                placeholder="Enter your email" 
-                                size="large"
-                            />
-                        </Form.Item>
-
-                        <Form.Item
-                            label={<>Password <span style={{ color: '#ff4d4f' }}>*</span></>}
-                            name="password"
-                            validateTrigger="onBlur"
-                            rules={[{ required: true, message: "Please input your password!" }]}
-                        >
-                            <Input.Password 
-                                placeholder="Enter your password" 
-                                size="large"
-                            />
-                        </Form.Item>
-
-                        <div style={{
-                            display: 'flex',
-                            justifyContent: 'space-between',
-                            marginBottom: '24px'
-                        }}>
-                            <Form.Item name="remember" valuePropName="checked" noStyle>
-                                <Checkbox>Remember for 30 days</Checkbox>
-                            </Form.Item>
-                            <Link to="/forgot-password" style={{ color: '#1677ff' }}>
-                                Forgot password
-                            </Link>
-                        </div>
-
-                        <Form.Item>
-                            <Button 
-                                type="primary" 
-                                htmlType="submit" 
-                                loading={loading}
-                                block 
-                                size="large"
-                                style={{ 
-                                    backgroundColor: "#2B7A0B",
-                                    height: "44px",
-                                    borderRadius: "8px",
-                                    fontWeight: "500"
-                                }}
-                            >
-                                Sign in
-                            </Button>
-                        </Form.Item>
-
-                        <div style={{ 
-                            textAlign: "center", 
-                            margin: "24px 0",
-                            color: "#666",
-                            position: "relative"
-                        }}>
-                            <span style={{
-                                backgroundColor: "#fff",
-                                padding: "0 10px",
-                                zIndex: 1,
-                                position: "relative"
-                            }}>Or</span>
-                            <div style={{
-                                position: "absolute",
-                                top: "50%",
-                                left: 0,
-                                right: 0,
-                                height: "1px",
-                                backgroundColor: "#e8e8e8",
-                                zIndex: 0
-                            }}/>
-                        </div>
-
-                        <Button 
-                            icon={<GoogleOutlined />}
-                            size="large"
-                            block
-                            style={{ 
-                                height: "44px",
-                                borderRadius: "8px",
-                                border: "1px solid #e2e8f0",
-                            }}
-                        >
-                            Sign in with Google
-                        </Button>
-
-                        <div style={{ textAlign: "center", marginTop: "24px" }}>
-                            Don't have an account? <Link to="/signup" style={{ color: "#1677ff" }}>Sign up</Link>
-                        </div>
-                    </Form>
+                    {challenge ? (
+                        <>
+                            <h1 style={{ fontSize: "28px", marginBottom: "8px", fontWeight: "600" }}>
+                                Two-factor authentication
+                            </h1>
+                            <p style={{ marginBottom: "32px", color: "#666", fontSize: "14px" }}>
+                                Enter the 6-digit code from your authenticator app, or one of your recovery codes
+                            </p>
+                            <Form layout="vertical" onFinish={onVerifyTwoFactor}>
+                                <Form.Item
+                                    label="Verification code"
+                                    name="code"
+                                    rules={[{ required: true, message: "Please input your code!" }]}
+                                >
+                                    <Input placeholder="123456" size="large" autoComplete="one-time-code" autoFocus />
+                                </Form.Item>
+                                <Button
+                                    type="primary"
+                                    htmlType="submit"
+                                    loading={loading}
+                                    block
+                                    size="large"
+                                    style={{ backgroundColor: "#2B7A0B", height: "44px", borderRadius: "8px" }}
+                                >
+                                    Verify
+                                </Button>
+                                <div style={{ textAlign: "center", marginTop: "24px" }}>
+                                    <Button type="link" onClick={() => setChallenge(null)}>Back to sign in</Button>
+                                </div>
+                            </Form>
+                        </>
+                    ) : (
+                        <>
+                            <h1 style={{ 
+                                fontSize: "28px", 
+                                marginBottom: "8px",
+                                fontWeight: "600"
+                            }}>Welcome back!</h1>
+                            <p style={{ 
+                                marginBottom: "32px", 
+                                color: "#666",
+                                fontSize: "14px"
+                            }}>
+                                Enter your Credentials to access your account
+                            </p>
+
+                            <Form layout="vertical" onFinish={onFinish}>
+                                <Form.Item
+                                    label={<>Email address <span style={{ color: '#ff4d4f' }}>*</span></>}
+                                    name="email"
+                                    validateTrigger="onBlur"
+                                    rules={[
+                                        { required: true, message: "Please input your email!" },
+                                        { type: "email", message: "Please enter a valid email!" }
+                                    ]}
+                                >
+                                    <Input 
+                                        placeholder="Enter your email" 
+                                        size="large"
+                                    />
+                                </Form.Item>
+
+                                <Form.Item
+                                    label={<>Password <span style={{ color: '#ff4d4f' }}>*</span></>}
+                                    name="password"
+                                    validateTrigger="onBlur"
+                                    rules={[{ required: true, message: "Please input your password!" }]}
+                                >
+                                    <Input.Password 
+                                        placeholder="Enter your password" 
+                                        size="large"
+                                    />
+                                </Form.Item>
+
+                                <div style={{
+                                    display: 'flex',
+                                    justifyContent: 'space-between',
+                                    marginBottom: '24px'
+                                }}>
+                                    <Form.Item name="remember" valuePropName="checked" noStyle>
+                                        <Checkbox>Remember for 30 days</Checkbox>
+                                    </Form.Item>
+                                    <Link to="/forgot-password" style={{ color: '#1677ff' }}>
+                                        Forgot password
+                                    </Link>
+                                </div>
+
+                                <Form.Item>
+                                    <Button 
+                                        type="primary" 
+                                        htmlType="submit" 
+                                        loading={loading}
+                                        block 
+                                        size="large"
+                                        style={{ 
+                                            backgroundColor: "#2B7A0B",
+                                            height: "44px",
+                                            borderRadius: "8px",
+                                            fontWeight: "500"
+                                        }}
+                                    >
+                                        Sign in
+                                    </Button>
+                                </Form.Item>
+
+                                {sso && (
+                                    <>
+                                        <div style={{ 
+                                            textAlign: "center", 
+                                            margin: "24px 0",
+                                            color: "#666",
+                                            position: "relative"
+                                        }}>
+                                            <span style={{
+                                                backgroundColor: "#fff",
+                                                padding: "0 10px",
+                                                zIndex: 1,
+                                                position: "relative"
+                                            }}>Or</span>
+                                            <div style={{
+                                                position: "absolute",
+                                                top: "50%",
+                                                left: 0,
+                                                right: 0,
+                                                height: "1px",
+                                                backgroundColor: "#e8e8e8",
+                                                zIndex: 0
+                                            }}/>
+                                        </div>
+
+                                        <Button 
+                                            icon={<BankOutlined />}
+                                            size="large"
+                                            block
+                                            onClick={() => { window.location.href = `${API_BASE_URL}/api/oidc/login`; }}
+                                            style={{ 
+                                                height: "44px",
+                                                borderRadius: "8px",
+                                                border: "1px solid #e2e8f0",
+                                            }}
+                                        >
+                                            Sign in with {sso.provider_name}
+                                        </Button>
+                                    </>
+                                )}
+
+                                <div style={{ textAlign: "center", marginTop: "24px" }}>
+                                    Don't have an account? <Link to="/signup" style={{ color: "#1677ff" }}>Sign up</Link>
+                                </div>
+                            </Form>
+                        </>
+                    )}
                 </div>
             </div>
             
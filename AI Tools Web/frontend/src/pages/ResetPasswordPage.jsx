@@ -0,0 +1,79 @@
+import React, { useState } from 'react';
+import { Form, Input, Button, message } from 'antd';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const ResetPasswordPage = () => {
+  const [loading, setLoading] = useState(false);
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  const token = searchParams.get('token');
+
+  const onFinish = async (values) => {
+    try {
+      setLoading(true);
+      const response = await fetch(`${API_BASE_URL}/api/password/reset`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token, new_password: values.password })
+      });
+      if (!response.ok) {
+        throw new Error(await response.text());
+      }
+      message.success('Password has been reset, please sign in');
+      navigate('/login', { replace: true });
+    } catch (error) {
+      message.error('Reset failed: ' + error.message);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div style={{ display: 'flex', minHeight: '100vh', justifyContent: 'center', alignItems: 'center' }}>
+      <div style={{ width: '100%', maxWidth: '400px' }}>
+        <h1 style={{ fontSize: '28px', marginBottom: '8px', fontWeight: '600' }}>Reset password</h1>
+        {!token ? (
+          <p style={{ color: '#666' }}>This reset link is invalid. Please request a new one.</p>
+        ) : (
+          <Form layout="vertical" onFinish={onFinish}>
+            <Form.Item
+              label="New password"
+              name="password"
+              rules={[{ required: true, message: 'Please input your new password!' }]}
+            >
+              <Input.Password placeholder="Enter a new password" size="large" />
+            </Form.Item>
+            <Form.Item
+              label="Confirm password"
+              name="confirm"
+              dependencies={['password']}
+              rules={[
+                { required: true, message: 'Please confirm your new password!' },
+                ({ getFieldValue }) => ({
+                  validator(_, value) {
+                    if (!value || getFieldValue('password') === value) {
+                      return Promise.resolve();
+                    }
+                    return Promise.reject(new Error('The two passwords do not match!'));
+                  }
+                })
+              ]}
+            >
+              <Input.Password placeholder="Repeat the new password" size="large" />
+            </Form.Item>
+            <Button type="primary" htmlType="submit" loading={loading} block size="large">
+              Reset password
+            </Button>
+          </Form>
+        )}
+        <div style={{ textAlign: 'center', marginTop: '24px' }}>
+          <Link to="/forgot-password" style={{ color: '#1677ff' }}>Request a new link</Link>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ResetPasswordPage;
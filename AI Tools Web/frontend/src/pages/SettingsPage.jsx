@@ -21,6 +21,12 @@ import LockIcon from '@mui/icons-material/Lock';
 import Visibility from '@mui/icons-material/Visibility';
 import VisibilityOff from '@mui/icons-material/VisibilityOff';
 import axios from 'axios';
+import ApiKeysSection from '../components/ApiKeysSection';
+import SharesSection from '../components/SharesSection';
+import PersonasSection from '../components/PersonasSection';
+import PromptTemplatesSection from '../components/PromptTemplatesSection';
+import TwoFactorSection from '../components/TwoFactorSection';
+import AccountDataSection from '../components/AccountDataSection';
 
 const SettingsPage = () => {
   const [loading, setLoading] = useState(false);
@@ -118,7 +124,12 @@ const SettingsPage = () => {
         }
       );
 
-      setPasswordSuccess('Password changed successfully');
+      // 其他会话已被注销，保存服务器返回的新令牌
+      if (response.data?.token) {
+        localStorage.setItem('token', response.data.token);
+        localStorage.setItem('refreshToken', response.data.refresh_token || '');
+      }
+      setPasswordSuccess('Password changed successfully. You have been signed out on other devices.');
       // Reset fields
       setOldPassword('');
       setNewPassword('');
@@ -200,6 +211,18 @@ const SettingsPage = () => {
           Change Password
         </Button>
       </Paper>
+
+      <ApiKeysSection />
+
+      <SharesSection />
+
+      <PersonasSection />
+
+      <PromptTemplatesSection />
+
+      <TwoFactorSection />
+
+      <AccountDataSection />
       
       <Paper elevation={2} sx={{ p: 3, mb: 4 }}>
         <Typography variant="h6" gutterBottom>
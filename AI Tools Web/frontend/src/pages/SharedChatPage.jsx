@@ -0,0 +1,67 @@
+import React, { useEffect, useState } from 'react';
+import { Result, Spin, Avatar, Typography } from 'antd';
+import { UserOutlined, RobotOutlined } from '@ant-design/icons';
+import { useParams } from 'react-router-dom';
+import ReactMarkdown from 'react-markdown';
+import remarkGfm from 'remark-gfm';
+import dayjs from 'dayjs';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+// 通过分享链接查看的只读聊天，不需要登录
+const SharedChatPage = () => {
+  const { token } = useParams();
+  const [chat, setChat] = useState(null);
+  const [error, setError] = useState('');
+
+  useEffect(() => {
+    fetch(`${API_BASE_URL}/api/share/${encodeURIComponent(token)}`)
+      .then(async (response) => {
+        if (!response.ok) {
+          throw new Error(response.status === 404
+            ? 'This share link is invalid, has expired or was revoked.'
+            : (await response.text()).trim());
+        }
+        setChat(await response.json());
+      })
+      .catch((err) => setError(err.message));
+  }, [token]);
+
+  if (error) {
+    return <Result status="404" title="Shared chat not available" subTitle={error} />;
+  }
+  if (!chat) {
+    return (
+      <div style={{ display: 'flex', minHeight: '100vh', justifyContent: 'center', alignItems: 'center' }}>
+        <Spin size="large" />
+      </div>
+    );
+  }
+
+  return (
+    <div style={{ maxWidth: '860px', margin: '0 auto', padding: '24px 16px' }}>
+      <Typography.Title level={3}>{chat.title}</Typography.Title>
+      <Typography.Text type="secondary">
+        {chat.model} · Shared {dayjs(chat.shared_at).format('YYYY-MM-DD HH:mm')}
+      </Typography.Text>
+      {chat.messages.map((msg, index) => (
+        <div key={index} style={{ display: 'flex', gap: '12px', padding: '16px 0', borderBottom: '1px solid #f0f0f0' }}>
+          <Avatar style={{ backgroundColor: msg.role === 'user' ? '#1890ff' : '#52c41a', flexShrink: 0 }}>
+            {msg.role === 'user' ? <UserOutlined /> : <RobotOutlined />}
+          </Avatar>
+          <div style={{ minWidth: 0, flex: 1, wordBreak: 'break-word' }}>
+            {msg.role === 'assistant' ? (
+              <div className="markdown-content">
+                <ReactMarkdown remarkPlugins={[remarkGfm]}>{msg.content}</ReactMarkdown>
+              </div>
+            ) : (
+              <div style={{ whiteSpace: 'pre-wrap' }}>{msg.content}</div>
+            )}
+          </div>
+        </div>
+      ))}
+    </div>
+  );
+};
+
+export default SharedChatPage;
@@ -21,7 +21,7 @@ const SignUpPage = () => {
       });
 
       if (response.ok) {
-        message.success('Registration successful!');
+        message.success('Registration successful! Please check your email to verify your address.');
         navigate('/login');
       } else {
         const errorData = await response.text();
@@ -0,0 +1,61 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { Result, Button, Spin } from 'antd';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+
+const API_BASE_URL = 'http://localhost:8080';
+
+const VerifyEmailPage = () => {
+  const [status, setStatus] = useState('pending');
+  const [error, setError] = useState('');
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  const requested = useRef(false);
+
+  useEffect(() => {
+    // 令牌只能使用一次，避免开发模式下重复请求
+    if (requested.current) return;
+    requested.current = true;
+
+    const token = searchParams.get('token');
+    if (!token) {
+      setStatus('error');
+      setError('The verification link is invalid.');
+      return;
+    }
+
+    fetch(`${API_BASE_URL}/api/verify-email`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token })
+    })
+      .then(async (response) => {
+        if (!response.ok) {
+          throw new Error(await response.text());
+        }
+        setStatus('success');
+      })
+      .catch((err) => {
+        setStatus('error');
+        setError(err.message);
+      });
+  }, [searchParams]);
+
+  if (status === 'pending') {
+    return (
+      <div style={{ display: 'flex', minHeight: '100vh', justifyContent: 'center', alignItems: 'center' }}>
+        <Spin size="large" />
+      </div>
+    );
+  }
+
+  return (
+    <Result
+      status={status === 'success' ? 'success' : 'error'}
+      title={status === 'success' ? 'Email verified' : 'Verification failed'}
+      subTitle={status === 'success' ? 'Your email address has been verified.' : error}
+      extra={<Button type="primary" onClick={() => navigate('/login')}>Go to sign in</Button>}
+    />
+  );
+};
+
+export default VerifyEmailPage;
@@ -1,3 +1,38 @@
+const API_BASE_URL = 'http://localhost:8080';
+
+let refreshPromise = null;
+
+// 使用刷新令牌换取新的访问令牌，多个并发请求共享同一次刷新
+export const refreshAccessToken = () => {
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (!refreshToken) {
+        return Promise.resolve(null);
+    }
+
+    if (!refreshPromise) {
+        refreshPromise = fetch(`${API_BASE_URL}/api/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken }),
+        })
+            .then(async (response) => {
+                if (!response.ok) {
+                    localStorage.removeItem('refreshToken');
+                    return null;
+                }
+                const data = await response.json();
+                localStorage.setItem('token', data.token);
+                localStorage.setItem('refreshToken', data.refresh_token);
+                return data.token;
+            })
+            .catch(() => null)
+            .finally(() => {
+                refreshPromise = null;
+            });
+    }
+    return refreshPromise;
+};
+
 const request = async (url, options = {}) => {
     const token = localStorage.getItem('token');
     
@@ -43,9 +78,12 @@ const request = async (url, options = {}) => {
         if (response.status === 401) {
             if (url.includes('/api/login')) {
                 // 如果是登录接口的 401 错误，创建一个包含状态码的错误对象
-                const error = new Error('Invalid email or password');
+                const error = new Error((await response.text()).trim() || 'Invalid email or password');
                 error.status = 401;
                 throw error;
+            } else if (!options._retried && await refreshAccessToken()) {
+                // 访问令牌过期，刷新后重试一次
+                return request(url, { ...options, _retried: true });
             } else {
                 // 其他接口的 401 错误，按原来的逻辑处理
                 localStorage.removeItem('token'); // Clear invalid token